@@ -9,26 +9,95 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/Kyle91/haven/clock"
 	"github.com/Kyle91/haven/crypto"
 	"io"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 )
 
+var (
+	ErrInvalidTokenFormat = errors.New("invalid token format")
+	ErrInvalidUserID      = errors.New("invalid user id")
+	ErrInvalidExpiration  = errors.New("invalid expiration time")
+	ErrSaltMismatch       = errors.New("salt mismatch")
+	ErrTokenExpired       = errors.New("token expired")
+	ErrTokenNotYetValid   = errors.New("token not valid yet")
+	ErrTokenRevoked       = errors.New("token revoked")
+	// ErrStoreUnavailable 吊销列表等存储出错，不是token本身的问题，返回时会包装原始错误
+	ErrStoreUnavailable = errors.New("auth store unavailable")
+)
+
 type AuthToken struct {
 	SecretKey []byte //base64的
 	Salt      string
+
+	revocation RevocationStore
+	clock      clock.Clock
+	leeway     int64      // 校验过期和生效时间时允许的时钟误差(秒)
+	nonces     NonceStore // 已使用的持有私钥证明challenge
+}
+
+// Option AuthToken 的可选配置
+type Option func(*AuthToken)
+
+// WithRevocation 设置吊销列表，ParseToken 时会检查token是否已被吊销
+func WithRevocation(store RevocationStore) Option {
+	return func(a *AuthToken) {
+		a.revocation = store
+	}
+}
+
+// WithClock 设置时钟，默认使用系统时钟
+func WithClock(c clock.Clock) Option {
+	return func(a *AuthToken) {
+		a.clock = c
+	}
+}
+
+// WithLeeway 设置校验过期和生效时间时允许的时钟误差，用于服务器之间时钟不一致的情况
+func WithLeeway(leeway time.Duration) Option {
+	return func(a *AuthToken) {
+		a.leeway = int64(leeway / time.Second)
+	}
 }
 
 // 初始化 AuthToken 类
 // secretKey是base64的
-func NewAuthToken(secretKey, salt string) *AuthToken {
+func NewAuthToken(secretKey, salt string, opts ...Option) *AuthToken {
 	key, _ := base64.StdEncoding.DecodeString(secretKey)
-	return &AuthToken{
+	a := &AuthToken{
 		SecretKey: key,
 		Salt:      salt,
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	a.clock = clock.OrDefault(a.clock)
+	if a.nonces == nil {
+		a.nonces = NewMemoryNonceStore().WithClock(a.clock)
+	}
+	return a
+}
+
+// Claims token中携带的信息
+type Claims struct {
+	UserID    int64
+	ExpireAt  int64    // 过期时间戳(秒)
+	TokenID   string   // token唯一标识
+	IssuedAt  int64    // 签发时间戳(秒)，旧格式的token为0
+	NotBefore int64    // 生效时间戳(秒)，可选，0表示签发后立即生效
+	DeviceID  string   // 设备ID，可选
+	Roles     []string // 角色，可选，用于权限检查
+	AuthTime  int64    // 登录时间戳(秒)，续期后的token保持不变，默认和 IssuedAt 相同
+	FamilyID  string   // 签发该token的刷新token family，可选，见 RefreshManager
+
+	// 绑定，可选，见 Binding
+	BindDevice    bool   // 只能在 DeviceID 对应的设备上使用
+	IPPrefix      string // 只能在该网段内使用，CIDR格式，见 IPPrefix
+	KeyThumbprint string // 客户端公钥的 JWK thumbprint，使用时需要提供持有私钥的证明
 }
 
 // 生成随机字符串
@@ -42,17 +111,40 @@ func generateRandomString() (string, error) {
 
 // 生成 Token
 func (a *AuthToken) GenerateToken(userID int64, expirationTime int64) (string, error) {
-	// 1. 生成过期时间戳
-	expiration := time.Now().Add(time.Duration(expirationTime) * time.Second).Unix()
+	return a.GenerateTokenWithClaims(&Claims{UserID: userID}, expirationTime)
+}
+
+// GenerateTokenWithClaims
+//
+//	@Description: 根据claims生成token，TokenID、IssuedAt、ExpireAt 会被填充到claims中，其余字段由调用方设置
+//	@receiver a
+//	@param claims
+//	@param expirationTime 有效期(秒)
+//	@return string
+//	@return error
+func (a *AuthToken) GenerateTokenWithClaims(claims *Claims, expirationTime int64) (string, error) {
+	if claims.BindDevice && claims.DeviceID == "" {
+		return "", errors.New("device binding requires device id")
+	}
+
+	// 1. 生成签发时间和过期时间戳
+	now := a.clock.Now()
+	claims.IssuedAt = now.Unix()
+	if claims.AuthTime == 0 {
+		claims.AuthTime = claims.IssuedAt
+	}
+	claims.ExpireAt = now.Add(time.Duration(expirationTime) * time.Second).Unix()
 
-	// 2. 生成一个随机字符串
+	// 2. 生成一个随机字符串，作为token的唯一标识
 	randomString, err := generateRandomString()
 	if err != nil {
 		return "", err
 	}
+	claims.TokenID = randomString
 
-	// 3. 拼接原始数据: userID:expiration:salt:randomString
-	rawData := fmt.Sprintf("%d:%d:%s:%s", userID, expiration, a.Salt, randomString)
+	// 3. 拼接原始数据: userID:expiration:salt:randomString，扩展字段以 :key=value 的形式追加
+	rawData := fmt.Sprintf("%d:%d:%s:%s", claims.UserID, claims.ExpireAt, a.Salt, claims.TokenID)
+	rawData += encodeExtFields(claims)
 
 	// 4. 对原始数据进行加密，生成 token
 	token, err := crypto.Aes256Encrypt(a.SecretKey, []byte(rawData))
@@ -64,46 +156,234 @@ func (a *AuthToken) GenerateToken(userID int64, expirationTime int64) (string, e
 	return hex.EncodeToString(token), nil
 }
 
-// 解析 Token
-func (a *AuthToken) ParseToken(token string) (int64, bool, error) {
+// 解析 Token，token有绑定时需要传入当前请求的绑定信息
+func (a *AuthToken) ParseToken(token string, binding ...*Binding) (int64, bool, error) {
+	claims, err := a.ParseClaims(token, binding...)
+	if claims == nil {
+		return 0, false, err
+	}
+	if err != nil {
+		return claims.UserID, false, err
+	}
+	return claims.UserID, true, nil
+}
+
+// ParseClaims
+//
+//	@Description: 解析并校验token，返回其中的claims
+//	@receiver a
+//	@param token
+//	@param binding 当前请求的绑定信息，只使用第一个，token绑定了IP、设备或公钥而没有传入时校验失败
+//	@return *Claims 过期或被吊销时仍然返回claims，同时返回对应的错误
+//	@return error
+func (a *AuthToken) ParseClaims(token string, binding ...*Binding) (*Claims, error) {
+	claims, err := a.decodeClaims(token)
+	if err != nil {
+		return nil, err
+	}
+	if err = a.ValidateClaims(claims); err != nil {
+		return claims, err
+	}
+
+	// 校验绑定，放在最后，避免其他校验失败时消耗掉challenge
+	var b *Binding
+	if len(binding) > 0 {
+		b = binding[0]
+	}
+	if err = a.verifyBinding(claims, b); err != nil {
+		return claims, err
+	}
+
+	return claims, nil
+}
+
+// ValidateClaims
+//
+//	@Description: 校验claims的有效期和吊销状态，不校验盐值和绑定，用于已经通过 Inspect 解出claims的排查工具
+//	@receiver a
+//	@param claims
+//	@return error
+func (a *AuthToken) ValidateClaims(claims *Claims) error {
+	// 校验是否过期和是否已经生效
+	currentTime := a.clock.Now().Unix()
+	if currentTime > claims.ExpireAt+a.leeway {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != 0 && currentTime+a.leeway < claims.NotBefore {
+		return ErrTokenNotYetValid
+	}
+
+	// 校验是否被吊销
+	if a.revocation != nil {
+		revoked, err := a.revocation.IsRevoked(claims)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrStoreUnavailable, err)
+		}
+		if revoked {
+			return ErrTokenRevoked
+		}
+	}
+	return nil
+}
+
+// Logout
+//
+//	@Description: 注销，吊销该token直到其过期
+//	@receiver a
+//	@param token
+//	@return error
+func (a *AuthToken) Logout(token string) error {
+	if a.revocation == nil {
+		return errors.New("revocation store not configured")
+	}
+	claims, err := a.decodeClaims(token)
+	if err != nil {
+		return err
+	}
+	return a.revocation.RevokeToken(claims.TokenID, claims.ExpireAt)
+}
+
+// decodeClaims 解密token并校验盐值，不校验有效期
+func (a *AuthToken) decodeClaims(token string) (*Claims, error) {
+	claims, salt, err := a.Inspect(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// 校验盐值是否匹配
+	if salt != a.Salt {
+		return nil, ErrSaltMismatch
+	}
+	return claims, nil
+}
+
+// Inspect
+//
+//	@Description: 解密token并解析字段，不校验盐值、有效期和吊销，用于排查问题
+//	@receiver a
+//	@param token
+//	@return *Claims
+//	@return string token中的盐值
+//	@return error
+func (a *AuthToken) Inspect(token string) (*Claims, string, error) {
 	// 1. 将十六进制字符串解码为字节数组
 	tokenBytes, err := hex.DecodeString(token)
 	if err != nil {
-		return 0, false, errors.New("invalid token format")
+		return nil, "", ErrInvalidTokenFormat
 	}
 
 	// 2. 对 token 进行解密，获取原始数据
 	decryptedData, err := crypto.Aes256Decrypt(a.SecretKey, tokenBytes)
 	if err != nil {
-		return 0, false, err
+		return nil, "", err
 	}
 
 	// 3. 拆分原始数据
 	parts := strings.Split(string(decryptedData), ":")
-	if len(parts) != 4 {
-		return 0, false, errors.New("invalid token format")
+	if len(parts) < 4 {
+		return nil, "", ErrInvalidTokenFormat
 	}
 
-	userID, err := strconv.ParseInt(parts[0], 10, 64)
+	claims := &Claims{TokenID: parts[3]}
+	claims.UserID, err = strconv.ParseInt(parts[0], 10, 64)
 	if err != nil {
-		return 0, false, errors.New("invalid user id")
+		return nil, "", ErrInvalidUserID
 	}
-	expiration, err := strconv.ParseInt(parts[1], 10, 64)
+	claims.ExpireAt, err = strconv.ParseInt(parts[1], 10, 64)
 	if err != nil {
-		return 0, false, errors.New("invalid expiration time")
+		return nil, "", ErrInvalidExpiration
 	}
-	tokenSalt := parts[2]
 
-	// 4. 校验盐值是否匹配
-	if tokenSalt != a.Salt {
-		return 0, false, errors.New("salt mismatch")
+	// 4. 解析扩展字段
+	if err = decodeExtFields(claims, parts[4:]); err != nil {
+		return nil, "", err
 	}
 
-	// 5. 校验是否过期
-	currentTime := time.Now().Unix()
-	if currentTime > expiration {
-		return userID, false, errors.New("token expired")
+	return claims, parts[2], nil
+}
+
+// encodeExtFields 编码扩展字段，值做url转义避免和分隔符冲突
+func encodeExtFields(claims *Claims) string {
+	var sb strings.Builder
+	writeField := func(key, value string) {
+		sb.WriteString(":")
+		sb.WriteString(key)
+		sb.WriteString("=")
+		sb.WriteString(url.QueryEscape(value))
 	}
 
-	return userID, true, nil
+	writeField("iat", strconv.FormatInt(claims.IssuedAt, 10))
+	if claims.AuthTime != 0 && claims.AuthTime != claims.IssuedAt {
+		writeField("ath", strconv.FormatInt(claims.AuthTime, 10))
+	}
+	if claims.NotBefore != 0 {
+		writeField("nbf", strconv.FormatInt(claims.NotBefore, 10))
+	}
+	if claims.DeviceID != "" {
+		writeField("dev", claims.DeviceID)
+	}
+	if len(claims.Roles) > 0 {
+		writeField("rol", strings.Join(claims.Roles, ","))
+	}
+	if claims.BindDevice {
+		writeField("bdv", "1")
+	}
+	if claims.IPPrefix != "" {
+		writeField("ipp", claims.IPPrefix)
+	}
+	if claims.KeyThumbprint != "" {
+		writeField("jkt", claims.KeyThumbprint)
+	}
+	if claims.FamilyID != "" {
+		writeField("fam", claims.FamilyID)
+	}
+	return sb.String()
+}
+
+// decodeExtFields 解析扩展字段，不认识的字段忽略，方便以后扩展
+func decodeExtFields(claims *Claims, fields []string) error {
+	for _, field := range fields {
+		key, raw, ok := strings.Cut(field, "=")
+		if !ok {
+			return ErrInvalidTokenFormat
+		}
+		value, err := url.QueryUnescape(raw)
+		if err != nil {
+			return ErrInvalidTokenFormat
+		}
+
+		switch key {
+		case "iat":
+			claims.IssuedAt, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrInvalidTokenFormat
+			}
+		case "nbf":
+			claims.NotBefore, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrInvalidTokenFormat
+			}
+		case "ath":
+			claims.AuthTime, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrInvalidTokenFormat
+			}
+		case "dev":
+			claims.DeviceID = value
+		case "rol":
+			claims.Roles = strings.Split(value, ",")
+		case "bdv":
+			claims.BindDevice = value == "1"
+		case "ipp":
+			claims.IPPrefix = value
+		case "jkt":
+			claims.KeyThumbprint = value
+		case "fam":
+			claims.FamilyID = value
+		}
+	}
+	if claims.AuthTime == 0 {
+		claims.AuthTime = claims.IssuedAt
+	}
+	return nil
 }
@@ -0,0 +1,188 @@
+// @Author Eric
+// @Date 2026/10/23 10:00:00
+// @Desc token绑定，把token绑定到设备、IP网段或客户端公钥，防止token被盗用后在其他地方使用
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/Kyle91/haven/crypto"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenBindingMismatch = errors.New("token binding mismatch")
+	ErrProofRequired        = errors.New("proof of possession required")
+	ErrProofInvalid         = errors.New("invalid proof of possession")
+)
+
+// Binding 校验token绑定时由调用方提供的当前请求信息
+type Binding struct {
+	DeviceID string    // 客户端上报的设备ID
+	IP       string    // 客户端IP
+	Proof    *KeyProof // 持有私钥的证明，token绑定了公钥时必须提供
+}
+
+// KeyProof 客户端用私钥对服务端下发的challenge签名
+type KeyProof struct {
+	Key       *JWK   // 客户端公钥，thumbprint需要和token中的一致
+	Challenge string // 服务端通过 NewChallenge 下发的challenge
+	Signature []byte // 对challenge原文的签名，算法由公钥类型决定: RSA用RS256，EC用ES256，OKP用EdDSA
+}
+
+// WithProofNonces 设置已使用challenge的存储，多节点部署时需要共享，默认内存实现
+func WithProofNonces(store NonceStore) Option {
+	return func(a *AuthToken) {
+		a.nonces = store
+	}
+}
+
+// IPPrefix
+//
+//	@Description: 计算IP所在的网段，用于签发时填写 Claims.IPPrefix
+//	@param ip 客户端IP
+//	@param v4Bits IPv4的前缀长度，例如24
+//	@param v6Bits IPv6的前缀长度，例如64
+//	@return string CIDR格式，例如 203.0.113.0/24，IP无效时返回空字符串
+func IPPrefix(ip string, v4Bits, v6Bits int) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		mask := net.CIDRMask(v4Bits, 32)
+		if mask == nil {
+			return ""
+		}
+		return (&net.IPNet{IP: v4.Mask(mask), Mask: mask}).String()
+	}
+	mask := net.CIDRMask(v6Bits, 128)
+	if mask == nil {
+		return ""
+	}
+	return (&net.IPNet{IP: parsed.Mask(mask), Mask: mask}).String()
+}
+
+// NewChallenge
+//
+//	@Description: 生成持有私钥证明用的challenge，challenge自带过期时间和签名，服务端不需要保存
+//	@receiver a
+//	@param ttl 有效期
+//	@return string
+//	@return error
+func (a *AuthToken) NewChallenge(ttl time.Duration) (string, error) {
+	nonce, err := crypto.GenerateRandomKey(16)
+	if err != nil {
+		return "", err
+	}
+	payload := b64url(nonce) + "." + strconv.FormatInt(a.clock.Now().Add(ttl).Unix(), 10)
+	return payload + "." + b64url(a.challengeMAC(payload)), nil
+}
+
+// challengeMAC challenge的签名，密钥和token一样，加上前缀区分用途
+func (a *AuthToken) challengeMAC(payload string) []byte {
+	mac := hmac.New(sha256.New, a.SecretKey)
+	mac.Write([]byte("haven-pop:"))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// verifyBinding 校验token的绑定，token没有绑定的维度不校验
+func (a *AuthToken) verifyBinding(claims *Claims, binding *Binding) error {
+	if !claims.BindDevice && claims.IPPrefix == "" && claims.KeyThumbprint == "" {
+		return nil
+	}
+	if binding == nil {
+		binding = &Binding{}
+	}
+
+	if claims.BindDevice {
+		if binding.DeviceID == "" || subtle.ConstantTimeCompare([]byte(binding.DeviceID), []byte(claims.DeviceID)) != 1 {
+			return ErrTokenBindingMismatch
+		}
+	}
+
+	if claims.IPPrefix != "" {
+		_, network, err := net.ParseCIDR(claims.IPPrefix)
+		if err != nil {
+			return ErrInvalidTokenFormat
+		}
+		ip := net.ParseIP(binding.IP)
+		if ip == nil || !network.Contains(ip) {
+			return ErrTokenBindingMismatch
+		}
+	}
+
+	if claims.KeyThumbprint != "" {
+		return a.verifyProof(claims.KeyThumbprint, binding.Proof)
+	}
+	return nil
+}
+
+// verifyProof 校验公钥thumbprint、challenge和签名，通过后challenge不能再次使用
+func (a *AuthToken) verifyProof(thumbprint string, proof *KeyProof) error {
+	if proof == nil || proof.Key == nil {
+		return ErrProofRequired
+	}
+
+	tp, err := proof.Key.Thumbprint()
+	if err != nil || subtle.ConstantTimeCompare([]byte(tp), []byte(thumbprint)) != 1 {
+		return ErrTokenBindingMismatch
+	}
+
+	// challenge格式: nonce.过期时间.签名
+	parts := strings.Split(proof.Challenge, ".")
+	if len(parts) != 3 {
+		return ErrProofInvalid
+	}
+	mac, err := b64urlDecode(parts[2])
+	if err != nil || !hmac.Equal(mac, a.challengeMAC(parts[0]+"."+parts[1])) {
+		return ErrProofInvalid
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || a.clock.Now().Unix() > exp {
+		return ErrProofInvalid
+	}
+
+	alg, err := proofAlgorithm(proof.Key)
+	if err != nil {
+		return err
+	}
+	if !jwtVerify(alg, proof.Key.Key(), []byte(proof.Challenge), proof.Signature) {
+		return ErrProofInvalid
+	}
+
+	ok, err := a.nonces.Use(parts[0], time.Unix(exp, 0))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrStoreUnavailable, err)
+	}
+	if !ok {
+		return ErrProofInvalid
+	}
+	return nil
+}
+
+// proofAlgorithm 根据公钥类型确定签名算法，不接受对称密钥
+func proofAlgorithm(k *JWK) (string, error) {
+	var alg string
+	switch k.Kty {
+	case "RSA":
+		alg = AlgRS256
+	case "EC":
+		alg = AlgES256
+	case "OKP":
+		alg = AlgEdDSA
+	default:
+		return "", ErrProofInvalid
+	}
+	if checkVerifyKey(alg, k.Key()) != nil {
+		return "", ErrProofInvalid
+	}
+	return alg, nil
+}
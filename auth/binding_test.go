@@ -0,0 +1,219 @@
+// @Author Eric
+// @Date 2026/10/29 17:00:00
+// @Desc token绑定设备、IP网段和客户端公钥的测试
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"github.com/Kyle91/haven/clock"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIPPrefix(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.7", "203.0.113.0/24"},
+		{"::ffff:203.0.113.7", "203.0.113.0/24"},
+		{"2001:db8:1:2::1", "2001:db8:1:2::/64"},
+		{"not an ip", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := IPPrefix(tt.ip, 24, 64); got != tt.want {
+			t.Fatalf("IPPrefix(%q): want %q, got %q", tt.ip, tt.want, got)
+		}
+	}
+	if got := IPPrefix("203.0.113.7", 33, 64); got != "" {
+		t.Fatalf("invalid prefix length: got %q", got)
+	}
+}
+
+func TestDeviceAndIPBinding(t *testing.T) {
+	a := NewAuthToken(testSecret, "salt")
+	token, err := a.GenerateTokenWithClaims(&Claims{
+		UserID:     1,
+		DeviceID:   "device-1",
+		BindDevice: true,
+		IPPrefix:   IPPrefix("203.0.113.7", 24, 64),
+	}, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		binding *Binding
+		want    error
+	}{
+		{"same device and network", &Binding{DeviceID: "device-1", IP: "203.0.113.200"}, nil},
+		{"no binding", nil, ErrTokenBindingMismatch},
+		{"other device", &Binding{DeviceID: "device-2", IP: "203.0.113.7"}, ErrTokenBindingMismatch},
+		{"empty device", &Binding{IP: "203.0.113.7"}, ErrTokenBindingMismatch},
+		{"other network", &Binding{DeviceID: "device-1", IP: "203.0.114.7"}, ErrTokenBindingMismatch},
+		{"invalid ip", &Binding{DeviceID: "device-1", IP: "unknown"}, ErrTokenBindingMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bindings []*Binding
+			if tt.binding != nil {
+				bindings = append(bindings, tt.binding)
+			}
+			if _, err := a.ParseClaims(token, bindings...); !errors.Is(err, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// 没有绑定的token不需要提供绑定信息
+	plain, err := a.GenerateToken(1, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.ParseClaims(plain, &Binding{DeviceID: "any", IP: "198.51.100.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 排查工具离线校验时不检查绑定
+	claims, _, err := a.Inspect(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.ValidateClaims(claims); err != nil {
+		t.Fatalf("ValidateClaims checked the binding: %v", err)
+	}
+}
+
+func TestProofOfPossession(t *testing.T) {
+	clk := clock.NewMockClock(time.Unix(1700000000, 0))
+	a := NewAuthToken(testSecret, "salt", WithClock(clk))
+	other := NewAuthToken(base64.StdEncoding.EncodeToString([]byte("another secret")), "salt", WithClock(clk))
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := NewJWK("", "", &priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbprint, err := pub.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, err := NewJWK("", "", &otherPriv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacKey, err := NewJWK("", AlgHS256, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := a.GenerateTokenWithClaims(&Claims{UserID: 1, KeyThumbprint: thumbprint}, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// proof 用私钥对新的challenge签名
+	proof := func(a *AuthToken, key *JWK, signKey interface{}, alg string) *KeyProof {
+		challenge, err := a.NewChallenge(time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := jwtSign(alg, signKey, []byte(challenge))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &KeyProof{Key: key, Challenge: challenge, Signature: sig}
+	}
+
+	tests := []struct {
+		name  string
+		proof func() *KeyProof
+		want  error
+	}{
+		{"valid", func() *KeyProof { return proof(a, pub, priv, AlgES256) }, nil},
+		{"missing", func() *KeyProof { return nil }, ErrProofRequired},
+		{"other public key", func() *KeyProof { return proof(a, otherPub, otherPriv, AlgES256) }, ErrTokenBindingMismatch},
+		{"signed by other key", func() *KeyProof { return proof(a, pub, otherPriv, AlgES256) }, ErrProofInvalid},
+		{"challenge from other server", func() *KeyProof { return proof(other, pub, priv, AlgES256) }, ErrProofInvalid},
+		{"tampered challenge", func() *KeyProof {
+			p := proof(a, pub, priv, AlgES256)
+			parts := strings.Split(p.Challenge, ".")
+			p.Challenge = parts[0] + ".9999999999." + parts[2]
+			return p
+		}, ErrProofInvalid},
+		{"expired challenge", func() *KeyProof {
+			p := proof(a, pub, priv, AlgES256)
+			clk.Add(2 * time.Minute)
+			return p
+		}, ErrProofInvalid},
+		{"malformed challenge", func() *KeyProof {
+			p := proof(a, pub, priv, AlgES256)
+			p.Challenge = "abc"
+			return p
+		}, ErrProofInvalid},
+		{"wrong signature type", func() *KeyProof { return proof(a, pub, edPriv, AlgEdDSA) }, ErrProofInvalid},
+		{"symmetric key", func() *KeyProof { return &KeyProof{Key: hmacKey} }, ErrTokenBindingMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := a.ParseClaims(token, &Binding{Proof: tt.proof()}); !errors.Is(err, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestProofChallengeSingleUse(t *testing.T) {
+	a := NewAuthToken(testSecret, "salt")
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := NewJWK("", "", &priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbprint, err := pub.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := a.GenerateTokenWithClaims(&Claims{UserID: 1, KeyThumbprint: thumbprint}, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := a.NewChallenge(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := jwtSign(AlgES256, priv, []byte(challenge))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binding := &Binding{Proof: &KeyProof{Key: pub, Challenge: challenge, Signature: sig}}
+
+	if _, err = a.ParseClaims(token, binding); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.ParseClaims(token, binding); !errors.Is(err, ErrProofInvalid) {
+		t.Fatalf("replayed challenge: want ErrProofInvalid, got %v", err)
+	}
+}
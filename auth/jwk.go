@@ -0,0 +1,272 @@
+// @Author Eric
+// @Date 2026/10/18 16:05:00
+// @Desc JWK/JWKS 解析
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+var ErrJWTKeyNotFound = errors.New("jwt key not found")
+
+// JWK 单个JSON Web Key，只保存公钥或对称密钥
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	K   string `json:"k,omitempty"`
+
+	key interface{} // 解析后的密钥: []byte, *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey
+}
+
+// JWKS JSON Web Key Set
+type JWKS struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// JWTKeyResolver 根据kid和算法查找验签密钥
+type JWTKeyResolver interface {
+	ResolveKey(kid, alg string) (interface{}, error)
+}
+
+// ParseJWKS
+//
+//	@Description: 解析JWKS文档，无法识别的key会被跳过
+//	@param data json内容
+//	@return *JWKS
+//	@return error
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := set.Keys[:0]
+	for _, k := range set.Keys {
+		if err := k.parse(); err != nil {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	set.Keys = keys
+	return &set, nil
+}
+
+// ParseJWK 解析单个JWK，例如客户端上报的公钥
+func ParseJWK(data []byte) (*JWK, error) {
+	var k JWK
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, err
+	}
+	if err := k.parse(); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// LoadJWKSFile 从本地文件加载JWKS
+func LoadJWKSFile(path string) (*JWKS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// ResolveKey 实现 JWTKeyResolver
+// 有kid时按kid查找，没有kid时只有一个匹配的key才返回
+func (s *JWKS) ResolveKey(kid, alg string) (interface{}, error) {
+	var found *JWK
+	for _, k := range s.Keys {
+		if kid != "" && k.Kid != kid {
+			continue
+		}
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if k.Alg != "" && k.Alg != alg {
+			continue
+		}
+		if kid == "" && found != nil {
+			return nil, errors.New("jwt kid required when key set has multiple keys")
+		}
+		found = k
+		if kid != "" {
+			break
+		}
+	}
+	if found == nil {
+		return nil, ErrJWTKeyNotFound
+	}
+	return found.key, nil
+}
+
+// Key 返回解析后的密钥
+func (k *JWK) Key() interface{} {
+	return k.key
+}
+
+// Thumbprint
+//
+//	@Description: RFC 7638 计算JWK的SHA-256指纹，只使用必需的字段，和kid、alg等无关
+//	@receiver k
+//	@return string base64url编码
+//	@return error
+func (k *JWK) Thumbprint() (string, error) {
+	// 字段必须按字典序排列，值都是不需要转义的base64url或固定字符串
+	var members string
+	switch k.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Crv, k.X, k.Y)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, k.Crv, k.X)
+	case "oct":
+		members = fmt.Sprintf(`{"k":%q,"kty":"oct"}`, k.K)
+	default:
+		return "", fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return b64url(sum[:]), nil
+}
+
+// NewJWK
+//
+//	@Description: 根据公钥或对称密钥生成JWK，私钥会自动转换为公钥
+//	@param kid
+//	@param alg
+//	@param key
+//	@return *JWK
+//	@return error
+func NewJWK(kid, alg string, key interface{}) (*JWK, error) {
+	k := &JWK{Kid: kid, Alg: alg, Use: "sig"}
+	switch key := publicKeyOf(key).(type) {
+	case []byte:
+		k.Kty = "oct"
+		k.K = b64url(key)
+	case *rsa.PublicKey:
+		k.Kty = "RSA"
+		k.N = b64url(key.N.Bytes())
+		k.E = b64url(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return nil, errors.New("unsupported ec curve")
+		}
+		k.Kty = "EC"
+		k.Crv = "P-256"
+		k.X = b64url(padBytes(key.X.Bytes(), 32))
+		k.Y = b64url(padBytes(key.Y.Bytes(), 32))
+	case ed25519.PublicKey:
+		k.Kty = "OKP"
+		k.Crv = "Ed25519"
+		k.X = b64url(key)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	if err := k.parse(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// parse 把json字段解析成密钥
+func (k *JWK) parse() error {
+	switch k.Kty {
+	case "oct":
+		secret, err := b64urlDecode(k.K)
+		if err != nil || len(secret) == 0 {
+			return errors.New("invalid oct key")
+		}
+		k.key = secret
+	case "RSA":
+		n, err := b64urlDecode(k.N)
+		if err != nil {
+			return err
+		}
+		e, err := b64urlDecode(k.E)
+		if err != nil {
+			return err
+		}
+		eInt := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !eInt.IsInt64() || eInt.Int64() < 3 || eInt.Int64() > 1<<31-1 {
+			return errors.New("invalid rsa key")
+		}
+		k.key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(eInt.Int64())}
+	case "EC":
+		if k.Crv != "P-256" {
+			return errors.New("unsupported ec curve")
+		}
+		x, err := b64urlDecode(k.X)
+		if err != nil {
+			return err
+		}
+		y, err := b64urlDecode(k.Y)
+		if err != nil {
+			return err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return errors.New("invalid ec key")
+		}
+		k.key = pub
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return errors.New("unsupported okp curve")
+		}
+		x, err := b64urlDecode(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return errors.New("invalid ed25519 key")
+		}
+		k.key = ed25519.PublicKey(x)
+	default:
+		return fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+	return nil
+}
+
+// publicKeyOf 私钥转换为对应的公钥，其他类型原样返回
+func publicKeyOf(key interface{}) interface{} {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return &key.PublicKey
+	case *ecdsa.PrivateKey:
+		return &key.PublicKey
+	case ed25519.PrivateKey:
+		return key.Public().(ed25519.PublicKey)
+	}
+	return key
+}
+
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	out := make([]byte, size)
+	copy(out[size-len(b):], b)
+	return out
+}
+
+func b64url(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func b64urlDecode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,463 @@
+// @Author Eric
+// @Date 2026/10/18 16:30:00
+// @Desc JWT 签发和校验，支持 HS256、RS256、ES256、EdDSA
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Kyle91/haven/clock"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// 支持的签名算法
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrJWTMalformed       = errors.New("malformed jwt")
+	ErrJWTAlgorithm       = errors.New("jwt algorithm not allowed")
+	ErrJWTKeyMismatch     = errors.New("jwt key does not match algorithm")
+	ErrJWTSignature       = errors.New("invalid jwt signature")
+	ErrJWTExpired         = errors.New("jwt expired")
+	ErrJWTMissingExpiry   = errors.New("jwt missing exp claim")
+	ErrJWTNotYetValid     = errors.New("jwt not valid yet")
+	ErrJWTIssuedInFuture  = errors.New("jwt issued in the future")
+	ErrJWTInvalidAudience = errors.New("invalid jwt audience")
+	ErrJWTInvalidIssuer   = errors.New("invalid jwt issuer")
+)
+
+// 标准claims字段名，解析时不放入Extra
+var jwtStdClaimNames = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti"}
+
+// JWTHeader JWT头部
+type JWTHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Audience aud 可以是字符串也可以是字符串数组
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multi []string
+	if err := json.Unmarshal(data, &multi); err != nil {
+		return err
+	}
+	*a = multi
+	return nil
+}
+
+// Contains 是否包含指定的aud
+func (a Audience) Contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// JWTClaims JWT中的claims，自定义字段放在Extra中
+type JWTClaims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+
+	Extra map[string]interface{} `json:"-"`
+}
+
+// jwtStdClaims 用于序列化标准字段，避免递归调用 MarshalJSON
+type jwtStdClaims JWTClaims
+
+func (c *JWTClaims) MarshalJSON() ([]byte, error) {
+	std, err := json.Marshal((*jwtStdClaims)(c))
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Extra) == 0 {
+		return std, nil
+	}
+
+	merged := make(map[string]interface{}, len(c.Extra)+len(jwtStdClaimNames))
+	for k, v := range c.Extra {
+		merged[k] = v
+	}
+	var stdMap map[string]interface{}
+	if err = json.Unmarshal(std, &stdMap); err != nil {
+		return nil, err
+	}
+	// 标准字段优先
+	for k, v := range stdMap {
+		merged[k] = v
+	}
+	return json.Marshal(merged)
+}
+
+func (c *JWTClaims) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*jwtStdClaims)(c)); err != nil {
+		return err
+	}
+
+	var all map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&all); err != nil {
+		return err
+	}
+	for _, name := range jwtStdClaimNames {
+		delete(all, name)
+	}
+	if len(all) > 0 {
+		c.Extra = all
+	}
+	return nil
+}
+
+// JWTSigner JWT签发
+type JWTSigner struct {
+	alg string
+	kid string
+	key interface{}
+}
+
+// NewJWTSigner
+//
+//	@Description: 创建JWT签发器
+//	@param alg 签名算法
+//	@param kid 写入header的kid，可以为空
+//	@param key HS256为[]byte，RS256为*rsa.PrivateKey，ES256为*ecdsa.PrivateKey，EdDSA为ed25519.PrivateKey
+//	@return *JWTSigner
+//	@return error
+func NewJWTSigner(alg, kid string, key interface{}) (*JWTSigner, error) {
+	if err := checkSigningKey(alg, key); err != nil {
+		return nil, err
+	}
+	return &JWTSigner{alg: alg, kid: kid, key: key}, nil
+}
+
+// Sign
+//
+//	@Description: 签发JWT
+//	@receiver s
+//	@param claims
+//	@return string
+//	@return error
+func (s *JWTSigner) Sign(claims *JWTClaims) (string, error) {
+	header, err := json.Marshal(&JWTHeader{Alg: s.alg, Typ: "JWT", Kid: s.kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := b64url(header) + "." + b64url(payload)
+	sig, err := jwtSign(s.alg, s.key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + b64url(sig), nil
+}
+
+// JWTVerifier JWT校验
+type JWTVerifier struct {
+	keys       JWTKeyResolver
+	algorithms []string
+	issuer     string
+	audience   string
+	leeway     time.Duration
+	requireExp bool
+	clock      clock.Clock
+}
+
+// JWTVerifyOption JWT校验的可选配置
+type JWTVerifyOption func(*JWTVerifier)
+
+// WithJWTAlgorithms 限制允许的算法，默认允许所有支持的算法
+func WithJWTAlgorithms(algs ...string) JWTVerifyOption {
+	return func(v *JWTVerifier) {
+		v.algorithms = algs
+	}
+}
+
+// WithJWTIssuer 要求iss等于指定值
+func WithJWTIssuer(issuer string) JWTVerifyOption {
+	return func(v *JWTVerifier) {
+		v.issuer = issuer
+	}
+}
+
+// WithJWTAudience 要求aud包含指定值
+func WithJWTAudience(audience string) JWTVerifyOption {
+	return func(v *JWTVerifier) {
+		v.audience = audience
+	}
+}
+
+// WithJWTLeeway 校验exp、nbf、iat时允许的时钟误差
+func WithJWTLeeway(leeway time.Duration) JWTVerifyOption {
+	return func(v *JWTVerifier) {
+		v.leeway = leeway
+	}
+}
+
+// WithJWTClock 设置时钟，默认使用系统时钟
+func WithJWTClock(c clock.Clock) JWTVerifyOption {
+	return func(v *JWTVerifier) {
+		v.clock = c
+	}
+}
+
+// WithJWTOptionalExpiry 允许没有exp的token，默认必须有exp
+func WithJWTOptionalExpiry() JWTVerifyOption {
+	return func(v *JWTVerifier) {
+		v.requireExp = false
+	}
+}
+
+// NewJWTVerifier
+//
+//	@Description: 创建JWT校验器
+//	@param keys 验签密钥，一般为 *JWKS
+//	@param opts
+//	@return *JWTVerifier
+func NewJWTVerifier(keys JWTKeyResolver, opts ...JWTVerifyOption) *JWTVerifier {
+	v := &JWTVerifier{
+		keys:       keys,
+		algorithms: []string{AlgHS256, AlgRS256, AlgES256, AlgEdDSA},
+		requireExp: true,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	v.clock = clock.OrDefault(v.clock)
+	return v
+}
+
+// Verify
+//
+//	@Description: 校验JWT签名和claims
+//	@receiver v
+//	@param token
+//	@return *JWTClaims
+//	@return error
+func (v *JWTVerifier) Verify(token string) (*JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrJWTMalformed
+	}
+
+	headerBytes, err := b64urlDecode(parts[0])
+	if err != nil {
+		return nil, ErrJWTMalformed
+	}
+	var header JWTHeader
+	if err = json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, ErrJWTMalformed
+	}
+
+	// 先校验算法白名单，none以及不支持的算法直接拒绝
+	if !v.allowed(header.Alg) {
+		return nil, ErrJWTAlgorithm
+	}
+
+	key, err := v.keys.ResolveKey(header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	// 密钥类型必须和算法匹配，防止用RSA公钥当HMAC密钥之类的算法混淆攻击
+	if err = checkVerifyKey(header.Alg, key); err != nil {
+		return nil, err
+	}
+
+	sig, err := b64urlDecode(parts[2])
+	if err != nil {
+		return nil, ErrJWTMalformed
+	}
+	if !jwtVerify(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, ErrJWTSignature
+	}
+
+	payload, err := b64urlDecode(parts[1])
+	if err != nil {
+		return nil, ErrJWTMalformed
+	}
+	var claims JWTClaims
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrJWTMalformed
+	}
+
+	if err = v.validateClaims(&claims); err != nil {
+		return &claims, err
+	}
+	return &claims, nil
+}
+
+func (v *JWTVerifier) validateClaims(claims *JWTClaims) error {
+	leeway := int64(v.leeway / time.Second)
+	unix := v.clock.Now().Unix()
+
+	if claims.ExpiresAt == 0 {
+		if v.requireExp {
+			return ErrJWTMissingExpiry
+		}
+	} else if unix > claims.ExpiresAt+leeway {
+		return ErrJWTExpired
+	}
+	if claims.NotBefore != 0 && unix+leeway < claims.NotBefore {
+		return ErrJWTNotYetValid
+	}
+	if claims.IssuedAt != 0 && unix+leeway < claims.IssuedAt {
+		return ErrJWTIssuedInFuture
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return ErrJWTInvalidIssuer
+	}
+	if v.audience != "" && !claims.Audience.Contains(v.audience) {
+		return ErrJWTInvalidAudience
+	}
+	return nil
+}
+
+func (v *JWTVerifier) allowed(alg string) bool {
+	for _, a := range v.algorithms {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSigningKey 校验签名私钥和算法是否匹配
+func checkSigningKey(alg string, key interface{}) error {
+	switch alg {
+	case AlgHS256:
+		if k, ok := key.([]byte); ok && len(k) > 0 {
+			return nil
+		}
+	case AlgRS256:
+		if _, ok := key.(*rsa.PrivateKey); ok {
+			return nil
+		}
+	case AlgES256:
+		if k, ok := key.(*ecdsa.PrivateKey); ok && k.Curve == elliptic.P256() {
+			return nil
+		}
+	case AlgEdDSA:
+		if k, ok := key.(ed25519.PrivateKey); ok && len(k) == ed25519.PrivateKeySize {
+			return nil
+		}
+	default:
+		return ErrJWTAlgorithm
+	}
+	return ErrJWTKeyMismatch
+}
+
+// checkVerifyKey 校验验签公钥和算法是否匹配
+func checkVerifyKey(alg string, key interface{}) error {
+	switch alg {
+	case AlgHS256:
+		if k, ok := key.([]byte); ok && len(k) > 0 {
+			return nil
+		}
+	case AlgRS256:
+		if _, ok := key.(*rsa.PublicKey); ok {
+			return nil
+		}
+	case AlgES256:
+		if k, ok := key.(*ecdsa.PublicKey); ok && k.Curve == elliptic.P256() {
+			return nil
+		}
+	case AlgEdDSA:
+		if k, ok := key.(ed25519.PublicKey); ok && len(k) == ed25519.PublicKeySize {
+			return nil
+		}
+	default:
+		return ErrJWTAlgorithm
+	}
+	return ErrJWTKeyMismatch
+}
+
+func jwtSign(alg string, key interface{}, data []byte) ([]byte, error) {
+	switch alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write(data)
+		return mac.Sum(nil), nil
+	case AlgRS256:
+		digest := sha256.Sum256(data)
+		return rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+	case AlgES256:
+		digest := sha256.Sum256(data)
+		r, s, err := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// JWS 要求 r||s 定长拼接，而不是ASN.1格式
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	case AlgEdDSA:
+		return ed25519.Sign(key.(ed25519.PrivateKey), data), nil
+	}
+	return nil, fmt.Errorf("unsupported jwt algorithm %s", alg)
+}
+
+func jwtVerify(alg string, key interface{}, data, sig []byte) bool {
+	switch alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write(data)
+		return hmac.Equal(sig, mac.Sum(nil))
+	case AlgRS256:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], sig) == nil
+	case AlgES256:
+		if len(sig) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(data)
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(key.(*ecdsa.PublicKey), digest[:], r, s)
+	case AlgEdDSA:
+		return ed25519.Verify(key.(ed25519.PublicKey), data, sig)
+	}
+	return false
+}
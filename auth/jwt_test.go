@@ -0,0 +1,240 @@
+// @Author Eric
+// @Date 2026/10/29 10:30:00
+// @Desc JWT 签发和校验的测试
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"github.com/Kyle91/haven/clock"
+	"testing"
+	"time"
+)
+
+// staticKey 不检查kid和算法，总是返回同一个key，用于模拟配置错误的密钥来源
+type staticKey struct {
+	key interface{}
+}
+
+func (s staticKey) ResolveKey(kid, alg string) (interface{}, error) {
+	return s.key, nil
+}
+
+var jwtTestNow = time.Unix(1700000000, 0)
+
+func TestJWTSignVerifyAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		alg string
+		key interface{}
+	}{
+		{AlgHS256, []byte("secret")},
+		{AlgRS256, rsaKey},
+		{AlgES256, ecKey},
+		{AlgEdDSA, edKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			signer, err := NewJWTSigner(tt.alg, "k1", tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			jwk, err := NewJWK("k1", tt.alg, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := signer.Sign(&JWTClaims{
+				Subject:   "42",
+				ExpiresAt: jwtTestNow.Add(time.Hour).Unix(),
+				Extra:     map[string]interface{}{"role": "admin"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v := NewJWTVerifier(&JWKS{Keys: []*JWK{jwk}}, WithJWTClock(clock.NewMockClock(jwtTestNow)))
+			claims, err := v.Verify(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "42" || claims.Extra["role"] != "admin" {
+				t.Fatalf("unexpected claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestJWTValidateClaims(t *testing.T) {
+	key := []byte("secret")
+	signer, err := NewJWTSigner(AlgHS256, "", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := NewJWK("", AlgHS256, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := &JWKS{Keys: []*JWK{jwk}}
+	now := jwtTestNow.Unix()
+
+	tests := []struct {
+		name   string
+		claims JWTClaims
+		opts   []JWTVerifyOption
+		want   error
+	}{
+		{"valid", JWTClaims{ExpiresAt: now + 60}, nil, nil},
+		{"expired", JWTClaims{ExpiresAt: now - 1}, nil, ErrJWTExpired},
+		{"expired within leeway", JWTClaims{ExpiresAt: now - 5}, []JWTVerifyOption{WithJWTLeeway(10 * time.Second)}, nil},
+		{"missing exp", JWTClaims{}, nil, ErrJWTMissingExpiry},
+		{"optional exp", JWTClaims{}, []JWTVerifyOption{WithJWTOptionalExpiry()}, nil},
+		{"not yet valid", JWTClaims{ExpiresAt: now + 60, NotBefore: now + 30}, nil, ErrJWTNotYetValid},
+		{"issued in future", JWTClaims{ExpiresAt: now + 60, IssuedAt: now + 30}, nil, ErrJWTIssuedInFuture},
+		{"wrong issuer", JWTClaims{ExpiresAt: now + 60, Issuer: "other"}, []JWTVerifyOption{WithJWTIssuer("haven")}, ErrJWTInvalidIssuer},
+		{"right audience", JWTClaims{ExpiresAt: now + 60, Audience: Audience{"a", "game"}}, []JWTVerifyOption{WithJWTAudience("game")}, nil},
+		{"wrong audience", JWTClaims{ExpiresAt: now + 60, Audience: Audience{"web"}}, []JWTVerifyOption{WithJWTAudience("game")}, ErrJWTInvalidAudience},
+		{"missing audience", JWTClaims{ExpiresAt: now + 60}, []JWTVerifyOption{WithJWTAudience("game")}, ErrJWTInvalidAudience},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := signer.Sign(&tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := append([]JWTVerifyOption{WithJWTClock(clock.NewMockClock(jwtTestNow))}, tt.opts...)
+			if _, err = NewJWTVerifier(keys, opts...).Verify(token); !errors.Is(err, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// hs256Token 用任意字节作为HMAC密钥手工构造token
+func hs256Token(t *testing.T, header, claims interface{}, key []byte) string {
+	t.Helper()
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := b64url(h) + "." + b64url(c)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(input))
+	return input + "." + b64url(mac.Sum(nil))
+}
+
+func TestJWTRejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := &JWTClaims{Subject: "42", ExpiresAt: jwtTestNow.Add(time.Hour).Unix()}
+	now := WithJWTClock(clock.NewMockClock(jwtTestNow))
+
+	// 用RSA公钥作为HMAC密钥签名，密钥来源不区分算法时也必须拒绝
+	forged := hs256Token(t, &JWTHeader{Alg: AlgHS256}, claims, pub)
+	if _, err = NewJWTVerifier(staticKey{&rsaKey.PublicKey}, now).Verify(forged); !errors.Is(err, ErrJWTKeyMismatch) {
+		t.Fatalf("hs256 with rsa key: want ErrJWTKeyMismatch, got %v", err)
+	}
+
+	// JWK声明了RS256时，HS256的token找不到key
+	jwk, err := NewJWK("k1", AlgRS256, rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged = hs256Token(t, &JWTHeader{Alg: AlgHS256, Kid: "k1"}, claims, pub)
+	if _, err = NewJWTVerifier(&JWKS{Keys: []*JWK{jwk}}, now).Verify(forged); !errors.Is(err, ErrJWTKeyNotFound) {
+		t.Fatalf("hs256 against rs256 jwk: want ErrJWTKeyNotFound, got %v", err)
+	}
+
+	// 算法白名单
+	signer, err := NewJWTSigner(AlgRS256, "k1", rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := signer.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewJWTVerifier(&JWKS{Keys: []*JWK{jwk}}, now, WithJWTAlgorithms(AlgES256))
+	if _, err = v.Verify(token); !errors.Is(err, ErrJWTAlgorithm) {
+		t.Fatalf("alg not in allow list: want ErrJWTAlgorithm, got %v", err)
+	}
+}
+
+func TestJWTRejectsNoneAndTampering(t *testing.T) {
+	key := []byte("secret")
+	jwk, err := NewJWK("", AlgHS256, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := NewJWTVerifier(&JWKS{Keys: []*JWK{jwk}}, WithJWTClock(clock.NewMockClock(jwtTestNow)))
+	claims := &JWTClaims{Subject: "42", ExpiresAt: jwtTestNow.Add(time.Hour).Unix()}
+
+	h, _ := json.Marshal(&JWTHeader{Alg: "none"})
+	c, _ := json.Marshal(claims)
+	if _, err = v.Verify(b64url(h) + "." + b64url(c) + "."); !errors.Is(err, ErrJWTAlgorithm) {
+		t.Fatalf("alg none: want ErrJWTAlgorithm, got %v", err)
+	}
+
+	token := hs256Token(t, &JWTHeader{Alg: AlgHS256}, claims, key)
+	if _, err = v.Verify(token); err != nil {
+		t.Fatal(err)
+	}
+	tampered := hs256Token(t, &JWTHeader{Alg: AlgHS256}, &JWTClaims{Subject: "1", ExpiresAt: claims.ExpiresAt}, []byte("other"))
+	if _, err = v.Verify(tampered); !errors.Is(err, ErrJWTSignature) {
+		t.Fatalf("wrong key: want ErrJWTSignature, got %v", err)
+	}
+	for _, malformed := range []string{"", "a.b", "a.b.c.d", "!!.e30.sig"} {
+		if _, err = v.Verify(malformed); !errors.Is(err, ErrJWTMalformed) {
+			t.Fatalf("%q: want ErrJWTMalformed, got %v", malformed, err)
+		}
+	}
+}
+
+func TestJWKThumbprintRFC7638(t *testing.T) {
+	// RFC 7638 3.1 的示例
+	k := &JWK{
+		Kty: "RSA",
+		E:   "AQAB",
+		N: "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECP" +
+			"ebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2Qvzq" +
+			"Y368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0f" +
+			"M4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		Kid: "2011-04-29",
+	}
+	got, err := k.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+}
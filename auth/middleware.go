@@ -0,0 +1,214 @@
+// @Author Eric
+// @Date 2026/10/20 10:10:00
+// @Desc fasthttp 鉴权中间件
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Kyle91/haven/common"
+	"github.com/Kyle91/haven/log"
+	"github.com/valyala/fasthttp"
+	"net/netip"
+	"strings"
+)
+
+// claimsUserValueKey 保存在 RequestCtx 中的claims的key
+const claimsUserValueKey = "haven.auth.claims"
+
+// MiddlewareOptions 中间件配置，按 Header、Cookie、Query 的顺序查找token
+type MiddlewareOptions struct {
+	Header   string // 读取token的header，默认 Authorization，需要 Bearer 前缀，其他header可以省略
+	Cookie   string // 读取token的cookie名，为空则不读取
+	Query    string // 读取token的query参数名，为空则不读取
+	Optional bool   // 没有token时是否放行，有token但校验失败仍然拒绝
+
+	// ClientIP 获取客户端IP，默认使用连接的对端地址
+	// 在反向代理或负载均衡后面时对端地址是代理的地址，绑定了IP的token都会校验失败，需要设置为 ProxyClientIP
+	ClientIP func(ctx *fasthttp.RequestCtx) string
+	// Binding 获取当前请求的绑定信息，用于校验绑定了设备或公钥的token，默认只提供 ClientIP
+	Binding func(ctx *fasthttp.RequestCtx) *Binding
+}
+
+// ErrorResponse 失败时返回的数据
+type ErrorResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// Middleware
+//
+//	@Description: 创建鉴权中间件，校验通过后claims保存在 RequestCtx 中，通过 ClaimsFromContext 获取
+//	@receiver a
+//	@param opts
+//	@return func(fasthttp.RequestHandler) fasthttp.RequestHandler
+func (a *AuthToken) Middleware(opts MiddlewareOptions) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	if opts.Header == "" {
+		opts.Header = fasthttp.HeaderAuthorization
+	}
+	if opts.ClientIP == nil {
+		opts.ClientIP = func(ctx *fasthttp.RequestCtx) string {
+			return ctx.RemoteIP().String()
+		}
+	}
+	if opts.Binding == nil {
+		clientIP := opts.ClientIP
+		opts.Binding = func(ctx *fasthttp.RequestCtx) *Binding {
+			return &Binding{IP: clientIP(ctx)}
+		}
+	}
+
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			token := extractToken(ctx, &opts)
+			if token == "" {
+				if opts.Optional {
+					next(ctx)
+					return
+				}
+				WriteError(ctx, fasthttp.StatusUnauthorized, common.InvalidToken)
+				return
+			}
+
+			claims, err := a.ParseClaims(token, opts.Binding(ctx))
+			if err != nil {
+				// 存储出错时返回503，客户端可以重试，不应该当作token无效而退出登录
+				if errors.Is(err, ErrStoreUnavailable) {
+					log.Errorf("auth middleware: %v", err)
+					WriteError(ctx, fasthttp.StatusServiceUnavailable, common.Unavailable)
+					return
+				}
+				WriteError(ctx, fasthttp.StatusUnauthorized, tokenErrorCode(err))
+				return
+			}
+
+			ctx.SetUserValue(claimsUserValueKey, claims)
+			next(ctx)
+		}
+	}
+}
+
+// ProxyClientIP
+//
+//	@Description: 在反向代理后面获取客户端IP，只有对端地址是受信任的代理时才读取 X-Forwarded-For 和 X-Real-IP，
+//	从 X-Forwarded-For 的最右边开始跳过受信任的代理，第一个不受信任的地址就是客户端，避免客户端伪造header
+//	@param trusted 受信任的代理，IP或CIDR，例如 "10.0.0.0/8"、"127.0.0.1"
+//	@return func(ctx *fasthttp.RequestCtx) string 用于 MiddlewareOptions.ClientIP
+//	@return error 地址格式错误
+func ProxyClientIP(trusted ...string) (func(ctx *fasthttp.RequestCtx) string, error) {
+	prefixes := make([]netip.Prefix, 0, len(trusted))
+	for _, t := range trusted {
+		if strings.Contains(t, "/") {
+			p, err := netip.ParsePrefix(t)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(t)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	isTrusted := func(ip string) bool {
+		addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		for _, p := range prefixes {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(ctx *fasthttp.RequestCtx) string {
+		remote := ctx.RemoteIP().String()
+		if !isTrusted(remote) {
+			return remote
+		}
+		if xff := string(ctx.Request.Header.Peek(fasthttp.HeaderXForwardedFor)); xff != "" {
+			hops := strings.Split(xff, ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop := strings.TrimSpace(hops[i])
+				if !isTrusted(hop) {
+					return hop
+				}
+			}
+			// 全部是受信任的代理时取最左边的
+			return strings.TrimSpace(hops[0])
+		}
+		if realIP := strings.TrimSpace(string(ctx.Request.Header.Peek("X-Real-IP"))); realIP != "" {
+			return realIP
+		}
+		return remote
+	}, nil
+}
+
+// ClaimsFromContext 获取中间件保存的claims
+func ClaimsFromContext(ctx *fasthttp.RequestCtx) (*Claims, bool) {
+	claims, ok := ctx.UserValue(claimsUserValueKey).(*Claims)
+	return claims, ok
+}
+
+// WriteError
+//
+//	@Description: 以json格式返回错误码和错误信息
+//	@param ctx
+//	@param status http状态码
+//	@param code common中定义的错误码
+func WriteError(ctx *fasthttp.RequestCtx, status, code int) {
+	body, _ := json.Marshal(&ErrorResponse{Code: code, Msg: common.GetErrorMessage(code)})
+	ctx.SetStatusCode(status)
+	ctx.SetContentType("application/json")
+	ctx.SetBody(body)
+}
+
+// extractToken 按 Header、Cookie、Query 的顺序查找token
+func extractToken(ctx *fasthttp.RequestCtx, opts *MiddlewareOptions) string {
+	if v := headerToken(string(ctx.Request.Header.Peek(opts.Header)), opts.Header); v != "" {
+		return v
+	}
+	if opts.Cookie != "" {
+		if v := ctx.Request.Header.Cookie(opts.Cookie); len(v) > 0 {
+			return string(v)
+		}
+	}
+	if opts.Query != "" {
+		if v := ctx.QueryArgs().Peek(opts.Query); len(v) > 0 {
+			return string(v)
+		}
+	}
+	return ""
+}
+
+// headerToken 从header的值中取出token，Authorization 头必须是 "Bearer <token>"，其他header可以省略前缀
+// 只有 "Bearer" 没有token或者是其他认证方式时返回空，当作没有token
+func headerToken(v, header string) string {
+	v = strings.TrimSpace(v)
+	if scheme, token, ok := strings.Cut(v, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	if strings.EqualFold(v, "Bearer") || strings.EqualFold(header, fasthttp.HeaderAuthorization) {
+		return ""
+	}
+	return v
+}
+
+// tokenErrorCode token校验错误对应的错误码
+func tokenErrorCode(err error) int {
+	var codeErr *common.Error
+	switch {
+	case errors.As(err, &codeErr):
+		return codeErr.Code
+	case errors.Is(err, ErrTokenRevoked), errors.Is(err, ErrTokenBindingMismatch),
+		errors.Is(err, ErrProofRequired), errors.Is(err, ErrProofInvalid):
+		return common.AuthFailed
+	default:
+		return common.InvalidToken
+	}
+}
@@ -0,0 +1,182 @@
+// @Author Eric
+// @Date 2026/10/29 14:00:00
+// @Desc 鉴权中间件的测试
+package auth
+
+import (
+	"errors"
+	"github.com/Kyle91/haven/common"
+	"github.com/valyala/fasthttp"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// brokenRevocationStore 模拟后端不可用的吊销列表
+type brokenRevocationStore struct {
+	*MemoryRevocationStore
+}
+
+func (brokenRevocationStore) IsRevoked(claims *Claims) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func newTestCtx(remote, token string, headers map[string]string) *fasthttp.RequestCtx {
+	var req fasthttp.Request
+	req.SetRequestURI("/api")
+	if token != "" {
+		req.Header.Set(fasthttp.HeaderAuthorization, "Bearer "+token)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(&req, &net.TCPAddr{IP: net.ParseIP(remote), Port: 1234}, nil)
+	return ctx
+}
+
+func TestMiddlewareStatus(t *testing.T) {
+	store := NewMemoryRevocationStore(time.Hour)
+	a := NewAuthToken(testSecret, "salt", WithRevocation(store))
+	valid, err := a.GenerateToken(1, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := a.GenerateToken(2, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Logout(revoked); err != nil {
+		t.Fatal(err)
+	}
+	broken := NewAuthToken(testSecret, "salt", WithRevocation(brokenRevocationStore{NewMemoryRevocationStore(time.Hour)}))
+
+	tests := []struct {
+		name   string
+		auth   *AuthToken
+		token  string
+		status int
+		code   int
+	}{
+		{"missing", a, "", fasthttp.StatusUnauthorized, common.InvalidToken},
+		{"garbage", a, "abcd", fasthttp.StatusUnauthorized, common.InvalidToken},
+		{"bearer without token", a, " ", fasthttp.StatusUnauthorized, common.InvalidToken},
+		{"valid", a, valid, fasthttp.StatusOK, 0},
+		{"revoked", a, revoked, fasthttp.StatusUnauthorized, common.AuthFailed},
+		{"store unavailable", broken, valid, fasthttp.StatusServiceUnavailable, common.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := tt.auth.Middleware(MiddlewareOptions{})(func(ctx *fasthttp.RequestCtx) {
+				if _, ok := ClaimsFromContext(ctx); !ok {
+					t.Fatal("claims not set")
+				}
+			})
+			ctx := newTestCtx("1.2.3.4", tt.token, nil)
+			handler(ctx)
+			if got := ctx.Response.StatusCode(); got != tt.status {
+				t.Fatalf("want status %d, got %d: %s", tt.status, got, ctx.Response.Body())
+			}
+			if tt.code != 0 {
+				want := `"code":` + strconv.Itoa(tt.code)
+				if body := string(ctx.Response.Body()); !strings.Contains(body, want) {
+					t.Fatalf("want %s in %s", want, body)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareIPBindingBehindProxy(t *testing.T) {
+	a := NewAuthToken(testSecret, "salt")
+	token, err := a.GenerateTokenWithClaims(&Claims{UserID: 1, IPPrefix: IPPrefix("203.0.113.7", 24, 64)}, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientIP, err := ProxyClientIP("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forwarded := map[string]string{fasthttp.HeaderXForwardedFor: "203.0.113.7"}
+
+	tests := []struct {
+		name   string
+		opts   MiddlewareOptions
+		remote string
+		status int
+	}{
+		{"direct", MiddlewareOptions{}, "203.0.113.7", fasthttp.StatusOK},
+		{"proxy without extractor", MiddlewareOptions{}, "10.0.0.2", fasthttp.StatusUnauthorized},
+		{"proxy with extractor", MiddlewareOptions{ClientIP: clientIP}, "10.0.0.2", fasthttp.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newTestCtx(tt.remote, token, forwarded)
+			a.Middleware(tt.opts)(func(ctx *fasthttp.RequestCtx) {})(ctx)
+			if got := ctx.Response.StatusCode(); got != tt.status {
+				t.Fatalf("want status %d, got %d", tt.status, got)
+			}
+		})
+	}
+}
+
+func TestProxyClientIP(t *testing.T) {
+	clientIP, err := ProxyClientIP("10.0.0.0/8", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"untrusted remote ignores header", "198.51.100.1", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "198.51.100.1"},
+		{"trusted remote", "10.0.0.2", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "1.1.1.1"},
+		{"spoofed left entry", "10.0.0.2", map[string]string{"X-Forwarded-For": "9.9.9.9, 1.1.1.1, 10.0.0.3"}, "1.1.1.1"},
+		{"x-real-ip", "127.0.0.1", map[string]string{"X-Real-IP": "2.2.2.2"}, "2.2.2.2"},
+		{"no header", "127.0.0.1", nil, "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clientIP(newTestCtx(tt.remote, "", tt.headers)); got != tt.want {
+				t.Fatalf("want %s, got %s", tt.want, got)
+			}
+		})
+	}
+	if _, err = ProxyClientIP("not an ip"); err == nil {
+		t.Fatal("expected error for invalid address")
+	}
+}
+
+func TestExtractToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    MiddlewareOptions
+		headers map[string]string
+		want    string
+	}{
+		{"bearer", MiddlewareOptions{}, map[string]string{"Authorization": "Bearer abc"}, "abc"},
+		{"scheme case", MiddlewareOptions{}, map[string]string{"Authorization": "bearer  abc "}, "abc"},
+		{"bearer without token", MiddlewareOptions{}, map[string]string{"Authorization": "Bearer"}, ""},
+		{"bearer with spaces only", MiddlewareOptions{}, map[string]string{"Authorization": "Bearer   "}, ""},
+		{"missing scheme", MiddlewareOptions{}, map[string]string{"Authorization": "abc"}, ""},
+		{"other scheme", MiddlewareOptions{}, map[string]string{"Authorization": "Basic YTpi"}, ""},
+		{"other scheme falls back to cookie", MiddlewareOptions{Cookie: "token"}, map[string]string{"Authorization": "Basic YTpi", "Cookie": "token=abc"}, "abc"},
+		{"custom header without scheme", MiddlewareOptions{Header: "X-Token"}, map[string]string{"X-Token": "abc"}, "abc"},
+		{"custom header with scheme", MiddlewareOptions{Header: "X-Token"}, map[string]string{"X-Token": "Bearer abc"}, "abc"},
+		{"custom header bearer only", MiddlewareOptions{Header: "X-Token"}, map[string]string{"X-Token": "Bearer"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.opts.Header == "" {
+				tt.opts.Header = fasthttp.HeaderAuthorization
+			}
+			if got := extractToken(newTestCtx("1.2.3.4", "", tt.headers), &tt.opts); got != tt.want {
+				t.Fatalf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
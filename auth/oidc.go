@@ -0,0 +1,386 @@
+// @Author Eric
+// @Date 2026/10/24 10:00:00
+// @Desc 第三方登录，校验OpenID Connect的ID Token，映射到内部用户ID后换取 AuthToken
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Kyle91/haven/clock"
+	havenhttp "github.com/Kyle91/haven/http"
+	"github.com/Kyle91/haven/log"
+	"sync"
+	"time"
+)
+
+var (
+	ErrOIDCNonceRequired     = errors.New("oidc nonce required")
+	ErrOIDCNonceMismatch     = errors.New("oidc nonce mismatch")
+	ErrOIDCInvalidAzp        = errors.New("invalid oidc authorized party")
+	ErrOIDCMissingSubject    = errors.New("oidc token missing subject")
+	ErrOIDCIdentityNotLinked = errors.New("oidc identity not linked to any user")
+)
+
+// RemoteJWKSOptions 远程JWKS配置
+type RemoteJWKSOptions struct {
+	RefreshInterval    time.Duration // 定期刷新间隔，默认1小时
+	MinRefreshInterval time.Duration // 遇到未知kid时强制刷新的最小间隔，防止被伪造的kid打满，默认1分钟
+	Timeout            time.Duration // 获取JWKS的超时时间，默认10秒
+	UserAgent          string
+	Clock              clock.Clock
+}
+
+// RemoteJWKS 通过http获取并缓存的JWKS，实现 JWTKeyResolver
+// 第三方轮换密钥后，遇到未知的kid会重新获取一次
+type RemoteJWKS struct {
+	url  string
+	opts RemoteJWKSOptions
+
+	mu        sync.Mutex
+	keys      *JWKS
+	fetchedAt time.Time
+	inflight  *jwksCall // 正在进行的获取，同一时间只有一个请求
+}
+
+// jwksCall 一次获取，其他调用方等待done后读取结果
+type jwksCall struct {
+	done chan struct{}
+	err  error
+}
+
+// NewRemoteJWKS
+//
+//	@Description: 创建远程JWKS，第一次使用时才会获取
+//	@param url jwks_uri
+//	@param opts
+//	@return *RemoteJWKS
+func NewRemoteJWKS(url string, opts RemoteJWKSOptions) *RemoteJWKS {
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = time.Hour
+	}
+	if opts.MinRefreshInterval <= 0 {
+		opts.MinRefreshInterval = time.Minute
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = "haven"
+	}
+	opts.Clock = clock.OrDefault(opts.Clock)
+	return &RemoteJWKS{url: url, opts: opts}
+}
+
+// ResolveKey 实现 JWTKeyResolver
+func (r *RemoteJWKS) ResolveKey(kid, alg string) (interface{}, error) {
+	now := r.opts.Clock.Now()
+	keys, err := r.refresh(now, r.opts.RefreshInterval)
+	// 获取失败时继续使用原来的缓存
+	if keys == nil {
+		return nil, err
+	}
+
+	key, err := keys.ResolveKey(kid, alg)
+	if errors.Is(err, ErrJWTKeyNotFound) {
+		if latest, rerr := r.refresh(now, r.opts.MinRefreshInterval); rerr == nil && latest != keys {
+			key, err = latest.ResolveKey(kid, alg)
+		}
+	}
+	return key, err
+}
+
+// Refresh 立即重新获取
+func (r *RemoteJWKS) Refresh() error {
+	_, err := r.refresh(r.opts.Clock.Now(), 0)
+	return err
+}
+
+// refresh
+//
+//	@Description: 缓存的时间超过maxAge时重新获取，并发调用只会发出一个请求，
+//	http请求在锁外进行，不会阻塞其他使用缓存的调用方
+//	@receiver r
+//	@param now
+//	@param maxAge
+//	@return *JWKS 当前的缓存，获取失败时为原来的缓存
+//	@return error 获取失败的原因
+func (r *RemoteJWKS) refresh(now time.Time, maxAge time.Duration) (*JWKS, error) {
+	r.mu.Lock()
+	call := r.inflight
+	if call == nil {
+		if r.keys != nil && now.Sub(r.fetchedAt) < maxAge {
+			keys := r.keys
+			r.mu.Unlock()
+			return keys, nil
+		}
+		call = &jwksCall{done: make(chan struct{})}
+		r.inflight = call
+		// 失败也更新时间，避免每次请求都去获取
+		r.fetchedAt = now
+		r.mu.Unlock()
+
+		keys, err := r.fetch()
+		r.mu.Lock()
+		if err == nil {
+			r.keys = keys
+		}
+		call.err = err
+		r.inflight = nil
+		r.mu.Unlock()
+		close(call.done)
+	} else {
+		r.mu.Unlock()
+		<-call.done
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.keys, call.err
+}
+
+// fetch 获取并解析JWKS
+func (r *RemoteJWKS) fetch() (*JWKS, error) {
+	body, err := havenhttp.GetRequestTimeout(r.url, r.opts.UserAgent, r.opts.Timeout)
+	if err != nil {
+		log.Warnf("fetch jwks %s failed: %v", r.url, err)
+		return nil, err
+	}
+	keys, err := ParseJWKS(body)
+	if err != nil {
+		log.Warnf("parse jwks %s failed: %v", r.url, err)
+		return nil, err
+	}
+	if len(keys.Keys) == 0 {
+		log.Warnf("jwks %s has no usable keys", r.url)
+		return nil, fmt.Errorf("jwks %s has no usable keys", r.url)
+	}
+	return keys, nil
+}
+
+// OIDCOptions 单个第三方登录的配置
+type OIDCOptions struct {
+	Issuer     string         // iss，例如 https://accounts.google.com
+	ClientID   string         // 我们在第三方注册的client_id，ID Token的aud必须包含它
+	Keys       JWTKeyResolver // 验签密钥，NewRemoteJWKS 或 LoadJWKSFile
+	Algorithms []string       // 允许的算法，默认 RS256、ES256
+	Leeway     time.Duration
+	Clock      clock.Clock
+}
+
+// OIDCIdentity 校验通过的第三方身份
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string // 第三方的用户ID，和Issuer一起唯一确定一个身份
+	Email         string
+	EmailVerified bool
+	Name          string
+	Claims        *JWTClaims
+}
+
+// OIDCVerifier ID Token校验
+type OIDCVerifier struct {
+	opts     OIDCOptions
+	verifier *JWTVerifier
+}
+
+// NewOIDCVerifier
+//
+//	@Description: 创建ID Token校验器
+//	@param opts
+//	@return *OIDCVerifier
+//	@return error
+func NewOIDCVerifier(opts OIDCOptions) (*OIDCVerifier, error) {
+	if opts.Issuer == "" || opts.ClientID == "" || opts.Keys == nil {
+		return nil, errors.New("oidc issuer, client id and keys are required")
+	}
+	if len(opts.Algorithms) == 0 {
+		opts.Algorithms = []string{AlgRS256, AlgES256}
+	}
+	return &OIDCVerifier{
+		opts: opts,
+		verifier: NewJWTVerifier(opts.Keys,
+			WithJWTAlgorithms(opts.Algorithms...),
+			WithJWTIssuer(opts.Issuer),
+			WithJWTAudience(opts.ClientID),
+			WithJWTLeeway(opts.Leeway),
+			WithJWTClock(opts.Clock),
+		),
+	}, nil
+}
+
+// Issuer 第三方的iss
+func (v *OIDCVerifier) Issuer() string {
+	return v.opts.Issuer
+}
+
+// Verify
+//
+//	@Description: 校验ID Token的签名、iss、aud、exp和nonce
+//	@receiver v
+//	@param idToken
+//	@param nonce 发起登录时生成的nonce，不能为空，为空时返回 ErrOIDCNonceRequired
+//	@return *OIDCIdentity
+//	@return error
+func (v *OIDCVerifier) Verify(idToken, nonce string) (*OIDCIdentity, error) {
+	if nonce == "" {
+		return nil, ErrOIDCNonceRequired
+	}
+	return v.verify(idToken, nonce)
+}
+
+// VerifyNoNonce 校验ID Token但不校验nonce，只用于无法传递nonce的登录方式(例如部分客户端SDK)，
+// 这种情况下ID Token被截获后可以重放，调用方需要自行承担风险
+func (v *OIDCVerifier) VerifyNoNonce(idToken string) (*OIDCIdentity, error) {
+	return v.verify(idToken, "")
+}
+
+// verify nonce为空时不校验nonce
+func (v *OIDCVerifier) verify(idToken, nonce string) (*OIDCIdentity, error) {
+	claims, err := v.verifier.Verify(idToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, ErrOIDCMissingSubject
+	}
+
+	// 有多个aud时，azp必须是我们自己
+	azp, _ := claims.Extra["azp"].(string)
+	if (len(claims.Audience) > 1 || azp != "") && azp != v.opts.ClientID {
+		return nil, ErrOIDCInvalidAzp
+	}
+
+	if nonce != "" {
+		if got, _ := claims.Extra["nonce"].(string); got != nonce {
+			return nil, ErrOIDCNonceMismatch
+		}
+	}
+
+	identity := &OIDCIdentity{Issuer: claims.Issuer, Subject: claims.Subject, Claims: claims}
+	identity.Email, _ = claims.Extra["email"].(string)
+	identity.Name, _ = claims.Extra["name"].(string)
+	// 部分第三方的email_verified是字符串
+	switch ev := claims.Extra["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = ev
+	case string:
+		identity.EmailVerified = ev == "true"
+	}
+	return identity, nil
+}
+
+// IdentityStore 第三方身份和内部用户ID的映射
+type IdentityStore interface {
+	// Lookup 查找身份对应的用户ID
+	Lookup(issuer, subject string) (int64, bool, error)
+	// Link 绑定身份和用户ID
+	Link(issuer, subject string, userID int64) error
+}
+
+// MemoryIdentityStore 内存实现，一般只用于测试
+type MemoryIdentityStore struct {
+	mu    sync.RWMutex
+	users map[string]int64
+}
+
+// NewMemoryIdentityStore 创建内存身份映射
+func NewMemoryIdentityStore() *MemoryIdentityStore {
+	return &MemoryIdentityStore{users: make(map[string]int64)}
+}
+
+func (s *MemoryIdentityStore) Lookup(issuer, subject string) (int64, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	userID, ok := s.users[issuer+"|"+subject]
+	return userID, ok, nil
+}
+
+func (s *MemoryIdentityStore) Link(issuer, subject string, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[issuer+"|"+subject] = userID
+	return nil
+}
+
+// OIDCExchangeOptions 换取 AuthToken 的配置
+type OIDCExchangeOptions struct {
+	Identities IdentityStore
+	TTL        int64 // AuthToken 有效期(秒)，必须大于0
+	// Register 身份还没有绑定用户时调用，返回新建的用户ID，为nil时返回 ErrOIDCIdentityNotLinked
+	Register func(identity *OIDCIdentity) (int64, error)
+}
+
+// OIDCExchanger 用第三方的ID Token换取 AuthToken
+type OIDCExchanger struct {
+	auth *AuthToken
+	opts OIDCExchangeOptions
+}
+
+// NewOIDCExchanger
+//
+//	@Description: 创建换取器，多个第三方可以共用
+//	@param auth
+//	@param opts
+//	@return *OIDCExchanger
+//	@return error TTL小于等于0时返回错误
+func NewOIDCExchanger(auth *AuthToken, opts OIDCExchangeOptions) (*OIDCExchanger, error) {
+	if opts.TTL <= 0 {
+		return nil, errors.New("oidc exchange ttl must be positive")
+	}
+	if opts.Identities == nil {
+		opts.Identities = NewMemoryIdentityStore()
+	}
+	return &OIDCExchanger{auth: auth, opts: opts}, nil
+}
+
+// Exchange
+//
+//	@Description: 校验ID Token，找到或创建对应的用户，签发 AuthToken
+//	@receiver e
+//	@param verifier 对应第三方的校验器
+//	@param idToken
+//	@param nonce 发起登录时生成的nonce，见 OIDCVerifier.Verify
+//	@return string AuthToken
+//	@return *OIDCIdentity
+//	@return error
+func (e *OIDCExchanger) Exchange(verifier *OIDCVerifier, idToken, nonce string) (string, *OIDCIdentity, error) {
+	identity, err := verifier.Verify(idToken, nonce)
+	if err != nil {
+		return "", nil, err
+	}
+	return e.exchange(identity)
+}
+
+// ExchangeNoNonce 不校验nonce的 Exchange，见 OIDCVerifier.VerifyNoNonce
+func (e *OIDCExchanger) ExchangeNoNonce(verifier *OIDCVerifier, idToken string) (string, *OIDCIdentity, error) {
+	identity, err := verifier.VerifyNoNonce(idToken)
+	if err != nil {
+		return "", nil, err
+	}
+	return e.exchange(identity)
+}
+
+// exchange 找到或创建身份对应的用户，签发 AuthToken
+func (e *OIDCExchanger) exchange(identity *OIDCIdentity) (string, *OIDCIdentity, error) {
+	userID, ok, err := e.opts.Identities.Lookup(identity.Issuer, identity.Subject)
+	if err != nil {
+		return "", identity, err
+	}
+	if !ok {
+		if e.opts.Register == nil {
+			return "", identity, ErrOIDCIdentityNotLinked
+		}
+		if userID, err = e.opts.Register(identity); err != nil {
+			return "", identity, err
+		}
+		if err = e.opts.Identities.Link(identity.Issuer, identity.Subject, userID); err != nil {
+			return "", identity, err
+		}
+	}
+
+	token, err := e.auth.GenerateToken(userID, e.opts.TTL)
+	if err != nil {
+		return "", identity, err
+	}
+	return token, identity, nil
+}
@@ -0,0 +1,253 @@
+// @Author Eric
+// @Date 2026/10/29 18:00:00
+// @Desc 第三方登录ID Token校验和远程JWKS缓存的测试
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"github.com/Kyle91/haven/clock"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://accounts.example.com"
+	testClientID = "haven-client"
+)
+
+// newTestJWKSServer 返回JWKS的http服务，delay大于0时每次响应前等待
+func newTestJWKSServer(t *testing.T, jwks *JWKS, delay time.Duration) (*httptest.Server, *int32) {
+	t.Helper()
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(delay)
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func newTestOIDCSigner(t *testing.T, kid string) (*JWTSigner, *JWK) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewJWTSigner(AlgES256, kid, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := NewJWK(kid, AlgES256, &priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, jwk
+}
+
+func signIDToken(t *testing.T, signer *JWTSigner, claims JWTClaims) string {
+	t.Helper()
+	if claims.Issuer == "" {
+		claims.Issuer = testIssuer
+	}
+	if claims.Audience == nil {
+		claims.Audience = Audience{testClientID}
+	}
+	if claims.ExpiresAt == 0 {
+		claims.ExpiresAt = time.Now().Add(time.Hour).Unix()
+	}
+	token, err := signer.Sign(&claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestOIDCVerify(t *testing.T) {
+	signer, jwk := newTestOIDCSigner(t, "k1")
+	v, err := NewOIDCVerifier(OIDCOptions{Issuer: testIssuer, ClientID: testClientID, Keys: &JWKS{Keys: []*JWK{jwk}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withNonce := map[string]interface{}{"nonce": "n1", "email": "a@example.com", "email_verified": "true"}
+
+	tests := []struct {
+		name    string
+		claims  JWTClaims
+		nonce   string
+		noNonce bool
+		want    error
+	}{
+		{"valid", JWTClaims{Subject: "u1", Extra: withNonce}, "n1", false, nil},
+		{"nonce mismatch", JWTClaims{Subject: "u1", Extra: withNonce}, "n2", false, ErrOIDCNonceMismatch},
+		{"nonce missing in token", JWTClaims{Subject: "u1"}, "n1", false, ErrOIDCNonceMismatch},
+		{"nonce required", JWTClaims{Subject: "u1", Extra: withNonce}, "", false, ErrOIDCNonceRequired},
+		{"explicitly without nonce", JWTClaims{Subject: "u1"}, "", true, nil},
+		{"missing subject", JWTClaims{Extra: withNonce}, "n1", false, ErrOIDCMissingSubject},
+		{"wrong issuer", JWTClaims{Issuer: "https://evil.example.com", Subject: "u1", Extra: withNonce}, "n1", false, ErrJWTInvalidIssuer},
+		{"wrong audience", JWTClaims{Subject: "u1", Audience: Audience{"other"}, Extra: withNonce}, "n1", false, ErrJWTInvalidAudience},
+		{"multiple audiences without azp", JWTClaims{Subject: "u1", Audience: Audience{testClientID, "other"}, Extra: withNonce}, "n1", false, ErrOIDCInvalidAzp},
+		{"expired", JWTClaims{Subject: "u1", ExpiresAt: time.Now().Add(-time.Hour).Unix(), Extra: withNonce}, "n1", false, ErrJWTExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := signIDToken(t, signer, tt.claims)
+			var identity *OIDCIdentity
+			var err error
+			if tt.noNonce {
+				identity, err = v.VerifyNoNonce(token)
+			} else {
+				identity, err = v.Verify(token, tt.nonce)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, err)
+			}
+			if err == nil && (identity.Issuer != testIssuer || identity.Subject != "u1") {
+				t.Fatalf("unexpected identity %+v", identity)
+			}
+		})
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	signer, jwk := newTestOIDCSigner(t, "k1")
+	v, err := NewOIDCVerifier(OIDCOptions{Issuer: testIssuer, ClientID: testClientID, Keys: &JWKS{Keys: []*JWK{jwk}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAuthToken(testSecret, "salt")
+	if _, err = NewOIDCExchanger(a, OIDCExchangeOptions{}); err == nil {
+		t.Fatal("expected error for missing ttl")
+	}
+
+	registered := 0
+	e, err := NewOIDCExchanger(a, OIDCExchangeOptions{TTL: 60, Register: func(identity *OIDCIdentity) (int64, error) {
+		registered++
+		return 42, nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := signIDToken(t, signer, JWTClaims{Subject: "u1", Extra: map[string]interface{}{"nonce": "n1"}})
+	for i := 0; i < 2; i++ {
+		authToken, _, err := e.Exchange(v, token, "n1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := a.ParseClaims(authToken)
+		if err != nil || claims.UserID != 42 {
+			t.Fatalf("unexpected claims %+v, %v", claims, err)
+		}
+	}
+	if registered != 1 {
+		t.Fatalf("want 1 registration, got %d", registered)
+	}
+	if _, _, err = e.Exchange(v, token, ""); !errors.Is(err, ErrOIDCNonceRequired) {
+		t.Fatalf("want ErrOIDCNonceRequired, got %v", err)
+	}
+
+	unlinked, err := NewOIDCExchanger(a, OIDCExchangeOptions{TTL: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = unlinked.ExchangeNoNonce(v, token); !errors.Is(err, ErrOIDCIdentityNotLinked) {
+		t.Fatalf("want ErrOIDCIdentityNotLinked, got %v", err)
+	}
+}
+
+func TestRemoteJWKSRefresh(t *testing.T) {
+	signer1, jwk1 := newTestOIDCSigner(t, "k1")
+	signer2, jwk2 := newTestOIDCSigner(t, "k2")
+	jwks := &JWKS{Keys: []*JWK{jwk1}}
+	srv, hits := newTestJWKSServer(t, jwks, 0)
+	clk := clock.NewMockClock(time.Now())
+	keys := NewRemoteJWKS(srv.URL, RemoteJWKSOptions{Clock: clk})
+	v, err := NewOIDCVerifier(OIDCOptions{Issuer: testIssuer, ClientID: testClientID, Keys: keys, Clock: clk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := func(signer *JWTSigner) error {
+		_, err := v.VerifyNoNonce(signIDToken(t, signer, JWTClaims{Subject: "u1", ExpiresAt: clk.Now().Add(time.Hour).Unix()}))
+		return err
+	}
+
+	if err = verify(signer1); err != nil {
+		t.Fatal(err)
+	}
+	// 未知kid在最小间隔内不会重新获取
+	if err = verify(signer2); !errors.Is(err, ErrJWTKeyNotFound) {
+		t.Fatalf("want ErrJWTKeyNotFound, got %v", err)
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Fatalf("want 1 fetch, got %d", n)
+	}
+
+	// 第三方轮换密钥，超过最小间隔后遇到未知kid重新获取
+	jwks.Keys = append(jwks.Keys, jwk2)
+	clk.Add(2 * time.Minute)
+	if err = verify(signer2); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(hits); n != 2 {
+		t.Fatalf("want 2 fetches, got %d", n)
+	}
+
+	// 获取失败时继续使用缓存
+	srv.Close()
+	clk.Add(2 * time.Hour)
+	if err = verify(signer1); err != nil {
+		t.Fatal(err)
+	}
+	if err = keys.Refresh(); err == nil {
+		t.Fatal("expected refresh error")
+	}
+}
+
+func TestRemoteJWKSConcurrentFetch(t *testing.T) {
+	_, jwk := newTestOIDCSigner(t, "k1")
+	srv, hits := newTestJWKSServer(t, &JWKS{Keys: []*JWK{jwk}}, 100*time.Millisecond)
+	keys := NewRemoteJWKS(srv.URL, RemoteJWKSOptions{})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := keys.ResolveKey("k1", AlgES256)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Fatalf("want 1 fetch, got %d", n)
+	}
+}
+
+func TestRemoteJWKSTimeout(t *testing.T) {
+	_, jwk := newTestOIDCSigner(t, "k1")
+	srv, _ := newTestJWKSServer(t, &JWKS{Keys: []*JWK{jwk}}, 300*time.Millisecond)
+	keys := NewRemoteJWKS(srv.URL, RemoteJWKSOptions{Timeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	if _, err := keys.ResolveKey("k1", AlgES256); err == nil {
+		t.Fatal("expected timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Fatalf("fetch not bounded by timeout: %v", elapsed)
+	}
+}
@@ -0,0 +1,386 @@
+// @Author Eric
+// @Date 2026/10/20 17:00:00
+// @Desc 两步验证，RFC 4226 HOTP 和 RFC 6238 TOTP，以及一次性恢复码
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/Kyle91/haven/clock"
+	"github.com/Kyle91/haven/crypto"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTP哈希算法
+const (
+	OTPAlgSHA1   = "SHA1"
+	OTPAlgSHA256 = "SHA256"
+	OTPAlgSHA512 = "SHA512"
+)
+
+var (
+	ErrOTPInvalidSecret = errors.New("invalid otp secret")
+	ErrOTPReplayed      = errors.New("otp code already used")
+	ErrOTPInvalidPeriod = errors.New("otp period must be a whole number of seconds")
+	ErrOTPInvalidDigits = errors.New("otp digits must be between 6 and 8")
+)
+
+var otpBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateOTPSecret
+//
+//	@Description: 生成base32编码的OTP密钥，20字节，和SHA1的输出长度一致
+//	@return string
+//	@return error
+func GenerateOTPSecret() (string, error) {
+	key, err := crypto.GenerateRandomKey(20)
+	if err != nil {
+		return "", err
+	}
+	return otpBase32.EncodeToString(key), nil
+}
+
+// DecodeOTPSecret 解码base32密钥，忽略大小写、空格和填充
+func DecodeOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+	key, err := otpBase32.DecodeString(secret)
+	if err != nil || len(key) == 0 {
+		return nil, ErrOTPInvalidSecret
+	}
+	return key, nil
+}
+
+// HOTP
+//
+//	@Description: RFC 4226 计算一次性密码
+//	@param key 原始密钥
+//	@param counter 计数器
+//	@param digits 位数，一般为6，RFC 4226 要求6到8位，更多的位数不会增加强度
+//	@param alg 哈希算法，为空时使用SHA1
+//	@return string
+func HOTP(key []byte, counter uint64, digits int, alg string) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(otpHash(alg), key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// 动态截断
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	// 10位以上时10的幂超出uint32
+	mod := uint64(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, uint64(code)%mod)
+}
+
+// VerifyHOTP
+//
+//	@Description: 校验HOTP，允许客户端计数器向前偏移lookAhead次
+//	@param secret base32密钥
+//	@param code
+//	@param counter 服务端保存的下一个计数器
+//	@param digits 位数，小于等于0时为6
+//	@param lookAhead 向前查找的次数
+//	@return uint64 校验成功后服务端应该保存的新计数器
+//	@return bool
+//	@return error 位数不在6到8之间时返回 ErrOTPInvalidDigits
+func VerifyHOTP(secret, code string, counter uint64, digits, lookAhead int) (uint64, bool, error) {
+	key, err := DecodeOTPSecret(secret)
+	if err != nil {
+		return counter, false, err
+	}
+	if digits <= 0 {
+		digits = 6
+	}
+	if err = checkOTPDigits(digits); err != nil {
+		return counter, false, err
+	}
+	// 位数由服务端决定，不能按输入的长度计算，否则输入1位数字只需要猜10次
+	if len(code) != digits {
+		return counter, false, nil
+	}
+	for i := 0; i <= lookAhead; i++ {
+		expected := HOTP(key, counter+uint64(i), digits, OTPAlgSHA1)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter + uint64(i) + 1, true, nil
+		}
+	}
+	return counter, false, nil
+}
+
+// checkOTPDigits RFC 4226 要求至少6位，动态截断只有31位，超过8位时高位的分布不均匀
+func checkOTPDigits(digits int) error {
+	if digits < 6 || digits > 8 {
+		return ErrOTPInvalidDigits
+	}
+	return nil
+}
+
+// TOTPOptions TOTP配置
+type TOTPOptions struct {
+	Digits    int           // 位数，默认6，只能是6到8
+	Period    time.Duration // 时间步长，默认30秒，必须是整秒
+	Algorithm string        // 哈希算法，默认SHA1，大多数验证器App只支持SHA1
+	Window    int           // 允许前后偏移的时间步数，默认1，小于0表示不允许偏移
+	Clock     clock.Clock
+}
+
+// TOTP RFC 6238 基于时间的一次性密码
+type TOTP struct {
+	opts   TOTPOptions
+	replay OTPReplayStore
+}
+
+// NewTOTP
+//
+//	@Description: 创建TOTP校验器
+//	@param opts
+//	@param replay 已使用验证码的存储，为nil时不做重放保护
+//	@return *TOTP
+//	@return error Period小于1秒或者不是整秒时返回 ErrOTPInvalidPeriod，Digits不在6到8之间时返回 ErrOTPInvalidDigits
+func NewTOTP(opts TOTPOptions, replay OTPReplayStore) (*TOTP, error) {
+	if opts.Digits <= 0 {
+		opts.Digits = 6
+	}
+	if err := checkOTPDigits(opts.Digits); err != nil {
+		return nil, err
+	}
+	if opts.Period == 0 {
+		opts.Period = 30 * time.Second
+	}
+	// otpauth地址中的period以秒为单位，时间步也按秒计算
+	if opts.Period < time.Second || opts.Period%time.Second != 0 {
+		return nil, ErrOTPInvalidPeriod
+	}
+	if opts.Algorithm == "" {
+		opts.Algorithm = OTPAlgSHA1
+	}
+	if opts.Window < 0 {
+		opts.Window = 0
+	} else if opts.Window == 0 {
+		opts.Window = 1
+	}
+	opts.Clock = clock.OrDefault(opts.Clock)
+	return &TOTP{opts: opts, replay: replay}, nil
+}
+
+// ProvisioningURI
+//
+//	@Description: 生成 otpauth:// 地址，用于生成二维码给验证器App扫描
+//	@receiver t
+//	@param secret base32密钥
+//	@param issuer 发行方，例如游戏名
+//	@param account 账号
+//	@return string
+func (t *TOTP) ProvisioningURI(secret, issuer, account string) string {
+	label := url.PathEscape(account)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+
+	q := url.Values{}
+	q.Set("secret", secret)
+	if issuer != "" {
+		q.Set("issuer", issuer)
+	}
+	q.Set("algorithm", t.opts.Algorithm)
+	q.Set("digits", strconv.Itoa(t.opts.Digits))
+	q.Set("period", strconv.Itoa(int(t.opts.Period/time.Second)))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// Generate 生成当前时间的验证码
+func (t *TOTP) Generate(secret string) (string, error) {
+	key, err := DecodeOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return HOTP(key, uint64(t.step(t.opts.Clock.Now())), t.opts.Digits, t.opts.Algorithm), nil
+}
+
+// Verify
+//
+//	@Description: 校验验证码，同一个账号已经用过的验证码(以及更早的)不能再次使用
+//	@receiver t
+//	@param account 账号，用于重放保护
+//	@param secret base32密钥
+//	@param code 用户输入的验证码
+//	@return bool
+//	@return error 验证码已被使用时返回 ErrOTPReplayed
+func (t *TOTP) Verify(account, secret, code string) (bool, error) {
+	key, err := DecodeOTPSecret(secret)
+	if err != nil {
+		return false, err
+	}
+	if len(code) != t.opts.Digits {
+		return false, nil
+	}
+
+	now := t.opts.Clock.Now()
+	current := t.step(now)
+	for i := -t.opts.Window; i <= t.opts.Window; i++ {
+		step := current + int64(i)
+		if step < 0 {
+			continue
+		}
+		expected := HOTP(key, uint64(step), t.opts.Digits, t.opts.Algorithm)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+
+		if t.replay == nil {
+			return true, nil
+		}
+		// 记录保留到窗口结束，之后这个时间步的验证码已经不可能通过
+		expireAt := now.Add(time.Duration(t.opts.Window+1) * t.opts.Period)
+		ok, err := t.replay.MarkUsed(account, step, expireAt)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, ErrOTPReplayed
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (t *TOTP) step(now time.Time) int64 {
+	return now.Unix() / int64(t.opts.Period/time.Second)
+}
+
+func otpHash(alg string) func() hash.Hash {
+	switch alg {
+	case OTPAlgSHA256:
+		return sha256.New
+	case OTPAlgSHA512:
+		return sha512.New
+	default:
+		return sha1.New
+	}
+}
+
+// OTPReplayStore 记录每个账号最后使用的时间步
+type OTPReplayStore interface {
+	// MarkUsed 原子地记录账号使用了step，step不大于已记录的值时返回false
+	MarkUsed(account string, step int64, expireAt time.Time) (bool, error)
+}
+
+type otpUsed struct {
+	step     int64
+	expireAt time.Time
+}
+
+// MemoryOTPReplayStore 内存实现
+type MemoryOTPReplayStore struct {
+	mu        sync.Mutex
+	used      map[string]otpUsed
+	lastPrune time.Time
+	clock     clock.Clock // 清理过期记录使用的时钟
+}
+
+// NewMemoryOTPReplayStore 创建内存重放保护存储
+func NewMemoryOTPReplayStore() *MemoryOTPReplayStore {
+	return &MemoryOTPReplayStore{used: make(map[string]otpUsed), clock: clock.System}
+}
+
+// WithClock 设置清理过期记录使用的时钟，需要和 TOTP 使用同一个时钟
+func (s *MemoryOTPReplayStore) WithClock(c clock.Clock) *MemoryOTPReplayStore {
+	s.clock = clock.OrDefault(c)
+	return s
+}
+
+func (s *MemoryOTPReplayStore) MarkUsed(account string, step int64, expireAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	if now.Sub(s.lastPrune) > time.Minute {
+		s.lastPrune = now
+		for k, v := range s.used {
+			if now.After(v.expireAt) {
+				delete(s.used, k)
+			}
+		}
+	}
+
+	if last, ok := s.used[account]; ok && step <= last.step {
+		return false, nil
+	}
+	s.used[account] = otpUsed{step: step, expireAt: expireAt}
+	return true, nil
+}
+
+// GenerateRecoveryCodes
+//
+//	@Description: 生成一次性恢复码，明文只展示给用户一次，服务端只保存哈希
+//	@param n 数量
+//	@return []string 明文恢复码，格式为 xxxxx-xxxxx
+//	@return []string 对应的哈希，用于保存
+//	@return error
+func GenerateRecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, 0, n)
+	hashes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		b, err := crypto.GenerateRandomKey(7)
+		if err != nil {
+			return nil, nil, err
+		}
+		s := strings.ToLower(otpBase32.EncodeToString(b))[:10]
+		code := s[:5] + "-" + s[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode 计算恢复码的哈希，忽略大小写、空格和分隔符
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return crypto.SHA256([]byte(code))
+}
+
+// ConsumeRecoveryCode
+//
+//	@Description: 使用恢复码，成功时返回去掉该码后的哈希列表，调用方需要保存
+//	@param code 用户输入的恢复码
+//	@param hashes 已保存的哈希列表
+//	@return []string
+//	@return bool
+func ConsumeRecoveryCode(code string, hashes []string) ([]string, bool) {
+	target := []byte(HashRecoveryCode(code))
+	index := -1
+	// 遍历所有哈希，不提前退出
+	for i, h := range hashes {
+		if subtle.ConstantTimeCompare(target, []byte(h)) == 1 {
+			index = i
+		}
+	}
+	if index < 0 {
+		return hashes, false
+	}
+
+	remaining := make([]string, 0, len(hashes)-1)
+	remaining = append(remaining, hashes[:index]...)
+	remaining = append(remaining, hashes[index+1:]...)
+	return remaining, true
+}
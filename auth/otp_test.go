@@ -0,0 +1,195 @@
+// @Author Eric
+// @Date 2026/10/29 15:30:00
+// @Desc HOTP/TOTP 的测试，使用 RFC 4226 和 RFC 6238 附录中的测试向量
+package auth
+
+import (
+	"errors"
+	"github.com/Kyle91/haven/clock"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHOTPRFC4226(t *testing.T) {
+	key := []byte("12345678901234567890")
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		if got := HOTP(key, uint64(counter), 6, OTPAlgSHA1); got != code {
+			t.Fatalf("counter %d: want %s, got %s", counter, code, got)
+		}
+	}
+}
+
+func TestVerifyHOTP(t *testing.T) {
+	secret := otpBase32.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		name        string
+		code        string
+		counter     uint64
+		digits      int
+		lookAhead   int
+		wantOK      bool
+		wantCounter uint64
+	}{
+		{"current", "755224", 0, 6, 0, true, 1},
+		{"look ahead", "969429", 0, 6, 3, true, 4},
+		{"beyond look ahead", "338314", 0, 6, 3, false, 0},
+		{"already used", "755224", 1, 6, 3, false, 1},
+		{"default digits", "287082", 1, 0, 0, true, 2},
+		// 输入的位数和配置不一致时直接拒绝
+		{"short code", "4", 0, 6, 9, false, 0},
+		{"long code", "7552240", 0, 6, 0, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok, err := VerifyHOTP(secret, tt.code, tt.counter, tt.digits, tt.lookAhead)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantOK || counter != tt.wantCounter {
+				t.Fatalf("want %v %d, got %v %d", tt.wantOK, tt.wantCounter, ok, counter)
+			}
+		})
+	}
+	if _, _, err := VerifyHOTP("!!", "755224", 0, 6, 0); !errors.Is(err, ErrOTPInvalidSecret) {
+		t.Fatalf("want ErrOTPInvalidSecret, got %v", err)
+	}
+	for _, digits := range []int{1, 5, 9, 10} {
+		code := HOTP([]byte("12345678901234567890"), 0, digits, OTPAlgSHA1)
+		if _, _, err := VerifyHOTP(secret, code, 0, digits, 0); !errors.Is(err, ErrOTPInvalidDigits) {
+			t.Fatalf("digits %d: want ErrOTPInvalidDigits, got %v", digits, err)
+		}
+	}
+}
+
+func TestHOTPDigits(t *testing.T) {
+	// counter 0 截断后的值是 1284755224
+	key := []byte("12345678901234567890")
+	for digits, want := range map[int]string{6: "755224", 8: "84755224", 10: "1284755224", 12: "001284755224"} {
+		if got := HOTP(key, 0, digits, OTPAlgSHA1); got != want {
+			t.Fatalf("digits %d: want %s, got %s", digits, want, got)
+		}
+	}
+}
+
+func TestTOTPRFC6238(t *testing.T) {
+	seeds := map[string]string{
+		OTPAlgSHA1:   "12345678901234567890",
+		OTPAlgSHA256: "12345678901234567890123456789012",
+		OTPAlgSHA512: strings.Repeat("1234567890", 6) + "1234",
+	}
+	tests := []struct {
+		unix int64
+		want map[string]string
+	}{
+		{59, map[string]string{OTPAlgSHA1: "94287082", OTPAlgSHA256: "46119246", OTPAlgSHA512: "90693936"}},
+		{1111111109, map[string]string{OTPAlgSHA1: "07081804", OTPAlgSHA256: "68084774", OTPAlgSHA512: "25091201"}},
+		{1111111111, map[string]string{OTPAlgSHA1: "14050471", OTPAlgSHA256: "67062674", OTPAlgSHA512: "99943326"}},
+		{1234567890, map[string]string{OTPAlgSHA1: "89005924", OTPAlgSHA256: "91819424", OTPAlgSHA512: "93441116"}},
+		{2000000000, map[string]string{OTPAlgSHA1: "69279037", OTPAlgSHA256: "90698825", OTPAlgSHA512: "38618901"}},
+		{20000000000, map[string]string{OTPAlgSHA1: "65353130", OTPAlgSHA256: "77737706", OTPAlgSHA512: "47863826"}},
+	}
+	for alg, seed := range seeds {
+		secret := otpBase32.EncodeToString([]byte(seed))
+		for _, tt := range tests {
+			clk := clock.NewMockClock(time.Unix(tt.unix, 0))
+			totp, err := NewTOTP(TOTPOptions{Digits: 8, Algorithm: alg, Clock: clk}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := totp.Generate(secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want[alg] {
+				t.Fatalf("%s at %d: want %s, got %s", alg, tt.unix, tt.want[alg], got)
+			}
+		}
+	}
+}
+
+func TestTOTPVerifyWindowAndReplay(t *testing.T) {
+	secret := otpBase32.EncodeToString([]byte("12345678901234567890"))
+	clk := clock.NewMockClock(time.Unix(1111111111, 0))
+	totp, err := NewTOTP(TOTPOptions{Digits: 8, Clock: clk}, NewMemoryOTPReplayStore().WithClock(clk))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1111111109 在上一个时间步，窗口内可以通过
+	ok, err := totp.Verify("alice", secret, "07081804")
+	if err != nil || !ok {
+		t.Fatalf("previous step: %v %v", ok, err)
+	}
+	// 同一个验证码不能再用
+	if _, err = totp.Verify("alice", secret, "07081804"); !errors.Is(err, ErrOTPReplayed) {
+		t.Fatalf("want ErrOTPReplayed, got %v", err)
+	}
+	// 当前时间步比已使用的更新，可以通过
+	if ok, err = totp.Verify("alice", secret, "14050471"); err != nil || !ok {
+		t.Fatalf("current step: %v %v", ok, err)
+	}
+	// 窗口外
+	clk.Add(2 * time.Minute)
+	if ok, err = totp.Verify("bob", secret, "14050471"); err != nil || ok {
+		t.Fatalf("outside window: %v %v", ok, err)
+	}
+}
+
+func TestNewTOTPPeriod(t *testing.T) {
+	tests := []struct {
+		period time.Duration
+		want   error
+		uri    string
+	}{
+		{0, nil, "period=30"},
+		{60 * time.Second, nil, "period=60"},
+		{time.Second, nil, "period=1"},
+		{500 * time.Millisecond, ErrOTPInvalidPeriod, ""},
+		{1500 * time.Millisecond, ErrOTPInvalidPeriod, ""},
+		{-time.Second, ErrOTPInvalidPeriod, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.period.String(), func(t *testing.T) {
+			totp, err := NewTOTP(TOTPOptions{Period: tt.period}, nil)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, err)
+			}
+			if err != nil {
+				return
+			}
+			if uri := totp.ProvisioningURI("JBSWY3DPEHPK3PXP", "haven", "alice"); !strings.Contains(uri, tt.uri) {
+				t.Fatalf("want %s in %s", tt.uri, uri)
+			}
+		})
+	}
+}
+
+func TestNewTOTPDigits(t *testing.T) {
+	for digits, want := range map[int]error{0: nil, 6: nil, 7: nil, 8: nil, 5: ErrOTPInvalidDigits, 9: ErrOTPInvalidDigits, 10: ErrOTPInvalidDigits} {
+		if _, err := NewTOTP(TOTPOptions{Digits: digits}, nil); !errors.Is(err, want) {
+			t.Fatalf("digits %d: want %v, got %v", digits, want, err)
+		}
+	}
+}
+
+func TestMemoryOTPReplayStorePrune(t *testing.T) {
+	clk := clock.NewMockClock(time.Unix(1700000000, 0))
+	s := NewMemoryOTPReplayStore().WithClock(clk)
+	if ok, _ := s.MarkUsed("alice", 5, clk.Now().Add(time.Minute)); !ok {
+		t.Fatal("first use rejected")
+	}
+	// 按系统时间清理会删掉记录，让验证码可以重放
+	clk.Add(30 * time.Second)
+	s.MarkUsed("bob", 5, clk.Now().Add(time.Minute))
+	if ok, _ := s.MarkUsed("alice", 5, clk.Now().Add(time.Minute)); ok {
+		t.Fatal("replay accepted before expiry")
+	}
+
+	clk.Add(2 * time.Minute)
+	s.MarkUsed("bob", 9, clk.Now().Add(time.Minute))
+	if ok, _ := s.MarkUsed("alice", 5, clk.Now().Add(time.Minute)); !ok {
+		t.Fatal("expired record not pruned")
+	}
+}
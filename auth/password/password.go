@@ -0,0 +1,371 @@
+// @Author Eric
+// @Date 2026/10/20 14:00:00
+// @Desc 密码哈希和校验，支持 argon2id、bcrypt、scrypt，兼容旧的 md5 和加盐 sha256
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/Kyle91/haven/crypto"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+	"strconv"
+	"strings"
+)
+
+// 支持的算法
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+	Scrypt   = "scrypt"
+	MD5      = "md5"    // 仅用于校验旧数据
+	SHA256   = "sha256" // 仅用于校验旧数据
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown password hash format")
+	ErrInvalidHash   = errors.New("invalid password hash")
+	ErrUnsupported   = errors.New("unsupported password algorithm")
+)
+
+// Params 哈希参数
+type Params struct {
+	Algorithm string
+
+	// argon2id
+	Memory  uint32 // 内存(KiB)
+	Time    uint32 // 迭代次数
+	Threads uint8  // 并行度
+
+	// bcrypt
+	Cost int
+
+	// scrypt
+	LogN int // N = 2^LogN
+	R    int
+	P    int
+
+	SaltLen int // 盐长度(字节)，bcrypt不使用
+	KeyLen  int // 输出长度(字节)，bcrypt不使用
+}
+
+// DefaultParams 默认使用 argon2id，参数取自 RFC 9106 的第二推荐配置
+var DefaultParams = Params{
+	Algorithm: Argon2id,
+	Memory:    64 * 1024,
+	Time:      3,
+	Threads:   2,
+	Cost:      bcrypt.DefaultCost,
+	LogN:      15,
+	R:         8,
+	P:         1,
+	SaltLen:   16,
+	KeyLen:    32,
+}
+
+// Hasher 按指定参数生成和校验密码哈希
+type Hasher struct {
+	params Params
+}
+
+// NewHasher 创建Hasher，未设置的参数使用默认值
+func NewHasher(params Params) (*Hasher, error) {
+	if params.Algorithm == "" {
+		params.Algorithm = DefaultParams.Algorithm
+	}
+	switch params.Algorithm {
+	case Argon2id, Bcrypt, Scrypt:
+	default:
+		return nil, ErrUnsupported
+	}
+	if params.Memory == 0 {
+		params.Memory = DefaultParams.Memory
+	}
+	if params.Time == 0 {
+		params.Time = DefaultParams.Time
+	}
+	if params.Threads == 0 {
+		params.Threads = DefaultParams.Threads
+	}
+	if params.Cost == 0 {
+		params.Cost = DefaultParams.Cost
+	}
+	if params.LogN == 0 {
+		params.LogN = DefaultParams.LogN
+	}
+	if params.R == 0 {
+		params.R = DefaultParams.R
+	}
+	if params.P == 0 {
+		params.P = DefaultParams.P
+	}
+	if params.SaltLen == 0 {
+		params.SaltLen = DefaultParams.SaltLen
+	}
+	if params.KeyLen == 0 {
+		params.KeyLen = DefaultParams.KeyLen
+	}
+	return &Hasher{params: params}, nil
+}
+
+var defaultHasher = &Hasher{params: DefaultParams}
+
+// Hash 使用默认参数生成密码哈希
+func Hash(password string) (string, error) {
+	return defaultHasher.Hash(password)
+}
+
+// Verify 校验密码，支持所有已知格式
+func Verify(password, encoded string) (bool, error) {
+	return defaultHasher.Verify(password, encoded)
+}
+
+// NeedsRehash 哈希是否需要按默认参数重新生成
+func NeedsRehash(encoded string) bool {
+	return defaultHasher.NeedsRehash(encoded)
+}
+
+// Hash
+//
+//	@Description: 生成PHC格式的密码哈希，例如 $argon2id$v=19$m=65536,t=3,p=2$salt$hash
+//	@receiver h
+//	@param password
+//	@return string
+//	@return error
+func (h *Hasher) Hash(password string) (string, error) {
+	p := h.params
+	if p.Algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), p.Cost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	switch p.Algorithm {
+	case Argon2id:
+		key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, uint32(p.KeyLen))
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, p.Memory, p.Time, p.Threads, b64(salt), b64(key)), nil
+	case Scrypt:
+		key, err := scrypt.Key([]byte(password), salt, 1<<p.LogN, p.R, p.P, p.KeyLen)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", p.LogN, p.R, p.P, b64(salt), b64(key)), nil
+	}
+	return "", ErrUnsupported
+}
+
+// Verify
+//
+//	@Description: 校验密码，比较过程是常量时间的
+//	@receiver h
+//	@param password
+//	@param encoded Hash生成的哈希，或者旧的md5、加盐sha256数据
+//	@return bool
+//	@return error 哈希格式错误时返回
+func (h *Hasher) Verify(password, encoded string) (bool, error) {
+	decoded, err := decode(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	switch decoded.params.Algorithm {
+	case Bcrypt:
+		err = bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case Argon2id:
+		p := decoded.params
+		key := argon2.IDKey([]byte(password), decoded.salt, p.Time, p.Memory, p.Threads, uint32(len(decoded.key)))
+		return subtle.ConstantTimeCompare(key, decoded.key) == 1, nil
+	case Scrypt:
+		p := decoded.params
+		key, err := scrypt.Key([]byte(password), decoded.salt, 1<<p.LogN, p.R, p.P, len(decoded.key))
+		if err != nil {
+			return false, err
+		}
+		return subtle.ConstantTimeCompare(key, decoded.key) == 1, nil
+	case MD5:
+		digest := crypto.MD5([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(digest), decoded.key) == 1, nil
+	case SHA256:
+		digest := crypto.SHA256([]byte(password + string(decoded.salt)))
+		return subtle.ConstantTimeCompare([]byte(digest), decoded.key) == 1, nil
+	}
+	return false, ErrUnsupported
+}
+
+// NeedsRehash
+//
+//	@Description: 登录校验成功后调用，返回true时应该用明文密码重新生成哈希并保存
+//	算法不同、参数低于当前配置或者是旧格式时返回true
+//	@receiver h
+//	@param encoded
+//	@return bool
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	decoded, err := decode(encoded)
+	if err != nil {
+		return true
+	}
+
+	cur, old := h.params, decoded.params
+	if old.Algorithm != cur.Algorithm {
+		return true
+	}
+	switch cur.Algorithm {
+	case Argon2id:
+		return old.Memory < cur.Memory || old.Time < cur.Time || old.Threads < cur.Threads ||
+			len(decoded.salt) < cur.SaltLen || len(decoded.key) < cur.KeyLen
+	case Bcrypt:
+		return old.Cost < cur.Cost
+	case Scrypt:
+		return old.LogN < cur.LogN || old.R < cur.R || old.P < cur.P ||
+			len(decoded.salt) < cur.SaltLen || len(decoded.key) < cur.KeyLen
+	}
+	return true
+}
+
+// LegacySHA256
+//
+//	@Description: 把旧库中分开存储的盐和摘要组合成可以被 Verify 识别的格式
+//	摘要的计算方式为 sha256(password + salt) 的十六进制
+//	@param salt
+//	@param digest
+//	@return string
+func LegacySHA256(salt, digest string) string {
+	return fmt.Sprintf("$sha256$%s$%s", base64.RawStdEncoding.EncodeToString([]byte(salt)), strings.ToLower(digest))
+}
+
+type decodedHash struct {
+	params Params
+	salt   []byte
+	key    []byte
+}
+
+// decode 解析哈希字符串
+func decode(encoded string) (*decodedHash, error) {
+	// 旧数据：32位十六进制的md5
+	if len(encoded) == 32 && isHex(encoded) {
+		return &decodedHash{params: Params{Algorithm: MD5}, key: []byte(strings.ToLower(encoded))}, nil
+	}
+	if strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$") {
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return nil, ErrInvalidHash
+		}
+		return &decodedHash{params: Params{Algorithm: Bcrypt, Cost: cost}}, nil
+	}
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) < 2 || parts[0] != "" {
+		return nil, ErrUnknownFormat
+	}
+
+	switch parts[1] {
+	case Argon2id:
+		// $argon2id$v=19$m=65536,t=3,p=2$salt$hash
+		if len(parts) != 6 || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+			return nil, ErrInvalidHash
+		}
+		kv, err := parseParams(parts[3])
+		if err != nil {
+			return nil, err
+		}
+		threads := kv["p"]
+		if threads > 255 {
+			return nil, ErrInvalidHash
+		}
+		d := &decodedHash{params: Params{Algorithm: Argon2id, Memory: uint32(kv["m"]), Time: uint32(kv["t"]), Threads: uint8(threads)}}
+		if d.salt, d.key, err = decodeSaltKey(parts[4], parts[5]); err != nil {
+			return nil, err
+		}
+		if d.params.Memory == 0 || d.params.Time == 0 || d.params.Threads == 0 {
+			return nil, ErrInvalidHash
+		}
+		return d, nil
+	case Scrypt:
+		// $scrypt$ln=15,r=8,p=1$salt$hash
+		if len(parts) != 5 {
+			return nil, ErrInvalidHash
+		}
+		kv, err := parseParams(parts[2])
+		if err != nil {
+			return nil, err
+		}
+		d := &decodedHash{params: Params{Algorithm: Scrypt, LogN: kv["ln"], R: kv["r"], P: kv["p"]}}
+		if d.salt, d.key, err = decodeSaltKey(parts[3], parts[4]); err != nil {
+			return nil, err
+		}
+		if d.params.LogN <= 0 || d.params.LogN > 30 || d.params.R <= 0 || d.params.P <= 0 {
+			return nil, ErrInvalidHash
+		}
+		return d, nil
+	case SHA256:
+		// $sha256$salt$hexdigest
+		if len(parts) != 4 || len(parts[3]) != 64 || !isHex(parts[3]) {
+			return nil, ErrInvalidHash
+		}
+		salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, ErrInvalidHash
+		}
+		return &decodedHash{params: Params{Algorithm: SHA256}, salt: salt, key: []byte(strings.ToLower(parts[3]))}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// parseParams 解析 k=v,k=v 格式的参数
+func parseParams(s string) (map[string]int, error) {
+	kv := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, ErrInvalidHash
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, ErrInvalidHash
+		}
+		kv[k] = n
+	}
+	return kv, nil
+}
+
+func decodeSaltKey(saltStr, keyStr string) ([]byte, []byte, error) {
+	salt, err := base64.RawStdEncoding.DecodeString(saltStr)
+	if err != nil {
+		return nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(keyStr)
+	if err != nil || len(key) == 0 {
+		return nil, nil, ErrInvalidHash
+	}
+	return salt, key, nil
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func b64(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,173 @@
+// @Author Eric
+// @Date 2026/10/29 15:00:00
+// @Desc 密码哈希和校验的测试
+package password
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+	"testing"
+)
+
+// 测试用的低成本参数
+var fastParams = map[string]Params{
+	Argon2id: {Algorithm: Argon2id, Memory: 1024, Time: 1, Threads: 1},
+	Bcrypt:   {Algorithm: Bcrypt, Cost: 4},
+	Scrypt:   {Algorithm: Scrypt, LogN: 4, R: 8, P: 1},
+}
+
+func TestHashVerify(t *testing.T) {
+	for alg, params := range fastParams {
+		t.Run(alg, func(t *testing.T) {
+			h, err := NewHasher(params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tests := []struct {
+				password string
+				want     bool
+			}{
+				{"correct horse", true},
+				{"correct horse ", false},
+				{"", false},
+			}
+			for _, tt := range tests {
+				ok, err := h.Verify(tt.password, encoded)
+				if err != nil || ok != tt.want {
+					t.Fatalf("Verify(%q) = %v, %v, want %v", tt.password, ok, err, tt.want)
+				}
+			}
+			// 相同密码每次的盐不同
+			again, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again == encoded {
+				t.Fatal("hash is not salted")
+			}
+			if h.NeedsRehash(encoded) {
+				t.Fatal("fresh hash needs rehash")
+			}
+		})
+	}
+}
+
+func TestVerifyArgon2idPHC(t *testing.T) {
+	// 独立按PHC格式构造，确认编码和参数解析一致
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("password"), salt, 2, 1024, 1, 32)
+	encoded := fmt.Sprintf("$argon2id$v=19$m=1024,t=2,p=1$%s$%s",
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	ok, err := Verify("password", encoded)
+	if err != nil || !ok {
+		t.Fatalf("Verify = %v, %v", ok, err)
+	}
+	if ok, _ = Verify("Password", encoded); ok {
+		t.Fatal("wrong password accepted")
+	}
+	// 低于默认参数，需要重新生成
+	if !NeedsRehash(encoded) {
+		t.Fatal("weak argon2id params should need rehash")
+	}
+}
+
+func TestVerifyLegacy(t *testing.T) {
+	sum := sha256.Sum256([]byte("password" + "pepper"))
+	tests := []struct {
+		name     string
+		encoded  string
+		password string
+		want     bool
+	}{
+		{"md5", "5f4dcc3b5aa765d61d8327deb882cf99", "password", true},
+		{"md5 upper case", "5F4DCC3B5AA765D61D8327DEB882CF99", "password", true},
+		{"md5 wrong", "5f4dcc3b5aa765d61d8327deb882cf99", "passw0rd", false},
+		{"sha256", LegacySHA256("pepper", hex.EncodeToString(sum[:])), "password", true},
+		{"sha256 wrong", LegacySHA256("pepper", hex.EncodeToString(sum[:])), "pepper", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := Verify(tt.password, tt.encoded)
+			if err != nil || ok != tt.want {
+				t.Fatalf("Verify = %v, %v, want %v", ok, err, tt.want)
+			}
+			if !NeedsRehash(tt.encoded) {
+				t.Fatal("legacy hash should need rehash")
+			}
+		})
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	tests := []struct {
+		encoded string
+		want    error
+	}{
+		{"", ErrUnknownFormat},
+		{"plaintext", ErrUnknownFormat},
+		{"$unknown$abc", ErrUnknownFormat},
+		{"$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5", ErrInvalidHash},
+		{"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5", ErrInvalidHash},
+		{"$argon2id$v=19$m=1024,t=1,p=300$c2FsdA$a2V5", ErrInvalidHash},
+		{"$scrypt$ln=31,r=8,p=1$c2FsdA$a2V5", ErrInvalidHash},
+		{"$sha256$c2FsdA$" + strings.Repeat("z", 64), ErrInvalidHash},
+		{"$2a$99$invalid", ErrInvalidHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoded, func(t *testing.T) {
+			ok, err := Verify("password", tt.encoded)
+			if ok || !errors.Is(err, tt.want) {
+				t.Fatalf("Verify = %v, %v, want %v", ok, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	weak, err := NewHasher(fastParams[Bcrypt])
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := weak.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	strong, err := NewHasher(Params{Algorithm: Bcrypt, Cost: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	argon, err := NewHasher(fastParams[Argon2id])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		h    *Hasher
+		want bool
+	}{
+		{"same params", weak, false},
+		{"higher cost", strong, true},
+		{"different algorithm", argon, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.h.NeedsRehash(encoded); got != tt.want {
+				t.Fatalf("NeedsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err = NewHasher(Params{Algorithm: MD5}); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("md5 hasher: want ErrUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+// @Author Eric
+// @Date 2026/10/22 11:00:00
+// @Desc 权限检查在http和mq命令处理中的使用
+package rbac
+
+import (
+	"github.com/Kyle91/haven/auth"
+	"github.com/Kyle91/haven/common"
+	"github.com/valyala/fasthttp"
+)
+
+// Require
+//
+//	@Description: fasthttp中间件，需要放在 auth.AuthToken.Middleware 之后
+//	没有claims返回401 common.InvalidToken，没有权限返回403 common.AuthFailed
+//	@receiver r
+//	@param permission
+//	@return func(fasthttp.RequestHandler) fasthttp.RequestHandler
+func (r *RBAC) Require(permission string) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			claims, ok := auth.ClaimsFromContext(ctx)
+			if !ok {
+				auth.WriteError(ctx, fasthttp.StatusUnauthorized, common.InvalidToken)
+				return
+			}
+			if !r.Can(claims, permission) {
+				auth.WriteError(ctx, fasthttp.StatusForbidden, common.AuthFailed)
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// SetCommandPermission 设置命令字需要的权限，覆盖配置文件中的设置
+func (r *RBAC) SetCommandPermission(cmd int, permission string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands[cmd] = permission
+}
+
+// CheckCommand
+//
+//	@Description: 检查claims是否可以执行命令字，没有配置权限的命令字默认拒绝，
+//	配置 allow_unconfigured 为true时允许执行
+//	@receiver r
+//	@param claims
+//	@param cmd common中定义的命令字
+//	@return int common.Success 或 common.AuthFailed
+func (r *RBAC) CheckCommand(claims *auth.Claims, cmd int) int {
+	r.mu.RLock()
+	permission, ok := r.commands[cmd]
+	allowUnconfigured := r.allowUnconfigured
+	r.mu.RUnlock()
+
+	if !ok {
+		if allowUnconfigured {
+			return common.Success
+		}
+		return common.AuthFailed
+	}
+	if !r.Can(claims, permission) {
+		return common.AuthFailed
+	}
+	return common.Success
+}
+
+// CommandHandler mq命令处理函数
+type CommandHandler func(claims *auth.Claims, cmd int, body []byte) error
+
+// GuardCommand
+//
+//	@Description: 包装命令处理函数，没有权限时不调用handler，返回 common.AuthFailed 错误
+//	@receiver r
+//	@param handler
+//	@return CommandHandler
+func (r *RBAC) GuardCommand(handler CommandHandler) CommandHandler {
+	return func(claims *auth.Claims, cmd int, body []byte) error {
+		if code := r.CheckCommand(claims, cmd); code != common.Success {
+			return common.NewError(code)
+		}
+		return handler(claims, cmd, body)
+	}
+}
@@ -0,0 +1,207 @@
+// @Author Eric
+// @Date 2026/10/22 10:00:00
+// @Desc 基于角色的权限检查，角色和权限从配置文件加载
+package rbac
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Kyle91/haven/auth"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Wildcard 拥有所有权限
+const Wildcard = "*"
+
+// RoleConfig 单个角色的配置
+type RoleConfig struct {
+	Inherits    []string `json:"inherits"`    // 继承的角色
+	Permissions []string `json:"permissions"` // 权限，支持 user.* 和 * 通配
+}
+
+// Config 权限配置文件格式
+//
+//	{
+//	  "default_role": "player",
+//	  "roles": {
+//	    "player":  {"permissions": ["game.play"]},
+//	    "support": {"inherits": ["player"], "permissions": ["user.view"]},
+//	    "gm":      {"inherits": ["support"], "permissions": ["user.*"]}
+//	  },
+//	  "commands": {"1000": "game.play"},
+//	  "allow_unconfigured": false
+//	}
+type Config struct {
+	DefaultRole       string                `json:"default_role"` // claims中没有角色时使用
+	Roles             map[string]RoleConfig `json:"roles"`
+	Commands          map[string]string     `json:"commands"`           // 命令字 -> 需要的权限
+	AllowUnconfigured bool                  `json:"allow_unconfigured"` // 没有配置权限的命令字是否允许执行，默认拒绝
+}
+
+// RBAC 权限检查
+type RBAC struct {
+	mu                sync.RWMutex
+	defaultRole       string
+	roles             map[string]map[string]struct{} // 角色 -> 展开继承后的权限
+	commands          map[int]string
+	allowUnconfigured bool
+}
+
+// Load 从json文件加载配置
+func Load(path string) (*RBAC, error) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg)
+}
+
+// New
+//
+//	@Description: 根据配置创建，展开角色继承，检查循环继承和未定义的角色
+//	@param cfg
+//	@return *RBAC
+//	@return error
+func New(cfg *Config) (*RBAC, error) {
+	r := &RBAC{}
+	if err := r.apply(cfg); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 重新加载配置，失败时保留原有配置
+func (r *RBAC) Reload(path string) error {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	return r.apply(cfg)
+}
+
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (r *RBAC) apply(cfg *Config) error {
+	if cfg.DefaultRole != "" {
+		if _, ok := cfg.Roles[cfg.DefaultRole]; !ok {
+			return fmt.Errorf("default role %s not defined", cfg.DefaultRole)
+		}
+	}
+
+	roles := make(map[string]map[string]struct{}, len(cfg.Roles))
+	for name := range cfg.Roles {
+		perms := make(map[string]struct{})
+		if err := collect(cfg, name, perms, map[string]bool{}); err != nil {
+			return err
+		}
+		roles[name] = perms
+	}
+
+	commands := make(map[int]string, len(cfg.Commands))
+	for k, perm := range cfg.Commands {
+		cmd, err := strconv.Atoi(k)
+		if err != nil {
+			return fmt.Errorf("invalid command id %s", k)
+		}
+		commands[cmd] = perm
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defaultRole, r.roles, r.commands = cfg.DefaultRole, roles, commands
+	r.allowUnconfigured = cfg.AllowUnconfigured
+	return nil
+}
+
+// collect 递归收集角色及其继承角色的权限
+func collect(cfg *Config, name string, perms map[string]struct{}, visiting map[string]bool) error {
+	role, ok := cfg.Roles[name]
+	if !ok {
+		return fmt.Errorf("role %s not defined", name)
+	}
+	if visiting[name] {
+		return fmt.Errorf("role %s has circular inheritance", name)
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	for _, p := range role.Permissions {
+		perms[p] = struct{}{}
+	}
+	for _, parent := range role.Inherits {
+		if err := collect(cfg, parent, perms, visiting); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Can
+//
+//	@Description: 检查claims中的角色是否拥有权限
+//	@receiver r
+//	@param claims
+//	@param permission 例如 user.ban
+//	@return bool
+func (r *RBAC) Can(claims *auth.Claims, permission string) bool {
+	if claims == nil {
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	roles := claims.Roles
+	if len(roles) == 0 && r.defaultRole != "" {
+		roles = []string{r.defaultRole}
+	}
+	for _, role := range roles {
+		if match(r.roles[role], permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// match 精确匹配，或者匹配 * 和 a.* 这样的前缀通配
+func match(perms map[string]struct{}, permission string) bool {
+	if _, ok := perms[permission]; ok {
+		return true
+	}
+	if _, ok := perms[Wildcard]; ok {
+		return true
+	}
+	for i := len(permission) - 1; i > 0; i-- {
+		if permission[i] == '.' {
+			if _, ok := perms[permission[:i]+".*"]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasRole claims中是否有指定角色
+func HasRole(claims *auth.Claims, role string) bool {
+	if claims == nil {
+		return false
+	}
+	for _, r := range claims.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+// @Author Eric
+// @Date 2026/10/29 16:30:00
+// @Desc 角色权限和命令字检查的测试
+package rbac
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Kyle91/haven/auth"
+	"github.com/Kyle91/haven/common"
+	"testing"
+)
+
+const testConfig = `{
+	"default_role": "player",
+	"roles": {
+		"player":  {"permissions": ["game.play"]},
+		"support": {"inherits": ["player"], "permissions": ["user.view"]},
+		"gm":      {"inherits": ["support"], "permissions": ["user.*"]},
+		"admin":   {"permissions": ["*"]}
+	},
+	"commands": {"1000": "game.play", "2000": "user.ban"}
+}`
+
+func newTestRBAC(t *testing.T, allowUnconfigured bool) *RBAC {
+	t.Helper()
+	var cfg Config
+	if err := json.Unmarshal([]byte(testConfig), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.AllowUnconfigured = allowUnconfigured
+	r, err := New(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestCan(t *testing.T) {
+	r := newTestRBAC(t, false)
+	tests := []struct {
+		name       string
+		claims     *auth.Claims
+		permission string
+		want       bool
+	}{
+		{"nil claims", nil, "game.play", false},
+		{"default role", &auth.Claims{}, "game.play", true},
+		{"default role lacks permission", &auth.Claims{}, "user.view", false},
+		{"inherited", &auth.Claims{Roles: []string{"gm"}}, "game.play", true},
+		{"prefix wildcard", &auth.Claims{Roles: []string{"gm"}}, "user.ban", true},
+		{"prefix wildcard nested", &auth.Claims{Roles: []string{"gm"}}, "user.ban.forever", true},
+		{"prefix wildcard other namespace", &auth.Claims{Roles: []string{"gm"}}, "shop.refund", false},
+		{"wildcard", &auth.Claims{Roles: []string{"admin"}}, "shop.refund", true},
+		{"unknown role", &auth.Claims{Roles: []string{"ghost"}}, "game.play", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Can(tt.claims, tt.permission); got != tt.want {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	player := &auth.Claims{}
+	gm := &auth.Claims{Roles: []string{"gm"}}
+	tests := []struct {
+		name              string
+		allowUnconfigured bool
+		claims            *auth.Claims
+		cmd               int
+		want              int
+	}{
+		{"configured allowed", false, player, 1000, common.Success},
+		{"configured denied", false, player, 2000, common.AuthFailed},
+		{"configured gm", false, gm, 2000, common.Success},
+		{"unconfigured denied by default", false, gm, 3000, common.AuthFailed},
+		{"unconfigured allowed explicitly", true, player, 3000, common.Success},
+		{"configured still checked", true, player, 2000, common.AuthFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRBAC(t, tt.allowUnconfigured)
+			if got := r.CheckCommand(tt.claims, tt.cmd); got != tt.want {
+				t.Fatalf("want %d, got %d", tt.want, got)
+			}
+		})
+	}
+
+	r := newTestRBAC(t, false)
+	r.SetCommandPermission(3000, "game.play")
+	if got := r.CheckCommand(player, 3000); got != common.Success {
+		t.Fatalf("SetCommandPermission: want %d, got %d", common.Success, got)
+	}
+}
+
+func TestGuardCommand(t *testing.T) {
+	r := newTestRBAC(t, false)
+	called := false
+	handler := r.GuardCommand(func(claims *auth.Claims, cmd int, body []byte) error {
+		called = true
+		return nil
+	})
+	var ce *common.Error
+	if err := handler(&auth.Claims{}, 2000, nil); !errors.As(err, &ce) || ce.Code != common.AuthFailed || called {
+		t.Fatalf("denied command reached handler: %v", err)
+	}
+	if err := handler(&auth.Claims{}, 1000, nil); err != nil || !called {
+		t.Fatalf("allowed command: %v", err)
+	}
+}
+
+func TestNewRejectsBadConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"undefined default role", Config{DefaultRole: "ghost"}},
+		{"undefined parent", Config{Roles: map[string]RoleConfig{"a": {Inherits: []string{"b"}}}}},
+		{"circular", Config{Roles: map[string]RoleConfig{"a": {Inherits: []string{"b"}}, "b": {Inherits: []string{"a"}}}}},
+		{"invalid command", Config{Commands: map[string]string{"login": "game.play"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(&tt.cfg); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
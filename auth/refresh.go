@@ -0,0 +1,181 @@
+// @Author Eric
+// @Date 2026/10/18 10:20:00
+// @Desc 刷新token，支持轮换和重用检测
+package auth
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/Kyle91/haven/crypto"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reused, token family revoked")
+)
+
+// TokenPair 一次签发的访问token和刷新token
+type TokenPair struct {
+	AccessToken   string `json:"access_token"`
+	AccessExpire  int64  `json:"access_expire"` // 访问token过期时间戳(秒)
+	RefreshToken  string `json:"refresh_token"`
+	RefreshExpire int64  `json:"refresh_expire"` // 刷新token过期时间戳(秒)
+}
+
+// RefreshManager 管理刷新token的签发和轮换
+// 每次刷新都会作废旧的刷新token并签发新的，同一次登录产生的刷新token属于同一个family，
+// 旧的刷新token被再次使用时，认为token已经泄露，整个family都会被吊销
+// 访问token中带有family ID，AuthToken 配置了吊销列表(WithRevocation)时，family签发的访问token也会一起吊销
+type RefreshManager struct {
+	auth       *AuthToken
+	store      RefreshStore
+	accessTTL  int64 // 访问token有效期(秒)
+	refreshTTL int64 // 刷新token有效期(秒)
+}
+
+// NewRefreshManager
+//
+//	@Description: 创建刷新token管理器
+//	@param auth 用于签发访问token
+//	@param store 刷新token存储
+//	@param accessTTL 访问token有效期(秒)
+//	@param refreshTTL 刷新token有效期(秒)
+//	@return *RefreshManager
+func NewRefreshManager(auth *AuthToken, store RefreshStore, accessTTL, refreshTTL int64) *RefreshManager {
+	return &RefreshManager{
+		auth:       auth,
+		store:      store,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// Issue
+//
+//	@Description: 登录成功后签发一对新的token，开启一个新的family
+//	@receiver m
+//	@param userID
+//	@return *TokenPair
+//	@return error
+func (m *RefreshManager) Issue(userID int64) (*TokenPair, error) {
+	familyID, err := generateRandomString()
+	if err != nil {
+		return nil, err
+	}
+	return m.issue(userID, familyID)
+}
+
+// Refresh
+//
+//	@Description: 使用刷新token换取新的一对token，旧的刷新token随即作废
+//	@receiver m
+//	@param refreshToken
+//	@return *TokenPair
+//	@return error 旧token被重复使用时返回 ErrRefreshTokenReused
+func (m *RefreshManager) Refresh(refreshToken string) (*TokenPair, error) {
+	record, err := m.store.Get(hashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, ErrRefreshNotFound) {
+			return nil, ErrRefreshTokenInvalid
+		}
+		return nil, err
+	}
+
+	if record.Used {
+		return nil, m.reused(record)
+	}
+	if m.auth.clock.Now().Unix() > record.ExpireAt {
+		return nil, ErrRefreshTokenExpired
+	}
+
+	// 标记已使用必须是原子的，并发刷新时只有一个请求能成功
+	ok, err := m.store.MarkUsed(record.TokenHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, m.reused(record)
+	}
+
+	return m.issue(record.UserID, record.FamilyID)
+}
+
+// Revoke
+//
+//	@Description: 注销，吊销刷新token所在的整个family，以及family签发的访问token
+//	@receiver m
+//	@param refreshToken
+//	@return error
+func (m *RefreshManager) Revoke(refreshToken string) error {
+	record, err := m.store.Get(hashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, ErrRefreshNotFound) {
+			return ErrRefreshTokenInvalid
+		}
+		return err
+	}
+	if err = m.store.RevokeFamily(record.FamilyID, record.ExpireAt); err != nil {
+		return err
+	}
+	return m.revokeAccess(record.FamilyID)
+}
+
+// reused 旧token被重复使用，吊销整个family和family签发的访问token
+func (m *RefreshManager) reused(record *RefreshRecord) error {
+	// family里最新的刷新token过期时间不会超过 now + refreshTTL
+	expireAt := m.auth.clock.Now().Unix() + m.refreshTTL
+	if err := m.store.RevokeFamily(record.FamilyID, expireAt); err != nil {
+		return err
+	}
+	if err := m.revokeAccess(record.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// revokeAccess 吊销family签发的访问token，没有配置吊销列表时只能等访问token自然过期
+func (m *RefreshManager) revokeAccess(familyID string) error {
+	if m.auth.revocation == nil {
+		return nil
+	}
+	// 已经签发的访问token最晚在 now + accessTTL 过期
+	return m.auth.revocation.RevokeFamily(familyID, m.auth.clock.Now().Unix()+m.accessTTL)
+}
+
+func (m *RefreshManager) issue(userID int64, familyID string) (*TokenPair, error) {
+	now := m.auth.clock.Now().Unix()
+
+	accessToken, err := m.auth.GenerateTokenWithClaims(&Claims{UserID: userID, FamilyID: familyID}, m.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	randBytes, err := crypto.GenerateRandomKey(32)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken := hex.EncodeToString(randBytes)
+
+	record := &RefreshRecord{
+		TokenHash: hashRefreshToken(refreshToken),
+		FamilyID:  familyID,
+		UserID:    userID,
+		ExpireAt:  now + m.refreshTTL,
+	}
+	if err = m.store.Save(record); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:   accessToken,
+		AccessExpire:  now + m.accessTTL,
+		RefreshToken:  refreshToken,
+		RefreshExpire: record.ExpireAt,
+	}, nil
+}
+
+// hashRefreshToken 存储中只保存刷新token的摘要，存储泄露时无法直接使用
+func hashRefreshToken(token string) string {
+	return crypto.SHA256([]byte(token))
+}
@@ -0,0 +1,253 @@
+// @Author Eric
+// @Date 2026/10/18 10:45:00
+// @Desc 刷新token的存储，内存实现和文件实现
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Kyle91/haven/clock"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	ErrRefreshNotFound      = errors.New("refresh token not found")
+	ErrRefreshFamilyRevoked = errors.New("refresh token family revoked")
+)
+
+// RefreshRecord 刷新token的存储记录
+type RefreshRecord struct {
+	TokenHash string `json:"token_hash"` // 刷新token的sha256，不保存明文
+	FamilyID  string `json:"family_id"`
+	UserID    int64  `json:"user_id"`
+	ExpireAt  int64  `json:"expire_at"` // 过期时间戳(秒)
+	Used      bool   `json:"used"`      // 是否已经被轮换过
+}
+
+// RefreshStore 刷新token存储接口
+type RefreshStore interface {
+	// Save 保存一条新记录，family已被吊销时返回 ErrRefreshFamilyRevoked
+	Save(record *RefreshRecord) error
+	// Get 查询记录，不存在时返回 ErrRefreshNotFound
+	Get(tokenHash string) (*RefreshRecord, error)
+	// MarkUsed 原子地把记录标记为已使用，记录之前已经被使用过则返回false
+	MarkUsed(tokenHash string) (bool, error)
+	// RevokeFamily 吊销整个family，expireAt之前该family不能再保存新记录
+	RevokeFamily(familyID string, expireAt int64) error
+}
+
+// MemoryRefreshStore 内存存储，进程重启后数据丢失
+type MemoryRefreshStore struct {
+	mu        sync.Mutex
+	records   map[string]*RefreshRecord
+	revoked   map[string]int64 // familyID -> 吊销记录的过期时间
+	lastPrune int64
+	clock     clock.Clock // 清理过期记录使用的时钟
+}
+
+// NewMemoryRefreshStore 创建内存存储
+func NewMemoryRefreshStore() *MemoryRefreshStore {
+	return &MemoryRefreshStore{
+		records: make(map[string]*RefreshRecord),
+		revoked: make(map[string]int64),
+		clock:   clock.System,
+	}
+}
+
+// WithClock 设置清理过期记录使用的时钟，需要和 RefreshManager 使用同一个时钟
+func (s *MemoryRefreshStore) WithClock(c clock.Clock) *MemoryRefreshStore {
+	s.clock = clock.OrDefault(c)
+	return s
+}
+
+func (s *MemoryRefreshStore) Save(record *RefreshRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked(s.clock.Now().Unix())
+	if _, ok := s.revoked[record.FamilyID]; ok {
+		return ErrRefreshFamilyRevoked
+	}
+	r := *record
+	s.records[r.TokenHash] = &r
+	return nil
+}
+
+func (s *MemoryRefreshStore) Get(tokenHash string) (*RefreshRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[tokenHash]
+	if !ok {
+		return nil, ErrRefreshNotFound
+	}
+	cp := *r
+	return &cp, nil
+}
+
+func (s *MemoryRefreshStore) MarkUsed(tokenHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[tokenHash]
+	if !ok {
+		return false, ErrRefreshNotFound
+	}
+	if r.Used {
+		return false, nil
+	}
+	r.Used = true
+	return true, nil
+}
+
+func (s *MemoryRefreshStore) RevokeFamily(familyID string, expireAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, r := range s.records {
+		if r.FamilyID == familyID {
+			delete(s.records, hash)
+		}
+	}
+	if expireAt > s.revoked[familyID] {
+		s.revoked[familyID] = expireAt
+	}
+	return nil
+}
+
+// pruneLocked 清理过期的记录，最多每分钟执行一次
+func (s *MemoryRefreshStore) pruneLocked(now int64) {
+	if now-s.lastPrune < 60 {
+		return
+	}
+	s.lastPrune = now
+	for hash, r := range s.records {
+		if now > r.ExpireAt {
+			delete(s.records, hash)
+		}
+	}
+	for familyID, expireAt := range s.revoked {
+		if now > expireAt {
+			delete(s.revoked, familyID)
+		}
+	}
+}
+
+// refreshSnapshot 文件存储的落盘格式
+type refreshSnapshot struct {
+	Records []*RefreshRecord `json:"records"`
+	Revoked map[string]int64 `json:"revoked"`
+}
+
+// FileRefreshStore 文件存储，每次修改后整体写入json文件
+// 适合单机部署、刷新频率不高的场景
+type FileRefreshStore struct {
+	mu   sync.Mutex
+	path string
+	mem  *MemoryRefreshStore
+}
+
+// NewFileRefreshStore
+//
+//	@Description: 创建文件存储，文件存在时加载已有数据
+//	@param path 数据文件路径
+//	@return *FileRefreshStore
+//	@return error
+func NewFileRefreshStore(path string) (*FileRefreshStore, error) {
+	s := &FileRefreshStore{
+		path: path,
+		mem:  NewMemoryRefreshStore(),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	var snap refreshSnapshot
+	if err = json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	for _, r := range snap.Records {
+		s.mem.records[r.TokenHash] = r
+	}
+	for familyID, expireAt := range snap.Revoked {
+		s.mem.revoked[familyID] = expireAt
+	}
+	return s, nil
+}
+
+// WithClock 设置清理过期记录使用的时钟，见 MemoryRefreshStore.WithClock
+func (s *FileRefreshStore) WithClock(c clock.Clock) *FileRefreshStore {
+	s.mem.WithClock(c)
+	return s
+}
+
+func (s *FileRefreshStore) Save(record *RefreshRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.Save(record); err != nil {
+		return err
+	}
+	return s.persist()
+}
+
+func (s *FileRefreshStore) Get(tokenHash string) (*RefreshRecord, error) {
+	return s.mem.Get(tokenHash)
+}
+
+func (s *FileRefreshStore) MarkUsed(tokenHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ok, err := s.mem.MarkUsed(tokenHash)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return true, s.persist()
+}
+
+func (s *FileRefreshStore) RevokeFamily(familyID string, expireAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.mem.RevokeFamily(familyID, expireAt); err != nil {
+		return err
+	}
+	return s.persist()
+}
+
+// persist 先写临时文件再重命名，避免写到一半进程退出导致文件损坏
+func (s *FileRefreshStore) persist() error {
+	s.mem.mu.Lock()
+	snap := refreshSnapshot{
+		Records: make([]*RefreshRecord, 0, len(s.mem.records)),
+		Revoked: make(map[string]int64, len(s.mem.revoked)),
+	}
+	for _, r := range s.mem.records {
+		snap.Records = append(snap.Records, r)
+	}
+	for familyID, expireAt := range s.mem.revoked {
+		snap.Revoked[familyID] = expireAt
+	}
+	data, err := json.Marshal(&snap)
+	s.mem.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,116 @@
+// @Author Eric
+// @Date 2026/10/29 10:00:00
+// @Desc 刷新token轮换和重用检测的测试
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/Kyle91/haven/clock"
+	"testing"
+	"time"
+)
+
+// testSecret 测试用的base64密钥
+var testSecret = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+func newTestRefreshManager(t *testing.T) (*RefreshManager, *AuthToken, *clock.MockClock) {
+	t.Helper()
+	clk := clock.NewMockClock(time.Unix(1700000000, 0))
+	a := NewAuthToken(testSecret, "salt", WithClock(clk), WithRevocation(NewMemoryRevocationStore(time.Hour).WithClock(clk)))
+	return NewRefreshManager(a, NewMemoryRefreshStore().WithClock(clk), 600, 3600), a, clk
+}
+
+func TestRefreshRotation(t *testing.T) {
+	m, a, _ := newTestRefreshManager(t)
+	pair, err := m.Issue(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := m.Refresh(pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.RefreshToken == pair.RefreshToken {
+		t.Fatal("refresh token not rotated")
+	}
+	claims, err := a.ParseClaims(next.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != 42 || claims.FamilyID == "" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
+
+func TestRefreshReuseRevokesAccessTokens(t *testing.T) {
+	m, a, _ := newTestRefreshManager(t)
+	pair, err := m.Issue(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := m.Refresh(pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 旧的刷新token被再次使用
+	if _, err = m.Refresh(pair.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err = m.Refresh(next.RefreshToken); err == nil {
+		t.Fatal("family not revoked")
+	}
+	for _, token := range []string{pair.AccessToken, next.AccessToken} {
+		if _, err = a.ParseClaims(token); !errors.Is(err, ErrTokenRevoked) {
+			t.Fatalf("access token still valid: %v", err)
+		}
+	}
+
+	// 其他family不受影响
+	other, err := m.Issue(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.ParseClaims(other.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefreshExpired(t *testing.T) {
+	m, _, clk := newTestRefreshManager(t)
+	pair, err := m.Issue(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk.Add(2 * time.Hour)
+	if _, err = m.Refresh(pair.RefreshToken); !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Fatalf("expected ErrRefreshTokenExpired, got %v", err)
+	}
+	if _, err = m.Refresh("unknown"); !errors.Is(err, ErrRefreshTokenInvalid) {
+		t.Fatalf("expected ErrRefreshTokenInvalid, got %v", err)
+	}
+}
+
+func TestMemoryRefreshStorePrune(t *testing.T) {
+	// 模拟时钟远早于系统时间，按系统时间清理会立即删掉吊销记录
+	clk := clock.NewMockClock(time.Unix(1700000000, 0))
+	s := NewMemoryRefreshStore().WithClock(clk)
+	if err := s.RevokeFamily("f1", clk.Now().Add(time.Hour).Unix()); err != nil {
+		t.Fatal(err)
+	}
+	clk.Add(30 * time.Minute)
+	if err := s.Save(&RefreshRecord{TokenHash: "h1", FamilyID: "f1"}); !errors.Is(err, ErrRefreshFamilyRevoked) {
+		t.Fatalf("want ErrRefreshFamilyRevoked, got %v", err)
+	}
+
+	clk.Add(time.Hour)
+	if err := s.Save(&RefreshRecord{TokenHash: "h2", FamilyID: "f1", ExpireAt: clk.Now().Add(time.Hour).Unix()}); err != nil {
+		t.Fatalf("revocation not pruned after expiry: %v", err)
+	}
+	clk.Add(2 * time.Hour)
+	s.Save(&RefreshRecord{TokenHash: "h3", ExpireAt: clk.Now().Add(time.Hour).Unix()})
+	if _, err := s.Get("h2"); !errors.Is(err, ErrRefreshNotFound) {
+		t.Fatalf("expired record not pruned: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+// @Author Eric
+// @Date 2026/10/23 15:00:00
+// @Desc 滑动续期，心跳时token已经使用了一定比例的有效期就签发新token，避免长时间在线的玩家被踢下线
+package auth
+
+import (
+	"github.com/Kyle91/haven/common"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultMaxLifetime 默认的最长会话时间，超过后需要重新登录
+const DefaultMaxLifetime = 7 * 24 * time.Hour
+
+// RenewOptions 滑动续期配置
+type RenewOptions struct {
+	TTL         time.Duration // 新token的有效期，默认和原token的有效期(ExpireAt-IssuedAt)相同
+	RenewAfter  float64       // token已使用的有效期比例超过该值才续期，默认0.5
+	MaxLifetime time.Duration // 从登录开始的最长会话时间，超过后不再续期，默认 DefaultMaxLifetime
+	MinInterval time.Duration // 同一用户同一设备两次续期的最小间隔，默认1分钟
+}
+
+// Renewer 滑动续期，在处理 common.CmdHeart 时调用 Heartbeat
+type Renewer struct {
+	auth *AuthToken
+	opts RenewOptions
+
+	mu        sync.Mutex
+	last      map[string]time.Time // 用户+设备 -> 上次续期时间
+	lastPrune time.Time
+}
+
+// NewRenewer
+//
+//	@Description: 创建滑动续期
+//	@param auth
+//	@param opts
+//	@return *Renewer
+func NewRenewer(auth *AuthToken, opts RenewOptions) *Renewer {
+	if opts.RenewAfter <= 0 || opts.RenewAfter > 1 {
+		opts.RenewAfter = 0.5
+	}
+	if opts.MinInterval <= 0 {
+		opts.MinInterval = time.Minute
+	}
+	// 续期后旧token仍然有效，不限制会话时间时泄露的token可以一直续期下去
+	if opts.MaxLifetime <= 0 {
+		opts.MaxLifetime = DefaultMaxLifetime
+	}
+	return &Renewer{auth: auth, opts: opts, last: make(map[string]time.Time)}
+}
+
+// Heartbeat
+//
+//	@Description: 校验心跳带上的token，需要续期时签发新token
+//	@receiver r
+//	@param token 当前token
+//	@param binding 当前请求的绑定信息，见 ParseClaims
+//	@return string 新token，不需要续期时为空字符串，客户端继续使用原token
+//	@return *Claims 新token的claims，没有续期时为原token的claims
+//	@return error token校验失败
+func (r *Renewer) Heartbeat(token string, binding ...*Binding) (string, *Claims, error) {
+	claims, err := r.auth.ParseClaims(token, binding...)
+	if err != nil {
+		return "", claims, err
+	}
+
+	now := r.auth.clock.Now()
+	ttl, ok := r.renewTTL(claims, now)
+	if !ok {
+		return "", claims, nil
+	}
+
+	// 限制续期频率，同一个旧token重复发心跳也只会续期一次
+	key := strconv.FormatInt(claims.UserID, 10) + ":" + claims.DeviceID
+	r.mu.Lock()
+	r.pruneLocked(now)
+	prev, renewed := r.last[key]
+	if renewed && now.Sub(prev) < r.opts.MinInterval {
+		r.mu.Unlock()
+		return "", claims, nil
+	}
+	// 先占住这次续期，并发的心跳不会重复签发，签发失败时恢复，不影响下次心跳重试
+	r.last[key] = now
+	r.mu.Unlock()
+
+	next := &Claims{
+		UserID:        claims.UserID,
+		DeviceID:      claims.DeviceID,
+		Roles:         claims.Roles,
+		AuthTime:      claims.AuthTime,
+		FamilyID:      claims.FamilyID,
+		BindDevice:    claims.BindDevice,
+		IPPrefix:      claims.IPPrefix,
+		KeyThumbprint: claims.KeyThumbprint,
+	}
+	newToken, err := r.auth.GenerateTokenWithClaims(next, ttl)
+	if err != nil {
+		r.mu.Lock()
+		if r.last[key].Equal(now) {
+			if renewed {
+				r.last[key] = prev
+			} else {
+				delete(r.last, key)
+			}
+		}
+		r.mu.Unlock()
+		return "", claims, err
+	}
+	return newToken, next, nil
+}
+
+// HandleCommand 只处理 common.CmdHeart，其他命令字直接返回
+func (r *Renewer) HandleCommand(cmd int, token string, binding ...*Binding) (string, *Claims, error) {
+	if cmd != common.CmdHeart {
+		return "", nil, nil
+	}
+	return r.Heartbeat(token, binding...)
+}
+
+// renewTTL 判断是否需要续期，返回新token的有效期(秒)
+func (r *Renewer) renewTTL(claims *Claims, now time.Time) (int64, bool) {
+	// 旧格式的token没有签发时间，无法计算使用比例和会话时间，不续期
+	if claims.IssuedAt == 0 || claims.ExpireAt <= claims.IssuedAt {
+		return 0, false
+	}
+
+	lifetime := claims.ExpireAt - claims.IssuedAt
+	if float64(now.Unix()-claims.IssuedAt) < float64(lifetime)*r.opts.RenewAfter {
+		return 0, false
+	}
+
+	ttl := r.opts.TTL
+	if ttl <= 0 {
+		ttl = time.Duration(lifetime) * time.Second
+	}
+	expireAt := now.Add(ttl).Unix()
+	if limit := time.Unix(claims.AuthTime, 0).Add(r.opts.MaxLifetime).Unix(); expireAt > limit {
+		expireAt = limit
+	}
+	// 新token不能比原token更晚过期时，续期没有意义
+	if expireAt <= claims.ExpireAt {
+		return 0, false
+	}
+	return expireAt - now.Unix(), true
+}
+
+// pruneLocked 清理已经超过续期间隔的记录，最多每分钟执行一次
+func (r *Renewer) pruneLocked(now time.Time) {
+	if now.Sub(r.lastPrune) < time.Minute {
+		return
+	}
+	r.lastPrune = now
+	for key, t := range r.last {
+		if now.Sub(t) >= r.opts.MinInterval {
+			delete(r.last, key)
+		}
+	}
+}
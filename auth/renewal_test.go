@@ -0,0 +1,138 @@
+// @Author Eric
+// @Date 2026/10/29 17:30:00
+// @Desc 滑动续期的测试
+package auth
+
+import (
+	"errors"
+	"github.com/Kyle91/haven/clock"
+	"github.com/Kyle91/haven/common"
+	"testing"
+	"time"
+)
+
+func TestRenewerHeartbeat(t *testing.T) {
+	const issued = 1700000000
+	tests := []struct {
+		name       string
+		opts       RenewOptions
+		elapsed    time.Duration
+		wantExpire int64 // 0表示不续期
+	}{
+		{"too early", RenewOptions{}, 20 * time.Minute, 0},
+		{"default ttl is original lifetime", RenewOptions{}, 40 * time.Minute, issued + 40*60 + 3600},
+		{"explicit ttl", RenewOptions{TTL: 2 * time.Hour}, 40 * time.Minute, issued + 40*60 + 7200},
+		{"renew after", RenewOptions{RenewAfter: 0.9}, 40 * time.Minute, 0},
+		{"capped by max lifetime", RenewOptions{MaxLifetime: 90 * time.Minute}, 40 * time.Minute, issued + 90*60},
+		{"max lifetime reached", RenewOptions{MaxLifetime: time.Hour}, 40 * time.Minute, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewMockClock(time.Unix(issued, 0))
+			a := NewAuthToken(testSecret, "salt", WithClock(clk))
+			token, err := a.GenerateTokenWithClaims(&Claims{UserID: 1, DeviceID: "d1", Roles: []string{"gm"}}, 3600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			clk.Add(tt.elapsed)
+
+			newToken, claims, err := NewRenewer(a, tt.opts).Heartbeat(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantExpire == 0 {
+				if newToken != "" {
+					t.Fatalf("unexpected renewal, expire at %d", claims.ExpireAt)
+				}
+				return
+			}
+			if newToken == "" {
+				t.Fatal("token not renewed")
+			}
+			parsed, err := a.ParseClaims(newToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.ExpireAt != tt.wantExpire {
+				t.Fatalf("want expire at %d, got %d", tt.wantExpire, parsed.ExpireAt)
+			}
+			// 续期保留登录时间和身份信息
+			if parsed.AuthTime != issued || parsed.UserID != 1 || parsed.DeviceID != "d1" || len(parsed.Roles) != 1 {
+				t.Fatalf("unexpected claims %+v", parsed)
+			}
+		})
+	}
+}
+
+func TestRenewerMinInterval(t *testing.T) {
+	clk := clock.NewMockClock(time.Unix(1700000000, 0))
+	a := NewAuthToken(testSecret, "salt", WithClock(clk))
+	r := NewRenewer(a, RenewOptions{})
+	token, err := a.GenerateTokenWithClaims(&Claims{UserID: 1, DeviceID: "d1"}, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := a.GenerateTokenWithClaims(&Claims{UserID: 1, DeviceID: "d2"}, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk.Add(6 * time.Minute)
+
+	first, _, err := r.Heartbeat(token)
+	if err != nil || first == "" {
+		t.Fatalf("first heartbeat: %v", err)
+	}
+	// 同一个旧token重复发心跳，间隔内不再签发
+	if again, _, _ := r.Heartbeat(token); again != "" {
+		t.Fatal("renewed twice within min interval")
+	}
+	// 其他设备不受影响
+	if renewed, _, _ := r.Heartbeat(other); renewed == "" {
+		t.Fatal("other device not renewed")
+	}
+
+	clk.Add(time.Minute)
+	if again, _, _ := r.Heartbeat(token); again == "" {
+		t.Fatal("not renewed after min interval")
+	}
+	if renewed, claims, err := r.HandleCommand(common.CmdLogin, token); renewed != "" || claims != nil || err != nil {
+		t.Fatal("non heartbeat command handled")
+	}
+}
+
+func TestRenewerDefaultMaxLifetime(t *testing.T) {
+	const issued = 1700000000
+	clk := clock.NewMockClock(time.Unix(issued, 0))
+	a := NewAuthToken(testSecret, "salt", WithClock(clk))
+	r := NewRenewer(a, RenewOptions{})
+	token, err := a.GenerateTokenWithClaims(&Claims{UserID: 1, DeviceID: "d1"}, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 一直在线，每40分钟心跳一次并使用续期后的token
+	limit := int64(issued + DefaultMaxLifetime/time.Second)
+	var expireAt int64
+	for i := 0; ; i++ {
+		if i > 1000 {
+			t.Fatal("renewal never stopped")
+		}
+		clk.Add(40 * time.Minute)
+		newToken, claims, err := r.Heartbeat(token)
+		if err != nil {
+			break
+		}
+		if claims.ExpireAt > limit {
+			t.Fatalf("renewed past max lifetime: %d > %d", claims.ExpireAt, limit)
+		}
+		if newToken != "" {
+			token, expireAt = newToken, claims.ExpireAt
+		}
+	}
+	if expireAt != limit {
+		t.Fatalf("want last renewal to expire at %d, got %d", limit, expireAt)
+	}
+	if _, err = a.ParseClaims(token); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("want ErrTokenExpired after max lifetime, got %v", err)
+	}
+}
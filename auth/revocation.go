@@ -0,0 +1,153 @@
+// @Author Eric
+// @Date 2026/10/18 14:10:00
+// @Desc token吊销列表
+package auth
+
+import (
+	"github.com/Kyle91/haven/clock"
+	"sync"
+	"time"
+)
+
+// RevocationStore token吊销列表接口
+type RevocationStore interface {
+	// RevokeToken 按token ID吊销，expireAt为token本身的过期时间，之后记录可以清理
+	RevokeToken(tokenID string, expireAt int64) error
+	// RevokeUser 吊销该用户在before之前签发的所有token，before一般为吊销的时间，这一秒签发的token不吊销
+	RevokeUser(userID int64, before int64) error
+	// RevokeDevice 吊销该设备在before之前签发的所有token，同 RevokeUser
+	RevokeDevice(deviceID string, before int64) error
+	// RevokeFamily 吊销刷新token family签发的所有访问token，expireAt为其中最晚的过期时间，之后记录可以清理
+	RevokeFamily(familyID string, expireAt int64) error
+	// IsRevoked 检查token是否已被吊销
+	IsRevoked(claims *Claims) (bool, error)
+}
+
+// MemoryRevocationStore 内存吊销列表，过期的记录会被定期清理
+type MemoryRevocationStore struct {
+	mu        sync.RWMutex
+	maxTTL    int64            // 签发token的最长有效期(秒)，用户、设备吊销记录保留这么久
+	tokens    map[string]int64 // tokenID -> token过期时间
+	users     map[int64]int64  // userID -> 在此之前签发的token无效
+	devices   map[string]int64 // deviceID -> 在此之前签发的token无效
+	families  map[string]int64 // familyID -> 该family签发的token的最晚过期时间
+	lastPrune int64
+	clock     clock.Clock // 清理过期记录使用的时钟
+}
+
+// NewMemoryRevocationStore
+//
+//	@Description: 创建内存吊销列表
+//	@param maxTTL 签发token的最长有效期，超过这个时间的用户、设备吊销记录已经没有意义，会被清理
+//	@return *MemoryRevocationStore
+func NewMemoryRevocationStore(maxTTL time.Duration) *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		maxTTL:   int64(maxTTL / time.Second),
+		tokens:   make(map[string]int64),
+		users:    make(map[int64]int64),
+		devices:  make(map[string]int64),
+		families: make(map[string]int64),
+		clock:    clock.System,
+	}
+}
+
+// WithClock 设置清理过期记录使用的时钟，需要和签发token的 AuthToken 使用同一个时钟
+func (s *MemoryRevocationStore) WithClock(c clock.Clock) *MemoryRevocationStore {
+	s.clock = clock.OrDefault(c)
+	return s
+}
+
+func (s *MemoryRevocationStore) RevokeToken(tokenID string, expireAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked(s.clock.Now().Unix())
+	s.tokens[tokenID] = expireAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeUser(userID int64, before int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked(s.clock.Now().Unix())
+	if before > s.users[userID] {
+		s.users[userID] = before
+	}
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeDevice(deviceID string, before int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked(s.clock.Now().Unix())
+	if before > s.devices[deviceID] {
+		s.devices[deviceID] = before
+	}
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeFamily(familyID string, expireAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked(s.clock.Now().Unix())
+	if expireAt > s.families[familyID] {
+		s.families[familyID] = expireAt
+	}
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(claims *Claims) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.tokens[claims.TokenID]; ok {
+		return true, nil
+	}
+	if claims.FamilyID != "" {
+		if _, ok := s.families[claims.FamilyID]; ok {
+			return true, nil
+		}
+	}
+	// 签发时间早于吊销时间的都算吊销，旧格式token的签发时间为0
+	// 签发时间只精确到秒，吊销的同一秒签发的token不吊销，避免"退出所有设备"后立即登录拿到的token失效
+	if before, ok := s.users[claims.UserID]; ok && claims.IssuedAt < before {
+		return true, nil
+	}
+	if claims.DeviceID != "" {
+		if before, ok := s.devices[claims.DeviceID]; ok && claims.IssuedAt < before {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// pruneLocked 清理过期的记录，最多每分钟执行一次
+func (s *MemoryRevocationStore) pruneLocked(now int64) {
+	if now-s.lastPrune < 60 {
+		return
+	}
+	s.lastPrune = now
+	for tokenID, expireAt := range s.tokens {
+		if now > expireAt {
+			delete(s.tokens, tokenID)
+		}
+	}
+	for familyID, expireAt := range s.families {
+		if now > expireAt {
+			delete(s.families, familyID)
+		}
+	}
+	for userID, before := range s.users {
+		if now > before+s.maxTTL {
+			delete(s.users, userID)
+		}
+	}
+	for deviceID, before := range s.devices {
+		if now > before+s.maxTTL {
+			delete(s.devices, deviceID)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// @Author Eric
+// @Date 2026/10/18 14:40:00
+// @Desc 通过mq在节点间同步token吊销
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Kyle91/haven/common"
+	"github.com/Kyle91/haven/log"
+	"github.com/Kyle91/haven/mq"
+	"github.com/streadway/amqp"
+)
+
+// 吊销类型
+const (
+	RevokeTypeToken  = "token"
+	RevokeTypeUser   = "user"
+	RevokeTypeDevice = "device"
+	RevokeTypeFamily = "family"
+)
+
+// RevocationEvent 节点间广播的吊销事件
+type RevocationEvent struct {
+	Type     string `json:"type"`
+	TokenID  string `json:"token_id,omitempty"`
+	UserID   int64  `json:"user_id,omitempty"`
+	DeviceID string `json:"device_id,omitempty"`
+	FamilyID string `json:"family_id,omitempty"`
+	Time     int64  `json:"time"`   // token、family吊销时为过期时间，用户、设备吊销时为吊销的截止签发时间
+	Origin   string `json:"origin"` // 发起吊销的节点ID
+}
+
+// RevocationSync 包装一个本地吊销列表，本地吊销后通过mq广播给其他节点
+// 本身也实现了 RevocationStore，可以直接传给 WithRevocation
+type RevocationSync struct {
+	store  RevocationStore
+	client *mq.MQClient
+	nodeID string
+}
+
+// NewRevocationSync
+//
+//	@Description: 创建吊销同步器
+//	@param store 本地吊销列表
+//	@param client mq客户端
+//	@param nodeID 节点ID，需要保持稳定，每个节点会有一个独立的持久化队列
+//	@return *RevocationSync
+func NewRevocationSync(store RevocationStore, client *mq.MQClient, nodeID string) *RevocationSync {
+	return &RevocationSync{
+		store:  store,
+		client: client,
+		nodeID: nodeID,
+	}
+}
+
+// Start
+//
+//	@Description: 订阅其他节点的吊销广播
+//	@receiver s
+//	@return error
+func (s *RevocationSync) Start() error {
+	return s.client.Subscribe(s.queueName(), common.AuthRevokeBindingKey, s.handle)
+}
+
+func (s *RevocationSync) RevokeToken(tokenID string, expireAt int64) error {
+	if err := s.store.RevokeToken(tokenID, expireAt); err != nil {
+		return err
+	}
+	return s.publish(&RevocationEvent{Type: RevokeTypeToken, TokenID: tokenID, Time: expireAt})
+}
+
+func (s *RevocationSync) RevokeUser(userID int64, before int64) error {
+	if err := s.store.RevokeUser(userID, before); err != nil {
+		return err
+	}
+	return s.publish(&RevocationEvent{Type: RevokeTypeUser, UserID: userID, Time: before})
+}
+
+func (s *RevocationSync) RevokeDevice(deviceID string, before int64) error {
+	if err := s.store.RevokeDevice(deviceID, before); err != nil {
+		return err
+	}
+	return s.publish(&RevocationEvent{Type: RevokeTypeDevice, DeviceID: deviceID, Time: before})
+}
+
+func (s *RevocationSync) RevokeFamily(familyID string, expireAt int64) error {
+	if err := s.store.RevokeFamily(familyID, expireAt); err != nil {
+		return err
+	}
+	return s.publish(&RevocationEvent{Type: RevokeTypeFamily, FamilyID: familyID, Time: expireAt})
+}
+
+func (s *RevocationSync) IsRevoked(claims *Claims) (bool, error) {
+	return s.store.IsRevoked(claims)
+}
+
+func (s *RevocationSync) publish(event *RevocationEvent) error {
+	event.Origin = s.nodeID
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.client.Publish(fmt.Sprintf(common.AuthRevokeRoutingKey, s.nodeID), s.queueName(), data)
+}
+
+// handle 处理其他节点的吊销广播，只写入本地，不再转发
+func (s *RevocationSync) handle(d amqp.Delivery) {
+	var event RevocationEvent
+	if err := json.Unmarshal(d.Body, &event); err != nil {
+		log.Errorf("invalid revocation event: %v", err)
+		return
+	}
+	if event.Origin == s.nodeID {
+		return
+	}
+
+	var err error
+	switch event.Type {
+	case RevokeTypeToken:
+		err = s.store.RevokeToken(event.TokenID, event.Time)
+	case RevokeTypeUser:
+		err = s.store.RevokeUser(event.UserID, event.Time)
+	case RevokeTypeDevice:
+		err = s.store.RevokeDevice(event.DeviceID, event.Time)
+	case RevokeTypeFamily:
+		err = s.store.RevokeFamily(event.FamilyID, event.Time)
+	default:
+		log.Warnf("unknown revocation type: %s", event.Type)
+		return
+	}
+	if err != nil {
+		log.Errorf("apply revocation event failed: %v", err)
+	}
+}
+
+func (s *RevocationSync) queueName() string {
+	return fmt.Sprintf(common.AuthRevokeQueue, s.nodeID)
+}
@@ -0,0 +1,139 @@
+// @Author Eric
+// @Date 2026/10/30 10:00:00
+// @Desc 注销和按用户、设备吊销token的测试
+package auth
+
+import (
+	"errors"
+	"github.com/Kyle91/haven/clock"
+	"testing"
+	"time"
+)
+
+func newTestRevocation(t *testing.T) (*AuthToken, *MemoryRevocationStore, *clock.MockClock) {
+	t.Helper()
+	clk := clock.NewMockClock(time.Unix(1700000000, 0))
+	store := NewMemoryRevocationStore(time.Hour).WithClock(clk)
+	return NewAuthToken(testSecret, "salt", WithClock(clk), WithRevocation(store)), store, clk
+}
+
+func issueToken(t *testing.T, a *AuthToken, claims Claims) string {
+	t.Helper()
+	token, err := a.GenerateTokenWithClaims(&claims, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestLogout(t *testing.T) {
+	a, _, _ := newTestRevocation(t)
+	token := issueToken(t, a, Claims{UserID: 42})
+	other := issueToken(t, a, Claims{UserID: 42})
+
+	if err := a.Logout(token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ParseClaims(token); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("want ErrTokenRevoked, got %v", err)
+	}
+	// 只吊销注销的token，同一用户的其他token不受影响
+	if _, err := a.ParseClaims(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Logout("not a token"); err == nil {
+		t.Fatal("expected error for malformed token")
+	}
+	if err := NewAuthToken(testSecret, "salt").Logout(other); err == nil {
+		t.Fatal("expected error without revocation store")
+	}
+}
+
+func TestRevokeUserAndDevice(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(s *MemoryRevocationStore, before int64) error
+		target Claims
+		other  Claims
+	}{
+		{
+			"user",
+			func(s *MemoryRevocationStore, before int64) error { return s.RevokeUser(42, before) },
+			Claims{UserID: 42, DeviceID: "phone"},
+			Claims{UserID: 7, DeviceID: "phone"},
+		},
+		{
+			"device",
+			func(s *MemoryRevocationStore, before int64) error { return s.RevokeDevice("phone", before) },
+			Claims{UserID: 42, DeviceID: "phone"},
+			Claims{UserID: 42, DeviceID: "laptop"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, store, clk := newTestRevocation(t)
+			old := issueToken(t, a, tt.target)
+			other := issueToken(t, a, tt.other)
+
+			clk.Add(10 * time.Second)
+			sameSecond := issueToken(t, a, tt.target)
+			if err := tt.revoke(store, clk.Now().Unix()); err != nil {
+				t.Fatal(err)
+			}
+			// 吊销之后立即重新登录，签发时间和吊销时间在同一秒
+			relogin := issueToken(t, a, tt.target)
+
+			if _, err := a.ParseClaims(old); !errors.Is(err, ErrTokenRevoked) {
+				t.Fatalf("old token: want ErrTokenRevoked, got %v", err)
+			}
+			for name, token := range map[string]string{"other": other, "same second": sameSecond, "relogin": relogin} {
+				if _, err := a.ParseClaims(token); err != nil {
+					t.Fatalf("%s token: %v", name, err)
+				}
+			}
+
+			// 更早的截止时间不会覆盖已有的吊销
+			if err := tt.revoke(store, 0); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := a.ParseClaims(old); !errors.Is(err, ErrTokenRevoked) {
+				t.Fatalf("old token: want ErrTokenRevoked, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMemoryRevocationStorePrune(t *testing.T) {
+	// 模拟时钟远早于系统时间，按系统时间清理会立即删掉吊销记录
+	clk := clock.NewMockClock(time.Unix(1700000000, 0))
+	s := NewMemoryRevocationStore(time.Hour).WithClock(clk)
+	now := clk.Now().Unix()
+	s.RevokeToken("t1", now+600)
+	s.RevokeFamily("f1", now+600)
+	s.RevokeUser(42, now)
+	s.RevokeDevice("phone", now)
+
+	revoked := map[string]*Claims{
+		"token":  {TokenID: "t1"},
+		"family": {TokenID: "t2", FamilyID: "f1"},
+		"user":   {TokenID: "t3", UserID: 42, IssuedAt: now - 1},
+		"device": {TokenID: "t4", DeviceID: "phone", IssuedAt: now - 1},
+	}
+	check := func(want bool) {
+		t.Helper()
+		for name, claims := range revoked {
+			if got, _ := s.IsRevoked(claims); got != want {
+				t.Fatalf("%s: want revoked %v, got %v", name, want, got)
+			}
+		}
+	}
+
+	clk.Add(2 * time.Minute)
+	s.RevokeToken("other", clk.Now().Unix()+600)
+	check(true)
+
+	// token过期、超过maxTTL之后的记录已经没有意义
+	clk.Add(2 * time.Hour)
+	s.RevokeToken("other", clk.Now().Unix()+600)
+	check(false)
+}
@@ -0,0 +1,355 @@
+// @Author Eric
+// @Date 2026/10/19 15:00:00
+// @Desc 会话管理，限制同时在线数，心跳超时自动过期，踢人事件通知网关
+package session
+
+import (
+	"encoding/hex"
+	"github.com/Kyle91/haven/clock"
+	"github.com/Kyle91/haven/common"
+	"github.com/Kyle91/haven/crypto"
+	"github.com/Kyle91/haven/log"
+	"github.com/Kyle91/haven/routine"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Policy 超过同时在线数时的处理策略
+type Policy int
+
+const (
+	KickOldest Policy = iota // 踢掉最早登录的会话
+	RejectNew                // 拒绝新的登录
+)
+
+// KickReason 会话被踢的原因
+type KickReason int
+
+const (
+	KickByNewLogin KickReason = iota + 1 // 超过同时在线数，被新登录挤下线
+	KickByReplace                        // 同一设备重复登录
+	KickByTimeout                        // 心跳超时
+	KickByAdmin                          // 被管理员踢下线
+)
+
+func (r KickReason) String() string {
+	switch r {
+	case KickByNewLogin:
+		return "new_login"
+	case KickByReplace:
+		return "replace"
+	case KickByTimeout:
+		return "timeout"
+	case KickByAdmin:
+		return "admin"
+	default:
+		return "unknown"
+	}
+}
+
+// Session 一个在线会话
+type Session struct {
+	ID            string
+	UserID        int64
+	DeviceID      string
+	Node          string // 所在的网关节点
+	LoginAt       time.Time
+	LastHeartbeat time.Time
+}
+
+// KickEvent 踢人事件，网关根据 Session.Node 判断是否是自己的连接
+type KickEvent struct {
+	Session Session
+	Reason  KickReason
+}
+
+// Options 会话管理配置
+type Options struct {
+	MaxSessions      int           // 每个用户最大同时在线数，0表示不限制
+	Policy           Policy        // 超过同时在线数时的处理策略
+	HeartbeatTimeout time.Duration // 心跳超时时间，0表示不过期
+	Clock            clock.Clock   // 时钟，默认系统时钟
+	OnKick           func(KickEvent)
+}
+
+// Manager 会话管理器
+type Manager struct {
+	mu       sync.Mutex
+	opts     Options
+	sessions map[string]*Session
+	users    map[int64][]*Session // 按登录时间排序
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewManager 创建会话管理器
+func NewManager(opts Options) *Manager {
+	opts.Clock = clock.OrDefault(opts.Clock)
+	return &Manager{
+		opts:     opts,
+		sessions: make(map[string]*Session),
+		users:    make(map[int64][]*Session),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Login
+//
+//	@Description: 创建会话，同一设备已有会话时替换旧会话
+//	@receiver m
+//	@param userID
+//	@param deviceID
+//	@param node 网关节点
+//	@return *Session
+//	@return error 策略为 RejectNew 且超过同时在线数时返回 common.LimitReached
+func (m *Manager) Login(userID int64, deviceID, node string) (*Session, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.opts.Clock.Now()
+	s := &Session{
+		ID:            id,
+		UserID:        userID,
+		DeviceID:      deviceID,
+		Node:          node,
+		LoginAt:       now,
+		LastHeartbeat: now,
+	}
+
+	var kicked []KickEvent
+	m.mu.Lock()
+	list := m.users[userID]
+	for _, old := range list {
+		if deviceID != "" && old.DeviceID == deviceID {
+			m.removeLocked(old)
+			kicked = append(kicked, KickEvent{Session: *old, Reason: KickByReplace})
+			break
+		}
+	}
+
+	if m.opts.MaxSessions > 0 {
+		list = m.users[userID]
+		if len(list) >= m.opts.MaxSessions && m.opts.Policy == RejectNew {
+			m.mu.Unlock()
+			m.emit(kicked)
+			return nil, common.NewError(common.LimitReached)
+		}
+		for len(list) >= m.opts.MaxSessions {
+			oldest := list[0]
+			m.removeLocked(oldest)
+			kicked = append(kicked, KickEvent{Session: *oldest, Reason: KickByNewLogin})
+			list = m.users[userID]
+		}
+	}
+
+	m.sessions[s.ID] = s
+	m.users[userID] = append(m.users[userID], s)
+	result := *s
+	m.mu.Unlock()
+
+	m.emit(kicked)
+	return &result, nil
+}
+
+// Heartbeat
+//
+//	@Description: 刷新会话的心跳时间
+//	@receiver m
+//	@param sessionID
+//	@return error 会话不存在时返回 common.NotExist
+func (m *Manager) Heartbeat(sessionID string) error {
+	now := m.opts.Clock.Now()
+
+	m.mu.Lock()
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		m.mu.Unlock()
+		return common.NewError(common.NotExist)
+	}
+	// 已经超时但还没被清理的会话不能再续上
+	if m.opts.HeartbeatTimeout > 0 && s.LastHeartbeat.Before(now.Add(-m.opts.HeartbeatTimeout)) {
+		m.removeLocked(s)
+		m.mu.Unlock()
+		m.emit([]KickEvent{{Session: *s, Reason: KickByTimeout}})
+		return common.NewError(common.NotExist)
+	}
+	s.LastHeartbeat = now
+	m.mu.Unlock()
+	return nil
+}
+
+// Logout 主动下线，不触发踢人事件
+func (m *Manager) Logout(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sessions[sessionID]; ok {
+		m.removeLocked(s)
+	}
+}
+
+// Kick 踢掉指定会话
+func (m *Manager) Kick(sessionID string) bool {
+	m.mu.Lock()
+	s, ok := m.sessions[sessionID]
+	if ok {
+		m.removeLocked(s)
+	}
+	m.mu.Unlock()
+
+	if ok {
+		m.emit([]KickEvent{{Session: *s, Reason: KickByAdmin}})
+	}
+	return ok
+}
+
+// KickUser 踢掉用户的所有会话，返回被踢的数量
+func (m *Manager) KickUser(userID int64) int {
+	m.mu.Lock()
+	list := m.users[userID]
+	kicked := make([]KickEvent, 0, len(list))
+	for _, s := range list {
+		kicked = append(kicked, KickEvent{Session: *s, Reason: KickByAdmin})
+	}
+	for _, s := range list {
+		m.removeLocked(s)
+	}
+	m.mu.Unlock()
+
+	m.emit(kicked)
+	return len(kicked)
+}
+
+// Get 获取会话
+func (m *Manager) Get(sessionID string) (*Session, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, false
+	}
+	result := *s
+	return &result, true
+}
+
+// Sessions 获取用户的所有在线会话，按登录时间排序
+func (m *Manager) Sessions(userID int64) []Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := m.users[userID]
+	result := make([]Session, 0, len(list))
+	for _, s := range list {
+		result = append(result, *s)
+	}
+	return result
+}
+
+// Count 当前在线会话数
+func (m *Manager) Count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// ExpireIdle 清理心跳超时的会话，返回清理的数量
+func (m *Manager) ExpireIdle() int {
+	if m.opts.HeartbeatTimeout <= 0 {
+		return 0
+	}
+
+	deadline := m.opts.Clock.Now().Add(-m.opts.HeartbeatTimeout)
+	var kicked []KickEvent
+
+	m.mu.Lock()
+	for _, s := range m.sessions {
+		if s.LastHeartbeat.Before(deadline) {
+			kicked = append(kicked, KickEvent{Session: *s, Reason: KickByTimeout})
+		}
+	}
+	for i := range kicked {
+		m.removeLocked(m.sessions[kicked[i].Session.ID])
+	}
+	m.mu.Unlock()
+
+	// 按登录时间通知，方便调用方观察
+	sort.Slice(kicked, func(i, j int) bool {
+		return kicked[i].Session.LoginAt.Before(kicked[j].Session.LoginAt)
+	})
+	m.emit(kicked)
+	return len(kicked)
+}
+
+// Start
+//
+//	@Description: 启动后台协程，定期清理心跳超时的会话
+//	@receiver m
+//	@param interval 检查间隔，按 Options.Clock 计时
+func (m *Manager) Start(interval time.Duration) {
+	ticker := m.opts.Clock.NewTicker(interval)
+	routine.Go(func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C():
+				m.ExpireIdle()
+			case <-m.stop:
+				return
+			}
+		}
+	})
+}
+
+// Stop 停止后台清理
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+}
+
+// removeLocked 从索引中删除会话，调用方需要持有锁
+func (m *Manager) removeLocked(s *Session) {
+	delete(m.sessions, s.ID)
+	list := m.users[s.UserID]
+	for i, v := range list {
+		if v == s {
+			list = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(m.users, s.UserID)
+	} else {
+		m.users[s.UserID] = list
+	}
+}
+
+// emit 在锁外通知踢人事件，回调里的panic不影响会话管理
+func (m *Manager) emit(events []KickEvent) {
+	if m.opts.OnKick == nil {
+		return
+	}
+	for _, e := range events {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					log.Errorf("session kick handler panic: %v", err)
+				}
+			}()
+			m.opts.OnKick(e)
+		}()
+	}
+}
+
+func newSessionID() (string, error) {
+	b, err := crypto.GenerateRandomKey(16)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
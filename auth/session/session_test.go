@@ -0,0 +1,212 @@
+// @Author Eric
+// @Date 2026/10/30 11:30:00
+// @Desc 会话管理的测试
+package session
+
+import (
+	"github.com/Kyle91/haven/clock"
+	"github.com/Kyle91/haven/common"
+	"sync"
+	"testing"
+	"time"
+)
+
+// kickRecorder 记录踢人事件，后台清理时在其他协程中回调
+type kickRecorder struct {
+	mu     sync.Mutex
+	events []KickEvent
+}
+
+func (r *kickRecorder) OnKick(e KickEvent) {
+	r.mu.Lock()
+	r.events = append(r.events, e)
+	r.mu.Unlock()
+}
+
+func (r *kickRecorder) Events() []KickEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]KickEvent(nil), r.events...)
+}
+
+func newTestManager(opts Options) (*Manager, *clock.MockClock, *kickRecorder) {
+	clk := clock.NewMockClock(time.Unix(1700000000, 0))
+	rec := &kickRecorder{}
+	opts.Clock = clk
+	opts.OnKick = rec.OnKick
+	return NewManager(opts), clk, rec
+}
+
+func TestMaxSessions(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    Policy
+		wantErr   bool
+		wantKick  int // 被踢的第几个会话，-1表示没有
+		wantCount int
+	}{
+		{"kick oldest", KickOldest, false, 0, 2},
+		{"reject new", RejectNew, true, -1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, clk, rec := newTestManager(Options{MaxSessions: 2, Policy: tt.policy})
+			var ids []string
+			for _, device := range []string{"d1", "d2"} {
+				s, err := m.Login(1, device, "gw1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, s.ID)
+				clk.Add(time.Second)
+			}
+			// 其他用户不占用名额
+			if _, err := m.Login(2, "d1", "gw1"); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := m.Login(1, "d3", "gw2")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("want error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil && common.GetErrorCode(err, 0) != common.LimitReached {
+				t.Fatalf("want LimitReached, got %v", err)
+			}
+			events := rec.Events()
+			if tt.wantKick < 0 {
+				if len(events) != 0 {
+					t.Fatalf("unexpected kicks %v", events)
+				}
+			} else if len(events) != 1 || events[0].Session.ID != ids[tt.wantKick] || events[0].Reason != KickByNewLogin {
+				t.Fatalf("want session %d kicked by new login, got %v", tt.wantKick, events)
+			}
+			if n := len(m.Sessions(1)); n != tt.wantCount {
+				t.Fatalf("want %d sessions, got %d", tt.wantCount, n)
+			}
+
+			// 同一设备重复登录替换旧会话，不受上限影响
+			if _, err = m.Login(1, "d2", "gw2"); err != nil {
+				t.Fatal(err)
+			}
+			events = rec.Events()
+			if last := events[len(events)-1]; last.Session.ID != ids[1] || last.Reason != KickByReplace {
+				t.Fatalf("want d2 replaced, got %v", events)
+			}
+			if n := len(m.Sessions(1)); n != tt.wantCount {
+				t.Fatalf("want %d sessions, got %d", tt.wantCount, n)
+			}
+		})
+	}
+}
+
+func TestHeartbeatTimeout(t *testing.T) {
+	m, clk, rec := newTestManager(Options{HeartbeatTimeout: 30 * time.Second})
+	s, err := m.Login(1, "d1", "gw1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 心跳推迟超时
+	for i := 0; i < 3; i++ {
+		clk.Add(20 * time.Second)
+		if err = m.Heartbeat(s.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clk.Add(31 * time.Second)
+	if err = m.Heartbeat(s.ID); common.GetErrorCode(err, 0) != common.NotExist {
+		t.Fatalf("want NotExist, got %v", err)
+	}
+	if events := rec.Events(); len(events) != 1 || events[0].Reason != KickByTimeout {
+		t.Fatalf("want timeout kick, got %v", events)
+	}
+	if _, ok := m.Get(s.ID); ok {
+		t.Fatal("timed out session still present")
+	}
+}
+
+func TestExpireIdle(t *testing.T) {
+	m, clk, rec := newTestManager(Options{HeartbeatTimeout: 30 * time.Second})
+	idle, _ := m.Login(1, "d1", "gw1")
+	clk.Add(10 * time.Second)
+	active, _ := m.Login(1, "d2", "gw1")
+	other, _ := m.Login(2, "d1", "gw1")
+
+	clk.Add(25 * time.Second)
+	m.Heartbeat(active.ID)
+	if n := m.ExpireIdle(); n != 1 {
+		t.Fatalf("want 1 expired, got %d", n)
+	}
+	if events := rec.Events(); len(events) != 1 || events[0].Session.ID != idle.ID {
+		t.Fatalf("want idle session expired, got %v", events)
+	}
+
+	clk.Add(10 * time.Second)
+	if n := m.ExpireIdle(); n != 1 || m.Count() != 1 {
+		t.Fatalf("want other expired, got %d, %d left", n, m.Count())
+	}
+	if _, ok := m.Get(other.ID); ok {
+		t.Fatal("other session not expired")
+	}
+
+	// 不设置超时时不过期
+	never, clk2, _ := newTestManager(Options{})
+	never.Login(1, "d1", "gw1")
+	clk2.Add(24 * time.Hour)
+	if n := never.ExpireIdle(); n != 0 || never.Count() != 1 {
+		t.Fatal("session expired without heartbeat timeout")
+	}
+}
+
+func TestStartCleanup(t *testing.T) {
+	m, clk, rec := newTestManager(Options{HeartbeatTimeout: 30 * time.Second})
+	m.Start(10 * time.Second)
+	m.Login(1, "d1", "gw1")
+	m.Login(2, "d1", "gw1")
+
+	clk.Add(40 * time.Second)
+	deadline := time.Now().Add(time.Second)
+	for m.Count() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("sessions not cleaned up, %d left", m.Count())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if events := rec.Events(); len(events) != 2 || events[0].Reason != KickByTimeout {
+		t.Fatalf("want 2 timeout kicks, got %v", events)
+	}
+
+	m.Stop()
+	deadline = time.Now().Add(time.Second)
+	for clk.Timers() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("cleanup ticker not stopped")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestKickAndLogout(t *testing.T) {
+	m, _, rec := newTestManager(Options{})
+	a, _ := m.Login(1, "d1", "gw1")
+	b, _ := m.Login(1, "d2", "gw1")
+	c, _ := m.Login(1, "d3", "gw2")
+
+	m.Logout(a.ID)
+	if len(rec.Events()) != 0 {
+		t.Fatal("logout emitted kick event")
+	}
+	if !m.Kick(b.ID) || m.Kick(b.ID) {
+		t.Fatal("Kick should succeed exactly once")
+	}
+	if n := m.KickUser(1); n != 1 {
+		t.Fatalf("want 1 kicked, got %d", n)
+	}
+	events := rec.Events()
+	if len(events) != 2 || events[1].Session.ID != c.ID || events[1].Reason != KickByAdmin {
+		t.Fatalf("unexpected kicks %v", events)
+	}
+	if m.Count() != 0 {
+		t.Fatalf("want no sessions, got %d", m.Count())
+	}
+}
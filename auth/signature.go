@@ -0,0 +1,396 @@
+// @Author Eric
+// @Date 2026/10/21 10:30:00
+// @Desc 服务间调用的HMAC请求签名，类似 SigV4
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/Kyle91/haven/clock"
+	"github.com/Kyle91/haven/common"
+	"github.com/Kyle91/haven/crypto"
+	"github.com/valyala/fasthttp"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 签名相关的header
+const (
+	SignAlgorithm       = "HAVEN-HMAC-SHA256"
+	HeaderSignDate      = "X-Haven-Date"           // 签名时间，unix秒
+	HeaderSignNonce     = "X-Haven-Nonce"          // 随机串，防重放
+	HeaderContentSHA256 = "X-Haven-Content-Sha256" // body的sha256
+)
+
+// accessKeyUserValueKey 签名校验通过后保存在 RequestCtx 中的access key
+const accessKeyUserValueKey = "haven.auth.access_key"
+
+var (
+	ErrSignatureMissing   = errors.New("signature missing")
+	ErrSignatureMalformed = errors.New("malformed signature")
+	ErrSignatureMismatch  = errors.New("signature mismatch")
+	ErrSignatureExpired   = errors.New("signature timestamp out of window")
+	ErrSignatureReplayed  = errors.New("signature nonce already used")
+	ErrUnknownAccessKey   = errors.New("unknown access key")
+	ErrBodyHashMismatch   = errors.New("body hash mismatch")
+)
+
+// 总是参与签名的header
+var defaultSignedHeaders = []string{"host", strings.ToLower(HeaderContentSHA256), strings.ToLower(HeaderSignDate), strings.ToLower(HeaderSignNonce)}
+
+// RequestSigner 客户端签名，实现了 http.RequestSigner
+type RequestSigner struct {
+	accessKey string
+	secretKey []byte
+	headers   []string
+	clock     clock.Clock
+}
+
+// NewRequestSigner
+//
+//	@Description: 创建请求签名器
+//	@param accessKey
+//	@param secretKey
+//	@param headers 额外参与签名的header，host、日期、nonce、body哈希总是参与签名
+//	@return *RequestSigner
+func NewRequestSigner(accessKey string, secretKey []byte, headers ...string) *RequestSigner {
+	return &RequestSigner{
+		accessKey: accessKey,
+		secretKey: secretKey,
+		headers:   normalizeHeaderNames(headers),
+		clock:     clock.System,
+	}
+}
+
+// WithClock 设置签名使用的时钟
+func (s *RequestSigner) WithClock(c clock.Clock) *RequestSigner {
+	s.clock = clock.OrDefault(c)
+	return s
+}
+
+// Sign
+//
+//	@Description: 对请求签名，写入日期、nonce、body哈希和 Authorization 头
+//	@receiver s
+//	@param req
+//	@return error
+func (s *RequestSigner) Sign(req *fasthttp.Request) error {
+	nonce, err := generateRandomString()
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(HeaderSignDate, strconv.FormatInt(s.clock.Now().Unix(), 10))
+	req.Header.Set(HeaderSignNonce, nonce)
+	req.Header.Set(HeaderContentSHA256, crypto.SHA256(req.Body()))
+
+	signature, err := computeSignature(s.secretKey, req, s.headers)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(fasthttp.HeaderAuthorization, fmt.Sprintf("%s Credential=%s, SignedHeaders=%s, Signature=%s",
+		SignAlgorithm, s.accessKey, strings.Join(s.headers, ";"), signature))
+	return nil
+}
+
+// NonceStore 已使用的nonce存储
+type NonceStore interface {
+	// Use 原子地记录nonce，已经存在时返回false
+	Use(nonce string, expireAt time.Time) (bool, error)
+}
+
+// MemoryNonceStore 内存实现
+type MemoryNonceStore struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastPrune time.Time
+	clock     clock.Clock // 清理过期nonce使用的时钟
+}
+
+// NewMemoryNonceStore 创建内存nonce存储
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: make(map[string]time.Time), clock: clock.System}
+}
+
+// WithClock 设置清理过期nonce使用的时钟
+func (s *MemoryNonceStore) WithClock(c clock.Clock) *MemoryNonceStore {
+	s.clock = clock.OrDefault(c)
+	return s
+}
+
+func (s *MemoryNonceStore) Use(nonce string, expireAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	if now.Sub(s.lastPrune) > time.Minute {
+		s.lastPrune = now
+		for k, v := range s.nonces {
+			if now.After(v) {
+				delete(s.nonces, k)
+			}
+		}
+	}
+
+	if _, ok := s.nonces[nonce]; ok {
+		return false, nil
+	}
+	s.nonces[nonce] = expireAt
+	return true, nil
+}
+
+// SignatureVerifierOptions 服务端校验配置
+type SignatureVerifierOptions struct {
+	Window time.Duration // 允许的时间偏差，默认5分钟
+	Nonces NonceStore    // nonce存储，默认内存实现
+	Clock  clock.Clock
+}
+
+// SignatureVerifier 服务端签名校验，支持多个access key
+type SignatureVerifier struct {
+	mu   sync.RWMutex
+	keys map[string][]byte
+	opts SignatureVerifierOptions
+}
+
+// NewSignatureVerifier
+//
+//	@Description: 创建签名校验器
+//	@param keys access key -> secret key
+//	@param opts
+//	@return *SignatureVerifier
+func NewSignatureVerifier(keys map[string][]byte, opts SignatureVerifierOptions) *SignatureVerifier {
+	if opts.Window <= 0 {
+		opts.Window = 5 * time.Minute
+	}
+	opts.Clock = clock.OrDefault(opts.Clock)
+	if opts.Nonces == nil {
+		opts.Nonces = NewMemoryNonceStore().WithClock(opts.Clock)
+	}
+
+	v := &SignatureVerifier{keys: make(map[string][]byte, len(keys)), opts: opts}
+	for ak, sk := range keys {
+		v.keys[ak] = sk
+	}
+	return v
+}
+
+// SetKey 添加或更新access key，用于密钥轮换
+func (v *SignatureVerifier) SetKey(accessKey string, secretKey []byte) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keys[accessKey] = secretKey
+}
+
+// RemoveKey 删除access key
+func (v *SignatureVerifier) RemoveKey(accessKey string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.keys, accessKey)
+}
+
+// Verify
+//
+//	@Description: 校验请求签名
+//	@receiver v
+//	@param req
+//	@return string 校验通过的access key
+//	@return error
+func (v *SignatureVerifier) Verify(req *fasthttp.Request) (string, error) {
+	auth := string(req.Header.Peek(fasthttp.HeaderAuthorization))
+	if auth == "" {
+		return "", ErrSignatureMissing
+	}
+	accessKey, signedHeaders, signature, err := parseAuthorization(auth)
+	if err != nil {
+		return "", err
+	}
+
+	v.mu.RLock()
+	secretKey, ok := v.keys[accessKey]
+	v.mu.RUnlock()
+	if !ok {
+		return "", ErrUnknownAccessKey
+	}
+
+	// 校验签名的header里必须包含默认的header
+	for _, h := range defaultSignedHeaders {
+		if !containsString(signedHeaders, h) {
+			return "", ErrSignatureMalformed
+		}
+	}
+
+	ts, err := strconv.ParseInt(string(req.Header.Peek(HeaderSignDate)), 10, 64)
+	if err != nil {
+		return "", ErrSignatureMalformed
+	}
+	now := v.opts.Clock.Now()
+	signedAt := time.Unix(ts, 0)
+	if signedAt.Before(now.Add(-v.opts.Window)) || signedAt.After(now.Add(v.opts.Window)) {
+		return "", ErrSignatureExpired
+	}
+
+	if crypto.SHA256(req.Body()) != string(req.Header.Peek(HeaderContentSHA256)) {
+		return "", ErrBodyHashMismatch
+	}
+
+	// 按请求中声明的header计算签名
+	expected, err := computeSignature(secretKey, req, signedHeaders)
+	if err != nil {
+		return "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) != 1 {
+		return "", ErrSignatureMismatch
+	}
+
+	// 签名通过后再记录nonce，避免伪造请求占用nonce
+	nonce := string(req.Header.Peek(HeaderSignNonce))
+	if nonce == "" {
+		return "", ErrSignatureMalformed
+	}
+	ok, err = v.opts.Nonces.Use(accessKey+":"+nonce, signedAt.Add(v.opts.Window))
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrSignatureReplayed
+	}
+	return accessKey, nil
+}
+
+// Middleware 校验签名的fasthttp中间件，失败时返回 common.AuthFailed
+func (v *SignatureVerifier) Middleware(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		accessKey, err := v.Verify(&ctx.Request)
+		if err != nil {
+			WriteError(ctx, fasthttp.StatusUnauthorized, common.AuthFailed)
+			return
+		}
+		ctx.SetUserValue(accessKeyUserValueKey, accessKey)
+		next(ctx)
+	}
+}
+
+// AccessKeyFromContext 获取签名校验通过的access key
+func AccessKeyFromContext(ctx *fasthttp.RequestCtx) (string, bool) {
+	accessKey, ok := ctx.UserValue(accessKeyUserValueKey).(string)
+	return accessKey, ok
+}
+
+// computeSignature 按给定的header列表计算签名
+func computeSignature(secretKey []byte, req *fasthttp.Request, signedHeaders []string) (string, error) {
+	ts := string(req.Header.Peek(HeaderSignDate))
+	nonce := string(req.Header.Peek(HeaderSignNonce))
+	stringToSign := SignAlgorithm + "\n" + ts + "\n" + nonce + "\n" + crypto.SHA256([]byte(canonicalRequest(req, signedHeaders)))
+	return crypto.HMACSHA256(secretKey, stringToSign)
+}
+
+// canonicalRequest 规范化请求
+//
+//	METHOD
+//	/path
+//	a=1&b=2
+//	host:example.com
+//	x-haven-date:1700000000
+//	...
+//	host;x-haven-date;...
+//	body的sha256
+func canonicalRequest(req *fasthttp.Request, signedHeaders []string) string {
+	var sb strings.Builder
+	sb.Write(req.Header.Method())
+	sb.WriteString("\n")
+	sb.Write(req.URI().Path())
+	sb.WriteString("\n")
+	sb.WriteString(canonicalQuery(req.URI().QueryArgs()))
+	sb.WriteString("\n")
+	for _, h := range signedHeaders {
+		sb.WriteString(h)
+		sb.WriteString(":")
+		if h == "host" {
+			sb.Write(req.Host())
+		} else {
+			sb.WriteString(strings.Join(strings.Fields(string(req.Header.Peek(h))), " "))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString(strings.Join(signedHeaders, ";"))
+	sb.WriteString("\n")
+	sb.WriteString(string(req.Header.Peek(HeaderContentSHA256)))
+	return sb.String()
+}
+
+// canonicalQuery query参数按key、value排序后重新编码
+func canonicalQuery(args *fasthttp.Args) string {
+	type pair struct{ k, v string }
+	var pairs []pair
+	args.VisitAll(func(key, value []byte) {
+		pairs = append(pairs, pair{url.QueryEscape(string(key)), url.QueryEscape(string(value))})
+	})
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].k != pairs[j].k {
+			return pairs[i].k < pairs[j].k
+		}
+		return pairs[i].v < pairs[j].v
+	})
+
+	parts := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		parts = append(parts, p.k+"="+p.v)
+	}
+	return strings.Join(parts, "&")
+}
+
+// parseAuthorization 解析 HAVEN-HMAC-SHA256 Credential=ak, SignedHeaders=a;b, Signature=xx
+func parseAuthorization(auth string) (string, []string, string, error) {
+	if !strings.HasPrefix(auth, SignAlgorithm+" ") {
+		return "", nil, "", ErrSignatureMalformed
+	}
+
+	var accessKey, headers, signature string
+	for _, field := range strings.Split(auth[len(SignAlgorithm)+1:], ",") {
+		k, val, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return "", nil, "", ErrSignatureMalformed
+		}
+		switch k {
+		case "Credential":
+			accessKey = val
+		case "SignedHeaders":
+			headers = val
+		case "Signature":
+			signature = val
+		}
+	}
+	if accessKey == "" || headers == "" || signature == "" {
+		return "", nil, "", ErrSignatureMalformed
+	}
+	return accessKey, strings.Split(headers, ";"), signature, nil
+}
+
+// normalizeHeaderNames 默认header加上额外header，转小写后去重排序
+func normalizeHeaderNames(headers []string) []string {
+	merged := append([]string{}, defaultSignedHeaders...)
+	for _, h := range headers {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h != "" && !containsString(merged, h) {
+			merged = append(merged, h)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+// @Author Eric
+// @Date 2026/10/29 16:00:00
+// @Desc 请求签名的测试
+package auth
+
+import (
+	"errors"
+	"github.com/Kyle91/haven/clock"
+	"github.com/valyala/fasthttp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSignedRequest(t *testing.T, signer *RequestSigner) *fasthttp.Request {
+	t.Helper()
+	req := &fasthttp.Request{}
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.SetRequestURI("http://game.internal/api/pay?b=2&a=1&a=0")
+	req.Header.Set("X-Trace-Id", "trace-1")
+	req.SetBodyString(`{"amount":100}`)
+	if err := signer.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestSignatureVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signer := NewRequestSigner("ak1", []byte("secret1"), "X-Trace-Id").WithClock(clock.NewMockClock(now))
+
+	tests := []struct {
+		name   string
+		tamper func(req *fasthttp.Request)
+		clock  time.Time
+		want   error
+	}{
+		{"valid", func(req *fasthttp.Request) {}, now, nil},
+		{"query reordered", func(req *fasthttp.Request) {
+			req.SetRequestURI("http://game.internal/api/pay?a=0&a=1&b=2")
+		}, now, nil},
+		{"within window", func(req *fasthttp.Request) {}, now.Add(4 * time.Minute), nil},
+		{"expired", func(req *fasthttp.Request) {}, now.Add(6 * time.Minute), ErrSignatureExpired},
+		{"from future", func(req *fasthttp.Request) {}, now.Add(-6 * time.Minute), ErrSignatureExpired},
+		{"body changed", func(req *fasthttp.Request) { req.SetBodyString(`{"amount":1}`) }, now, ErrBodyHashMismatch},
+		{"body and hash changed", func(req *fasthttp.Request) {
+			req.SetBodyString(`{"amount":1}`)
+			req.Header.Set(HeaderContentSHA256, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+		}, now, ErrBodyHashMismatch},
+		{"query changed", func(req *fasthttp.Request) {
+			req.SetRequestURI("http://game.internal/api/pay?b=3&a=1&a=0")
+		}, now, ErrSignatureMismatch},
+		{"path changed", func(req *fasthttp.Request) {
+			req.SetRequestURI("http://game.internal/api/refund?b=2&a=1&a=0")
+		}, now, ErrSignatureMismatch},
+		{"method changed", func(req *fasthttp.Request) { req.Header.SetMethod(fasthttp.MethodPut) }, now, ErrSignatureMismatch},
+		{"signed header changed", func(req *fasthttp.Request) { req.Header.Set("X-Trace-Id", "trace-2") }, now, ErrSignatureMismatch},
+		{"nonce changed", func(req *fasthttp.Request) { req.Header.Set(HeaderSignNonce, "other") }, now, ErrSignatureMismatch},
+		{"missing authorization", func(req *fasthttp.Request) { req.Header.Del(fasthttp.HeaderAuthorization) }, now, ErrSignatureMissing},
+		{"unknown access key", func(req *fasthttp.Request) {
+			auth := string(req.Header.Peek(fasthttp.HeaderAuthorization))
+			req.Header.Set(fasthttp.HeaderAuthorization, strings.Replace(auth, "Credential=ak1", "Credential=ak2", 1))
+		}, now, ErrUnknownAccessKey},
+		{"default header not signed", func(req *fasthttp.Request) {
+			auth := string(req.Header.Peek(fasthttp.HeaderAuthorization))
+			req.Header.Set(fasthttp.HeaderAuthorization, strings.Replace(auth, "x-haven-nonce;", "", 1))
+		}, now, ErrSignatureMalformed},
+		{"other scheme", func(req *fasthttp.Request) { req.Header.Set(fasthttp.HeaderAuthorization, "Bearer abc") }, now, ErrSignatureMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewSignatureVerifier(map[string][]byte{"ak1": []byte("secret1")},
+				SignatureVerifierOptions{Clock: clock.NewMockClock(tt.clock)})
+			req := newSignedRequest(t, signer)
+			tt.tamper(req)
+			accessKey, err := v.Verify(req)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, err)
+			}
+			if err == nil && accessKey != "ak1" {
+				t.Fatalf("want ak1, got %s", accessKey)
+			}
+		})
+	}
+}
+
+func TestSignatureReplayAndKeyRotation(t *testing.T) {
+	clk := clock.NewMockClock(time.Unix(1700000000, 0))
+	v := NewSignatureVerifier(map[string][]byte{"ak1": []byte("secret1")}, SignatureVerifierOptions{Clock: clk})
+	signer := NewRequestSigner("ak1", []byte("secret1")).WithClock(clk)
+
+	req := newSignedRequest(t, signer)
+	if _, err := v.Verify(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(req); !errors.Is(err, ErrSignatureReplayed) {
+		t.Fatalf("want ErrSignatureReplayed, got %v", err)
+	}
+
+	// 轮换密钥后旧密钥签名的请求不再通过
+	v.SetKey("ak1", []byte("secret2"))
+	if _, err := v.Verify(newSignedRequest(t, signer)); !errors.Is(err, ErrSignatureMismatch) {
+		t.Fatalf("want ErrSignatureMismatch, got %v", err)
+	}
+	rotated := NewRequestSigner("ak1", []byte("secret2")).WithClock(clk)
+	if _, err := v.Verify(newSignedRequest(t, rotated)); err != nil {
+		t.Fatal(err)
+	}
+	v.RemoveKey("ak1")
+	if _, err := v.Verify(newSignedRequest(t, rotated)); !errors.Is(err, ErrUnknownAccessKey) {
+		t.Fatalf("want ErrUnknownAccessKey, got %v", err)
+	}
+}
+
+func TestMemoryNonceStorePrune(t *testing.T) {
+	clk := clock.NewMockClock(time.Unix(1700000000, 0))
+	s := NewMemoryNonceStore().WithClock(clk)
+	if ok, _ := s.Use("n1", clk.Now().Add(5*time.Minute)); !ok {
+		t.Fatal("first use rejected")
+	}
+	// 按系统时间清理会删掉nonce，让请求可以重放
+	clk.Add(2 * time.Minute)
+	s.Use("n2", clk.Now().Add(5*time.Minute))
+	if ok, _ := s.Use("n1", clk.Now().Add(5*time.Minute)); ok {
+		t.Fatal("replay accepted before expiry")
+	}
+
+	clk.Add(10 * time.Minute)
+	s.Use("n3", clk.Now().Add(5*time.Minute))
+	if ok, _ := s.Use("n1", clk.Now().Add(5*time.Minute)); !ok {
+		t.Fatal("expired nonce not pruned")
+	}
+}
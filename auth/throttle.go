@@ -0,0 +1,389 @@
+// @Author Eric
+// @Date 2026/10/21 15:00:00
+// @Desc 登录失败限流和账号锁定
+package auth
+
+import (
+	"github.com/Kyle91/haven/clock"
+	"github.com/Kyle91/haven/common"
+	"sync"
+	"time"
+)
+
+// 限流维度
+const (
+	ThrottleByAccount = "account"
+	ThrottleByIP      = "ip"
+	ThrottleByDevice  = "device"
+)
+
+// ThrottleLimit 单个维度的限制
+type ThrottleLimit struct {
+	MaxAttempts int           // 窗口内允许的尝试次数，登录成功的尝试不计入，0表示该维度不限制
+	Window      time.Duration // 计数窗口，从第一次失败开始计算
+	Lockout     time.Duration // 达到上限后的锁定时间
+}
+
+// ThrottleOptions 登录限流配置
+type ThrottleOptions struct {
+	Account ThrottleLimit
+	IP      ThrottleLimit
+	Device  ThrottleLimit
+
+	// 渐进延迟，从第 DelayAfter 次失败开始，每次失败后需要等待 BaseDelay*2^n，最多 MaxDelay
+	DelayAfter int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+
+	Clock clock.Clock
+}
+
+// DefaultThrottleOptions 账号5次、设备10次、IP 50次失败后锁定15分钟，第3次失败开始延迟
+var DefaultThrottleOptions = ThrottleOptions{
+	Account:    ThrottleLimit{MaxAttempts: 5, Window: 15 * time.Minute, Lockout: 15 * time.Minute},
+	IP:         ThrottleLimit{MaxAttempts: 50, Window: 15 * time.Minute, Lockout: 15 * time.Minute},
+	Device:     ThrottleLimit{MaxAttempts: 10, Window: 15 * time.Minute, Lockout: 15 * time.Minute},
+	DelayAfter: 3,
+	BaseDelay:  time.Second,
+	MaxDelay:   30 * time.Second,
+}
+
+// ThrottleRecord 单个key的尝试记录
+type ThrottleRecord struct {
+	Count       int // 窗口内的尝试次数，包括还没有结果的
+	WindowStart time.Time
+	LastFailure time.Time // 最后一次尝试的时间
+	LockedUntil time.Time
+}
+
+// ThrottleStore 尝试计数存储
+type ThrottleStore interface {
+	// Get 获取记录，不存在时返回零值
+	Get(key string) (ThrottleRecord, error)
+	// Attempt 原子地检查并占用一次尝试，窗口过期或锁定结束时重新计数
+	// 没有锁定且次数小于max时次数加一并返回true，返回的是占用之前的记录
+	Attempt(key string, now time.Time, window time.Duration, max int) (ThrottleRecord, bool, error)
+	// Release 归还一次占用的尝试
+	Release(key string) error
+	// Lock 锁定到指定时间
+	Lock(key string, until time.Time) error
+	// Reset 清除记录
+	Reset(key string) error
+}
+
+// ThrottleDecision 限流判断结果
+type ThrottleDecision struct {
+	Allowed    bool
+	RetryAfter time.Duration // 不允许时需要等待的时间
+	Remaining  int           // 被锁定前剩余的尝试次数，取所有维度的最小值，-1表示不限制
+	Reason     string        // 不允许时触发限制的维度
+}
+
+// Err 不允许时返回 common.LimitReached
+func (d *ThrottleDecision) Err() error {
+	if d.Allowed {
+		return nil
+	}
+	return common.NewError(common.LimitReached)
+}
+
+// LoginThrottle 登录限流，在校验密码之前调用 Check，允许时校验密码，失败调用 Fail，成功调用 Succeed
+// Check 在检查的同时占用一次尝试，并发的尝试也不会超过限制
+type LoginThrottle struct {
+	opts  ThrottleOptions
+	store ThrottleStore
+}
+
+// NewLoginThrottle
+//
+//	@Description: 创建登录限流器
+//	@param opts
+//	@param store 计数存储，为nil时使用内存实现
+//	@return *LoginThrottle
+func NewLoginThrottle(opts ThrottleOptions, store ThrottleStore) *LoginThrottle {
+	if store == nil {
+		store = NewMemoryThrottleStore()
+	}
+	opts.Clock = clock.OrDefault(opts.Clock)
+	return &LoginThrottle{opts: opts, store: store}
+}
+
+// Check
+//
+//	@Description: 登录前检查是否允许尝试，允许时占用一次尝试，之后必须调用 Fail 或 Succeed，为空的维度不检查
+//	@receiver t
+//	@param account
+//	@param ip
+//	@param device
+//	@return *ThrottleDecision
+//	@return error
+func (t *LoginThrottle) Check(account, ip, device string) (*ThrottleDecision, error) {
+	now := t.opts.Clock.Now()
+	decision := &ThrottleDecision{Allowed: true, Remaining: -1}
+
+	var reserved []throttleDimension
+	for _, d := range t.dimensions(account, ip, device) {
+		record, ok, err := t.store.Attempt(d.key, now, d.limit.Window, d.limit.MaxAttempts)
+		if err != nil {
+			t.release(reserved)
+			return nil, err
+		}
+		count := record.Count
+		if ok {
+			reserved = append(reserved, d)
+			count++
+		}
+		t.apply(decision, d, record, count, now)
+		// 没有锁定但次数已满，其他并发的尝试还没有结果
+		if !ok && decision.Allowed {
+			decision.Allowed = false
+			decision.RetryAfter = t.retryAfterFull(d, record, now)
+			decision.Reason = d.kind
+		}
+	}
+	if !decision.Allowed {
+		t.release(reserved)
+	}
+	return decision, nil
+}
+
+// Fail
+//
+//	@Description: 记录 Check 占用的尝试失败，达到上限时锁定
+//	@receiver t
+//	@param account
+//	@param ip
+//	@param device
+//	@return *ThrottleDecision 记录后的状态，可以用于提示剩余次数
+//	@return error
+func (t *LoginThrottle) Fail(account, ip, device string) (*ThrottleDecision, error) {
+	now := t.opts.Clock.Now()
+	decision := &ThrottleDecision{Allowed: true, Remaining: -1}
+
+	for _, d := range t.dimensions(account, ip, device) {
+		record, err := t.store.Get(d.key)
+		if err != nil {
+			return nil, err
+		}
+		count := windowCount(d, record, now)
+		if count >= d.limit.MaxAttempts && d.limit.Lockout > 0 {
+			record.LockedUntil = now.Add(d.limit.Lockout)
+			if err = t.store.Lock(d.key, record.LockedUntil); err != nil {
+				return nil, err
+			}
+		}
+		t.apply(decision, d, record, count, now)
+	}
+	return decision, nil
+}
+
+// Succeed 登录成功，清除账号和设备的记录，IP的记录保留，只归还 Check 占用的一次尝试
+func (t *LoginThrottle) Succeed(account, ip, device string) error {
+	if account != "" {
+		if err := t.store.Reset(throttleKey(ThrottleByAccount, account)); err != nil {
+			return err
+		}
+	}
+	if device != "" {
+		if err := t.store.Reset(throttleKey(ThrottleByDevice, device)); err != nil {
+			return err
+		}
+	}
+	if ip != "" && t.opts.IP.MaxAttempts > 0 {
+		return t.store.Release(throttleKey(ThrottleByIP, ip))
+	}
+	return nil
+}
+
+// Unlock 手动解除锁定，例如客服操作
+func (t *LoginThrottle) Unlock(kind, value string) error {
+	return t.store.Reset(throttleKey(kind, value))
+}
+
+type throttleDimension struct {
+	kind  string
+	key   string
+	limit ThrottleLimit
+}
+
+func (t *LoginThrottle) dimensions(account, ip, device string) []throttleDimension {
+	dims := make([]throttleDimension, 0, 3)
+	add := func(kind, value string, limit ThrottleLimit) {
+		if value != "" && limit.MaxAttempts > 0 {
+			dims = append(dims, throttleDimension{kind: kind, key: throttleKey(kind, value), limit: limit})
+		}
+	}
+	add(ThrottleByAccount, account, t.opts.Account)
+	add(ThrottleByIP, ip, t.opts.IP)
+	add(ThrottleByDevice, device, t.opts.Device)
+	return dims
+}
+
+// release 归还占用的尝试，只在已经出错时调用，不再返回错误
+func (t *LoginThrottle) release(dims []throttleDimension) {
+	for _, d := range dims {
+		t.store.Release(d.key)
+	}
+}
+
+// windowCount 窗口内的尝试次数，窗口过期时为0
+func windowCount(d throttleDimension, record ThrottleRecord, now time.Time) int {
+	if d.limit.Window > 0 && now.Sub(record.WindowStart) > d.limit.Window {
+		return 0
+	}
+	return record.Count
+}
+
+// retryAfterFull 次数已满但没有锁定时的等待时间，有锁定时间时按锁定时间，否则等到窗口结束
+func (t *LoginThrottle) retryAfterFull(d throttleDimension, record ThrottleRecord, now time.Time) time.Duration {
+	if d.limit.Lockout > 0 {
+		return d.limit.Lockout
+	}
+	if wait := record.WindowStart.Add(d.limit.Window).Sub(now); wait > 0 {
+		return wait
+	}
+	return time.Second
+}
+
+// apply 根据单个维度的记录更新判断结果，count为尝试之后的次数，等待时间按尝试之前的记录计算
+func (t *LoginThrottle) apply(decision *ThrottleDecision, d throttleDimension, record ThrottleRecord, count int, now time.Time) {
+	remaining := d.limit.MaxAttempts - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	if decision.Remaining < 0 || remaining < decision.Remaining {
+		decision.Remaining = remaining
+	}
+
+	var wait time.Duration
+	if now.Before(record.LockedUntil) {
+		wait = record.LockedUntil.Sub(now)
+	} else if delay := t.delay(windowCount(d, record, now)); delay > 0 {
+		if next := record.LastFailure.Add(delay); now.Before(next) {
+			wait = next.Sub(now)
+		}
+	}
+
+	if wait > 0 && wait > decision.RetryAfter {
+		decision.Allowed = false
+		decision.RetryAfter = wait
+		decision.Reason = d.kind
+	}
+}
+
+// delay 第count次失败后需要等待的时间
+func (t *LoginThrottle) delay(count int) time.Duration {
+	if t.opts.BaseDelay <= 0 || t.opts.DelayAfter <= 0 || count < t.opts.DelayAfter {
+		return 0
+	}
+	delay := t.opts.BaseDelay
+	for i := t.opts.DelayAfter; i < count; i++ {
+		delay *= 2
+		if t.opts.MaxDelay > 0 && delay >= t.opts.MaxDelay {
+			return t.opts.MaxDelay
+		}
+	}
+	if t.opts.MaxDelay > 0 && delay > t.opts.MaxDelay {
+		return t.opts.MaxDelay
+	}
+	return delay
+}
+
+func throttleKey(kind, value string) string {
+	return kind + ":" + value
+}
+
+// MemoryThrottleStore 内存计数存储
+type MemoryThrottleStore struct {
+	mu        sync.Mutex
+	records   map[string]*ThrottleRecord
+	maxWindow time.Duration // 见过的最大窗口，清理时用
+	lastPrune time.Time
+}
+
+// NewMemoryThrottleStore 创建内存计数存储
+func NewMemoryThrottleStore() *MemoryThrottleStore {
+	return &MemoryThrottleStore{records: make(map[string]*ThrottleRecord)}
+}
+
+func (s *MemoryThrottleStore) Get(key string) (ThrottleRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.records[key]; ok {
+		return *r, nil
+	}
+	return ThrottleRecord{}, nil
+}
+
+func (s *MemoryThrottleStore) Attempt(key string, now time.Time, window time.Duration, max int) (ThrottleRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if window > s.maxWindow {
+		s.maxWindow = window
+	}
+	s.pruneLocked(now)
+	r, ok := s.records[key]
+	if !ok {
+		r = &ThrottleRecord{WindowStart: now}
+		s.records[key] = r
+	}
+	expired := window > 0 && now.Sub(r.WindowStart) > window
+	unlocked := !r.LockedUntil.IsZero() && !now.Before(r.LockedUntil)
+	if expired || unlocked {
+		*r = ThrottleRecord{WindowStart: now}
+	}
+
+	prev := *r
+	if now.Before(r.LockedUntil) || (max > 0 && r.Count >= max) {
+		return prev, false, nil
+	}
+	r.Count++
+	r.LastFailure = now
+	return prev, true, nil
+}
+
+func (s *MemoryThrottleStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.records[key]; ok && r.Count > 0 {
+		r.Count--
+	}
+	return nil
+}
+
+func (s *MemoryThrottleStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[key]
+	if !ok {
+		r = &ThrottleRecord{WindowStart: until}
+		s.records[key] = r
+	}
+	r.LockedUntil = until
+	return nil
+}
+
+func (s *MemoryThrottleStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+// pruneLocked 清理窗口和锁定都已经过期的记录，最多每分钟执行一次
+func (s *MemoryThrottleStore) pruneLocked(now time.Time) {
+	if now.Sub(s.lastPrune) < time.Minute {
+		return
+	}
+	s.lastPrune = now
+	for key, r := range s.records {
+		if now.After(r.LockedUntil) && now.Sub(r.LastFailure) > s.maxWindow {
+			delete(s.records, key)
+		}
+	}
+}
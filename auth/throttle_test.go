@@ -0,0 +1,178 @@
+// @Author Eric
+// @Date 2026/10/30 14:00:00
+// @Desc 登录限流和账号锁定的测试
+package auth
+
+import (
+	"github.com/Kyle91/haven/clock"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestThrottle(opts ThrottleOptions) (*LoginThrottle, *clock.MockClock) {
+	clk := clock.NewMockClock(time.Unix(1700000000, 0))
+	opts.Clock = clk
+	return NewLoginThrottle(opts, nil), clk
+}
+
+// attemptFail 一次失败的登录尝试，返回 Check 是否允许
+func attemptFail(t *testing.T, th *LoginThrottle, account, ip, device string) *ThrottleDecision {
+	t.Helper()
+	d, err := th.Check(account, ip, device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Allowed {
+		if _, err = th.Fail(account, ip, device); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d
+}
+
+// 每次尝试使用不同的账号、IP和设备
+func throttleAccount(i int) string { return "user" + strconv.Itoa(i) }
+func throttleIP(i int) string      { return "198.51.100." + strconv.Itoa(i+1) }
+func throttleDevice(i int) string  { return "device" + strconv.Itoa(i) }
+
+func TestThrottleLimits(t *testing.T) {
+	limit := func(n int) ThrottleLimit {
+		return ThrottleLimit{MaxAttempts: n, Window: 10 * time.Minute, Lockout: 5 * time.Minute}
+	}
+	tests := []struct {
+		name string
+		opts ThrottleOptions
+		// next 第i次尝试使用的账号、IP和设备，只有受限的维度保持不变
+		next func(i int) (string, string, string)
+		max  int
+		kind string
+	}{
+		{"account", ThrottleOptions{Account: limit(3), IP: limit(100), Device: limit(100)},
+			func(i int) (string, string, string) { return "alice", throttleIP(i), throttleDevice(i) }, 3, ThrottleByAccount},
+		{"ip", ThrottleOptions{Account: limit(100), IP: limit(4), Device: limit(100)},
+			func(i int) (string, string, string) { return throttleAccount(i), "203.0.113.7", throttleDevice(i) }, 4, ThrottleByIP},
+		{"device", ThrottleOptions{Account: limit(100), IP: limit(100), Device: limit(2)},
+			func(i int) (string, string, string) { return throttleAccount(i), throttleIP(i), "phone" }, 2, ThrottleByDevice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th, clk := newTestThrottle(tt.opts)
+			for i := 0; i < tt.max; i++ {
+				account, ip, device := tt.next(i)
+				if d := attemptFail(t, th, account, ip, device); !d.Allowed {
+					t.Fatalf("attempt %d denied: %+v", i+1, d)
+				}
+			}
+
+			account, ip, device := tt.next(tt.max)
+			d := attemptFail(t, th, account, ip, device)
+			if d.Allowed || d.Reason != tt.kind || d.RetryAfter != 5*time.Minute || d.Err() == nil {
+				t.Fatalf("want locked by %s for 5m, got %+v", tt.kind, d)
+			}
+
+			// 锁定结束后重新计数
+			clk.Add(5 * time.Minute)
+			if d = attemptFail(t, th, account, ip, device); !d.Allowed {
+				t.Fatalf("still locked after lockout: %+v", d)
+			}
+			if d.Remaining != tt.max-1 {
+				t.Fatalf("want %d remaining, got %d", tt.max-1, d.Remaining)
+			}
+		})
+	}
+}
+
+func TestThrottleWindowAndSucceed(t *testing.T) {
+	th, clk := newTestThrottle(ThrottleOptions{
+		Account: ThrottleLimit{MaxAttempts: 3, Window: 10 * time.Minute, Lockout: time.Hour},
+		IP:      ThrottleLimit{MaxAttempts: 3, Window: 10 * time.Minute, Lockout: time.Hour},
+	})
+
+	// 窗口过期后之前的失败不再计数
+	attemptFail(t, th, "alice", "", "")
+	attemptFail(t, th, "alice", "", "")
+	clk.Add(11 * time.Minute)
+	attemptFail(t, th, "alice", "", "")
+	attemptFail(t, th, "alice", "", "")
+	if d := attemptFail(t, th, "alice", "", ""); !d.Allowed {
+		t.Fatalf("old failures counted after window: %+v", d)
+	}
+
+	// 登录成功清除账号的记录，不占用IP的次数
+	th.Unlock(ThrottleByAccount, "alice")
+	for i := 0; i < 5; i++ {
+		d, err := th.Check("alice", "203.0.113.7", "")
+		if err != nil || !d.Allowed {
+			t.Fatalf("login %d denied: %+v %v", i+1, d, err)
+		}
+		if err = th.Succeed("alice", "203.0.113.7", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	attemptFail(t, th, "alice", "203.0.113.7", "")
+	attemptFail(t, th, "alice", "203.0.113.7", "")
+	if d := attemptFail(t, th, "bob", "203.0.113.7", ""); !d.Allowed {
+		t.Fatalf("successful logins consumed ip attempts: %+v", d)
+	}
+	if d := attemptFail(t, th, "carol", "203.0.113.7", ""); d.Allowed {
+		t.Fatalf("ip not limited after failures: %+v", d)
+	}
+}
+
+func TestThrottleProgressiveDelay(t *testing.T) {
+	th, clk := newTestThrottle(ThrottleOptions{
+		Account:    ThrottleLimit{MaxAttempts: 10, Window: time.Hour, Lockout: time.Hour},
+		DelayAfter: 2,
+		BaseDelay:  time.Second,
+		MaxDelay:   4 * time.Second,
+	})
+	attemptFail(t, th, "alice", "", "")
+	attemptFail(t, th, "alice", "", "")
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		d := attemptFail(t, th, "alice", "", "")
+		if d.Allowed || d.RetryAfter != want {
+			t.Fatalf("want delay %v, got %+v", want, d)
+		}
+		clk.Add(want)
+		if d = attemptFail(t, th, "alice", "", ""); !d.Allowed {
+			t.Fatalf("denied after delay: %+v", d)
+		}
+	}
+}
+
+func TestThrottleConcurrentAttempts(t *testing.T) {
+	// 所有尝试都在任何一个 Fail 之前通过 Check，也只能有 MaxAttempts 个
+	th, _ := newTestThrottle(ThrottleOptions{
+		Account: ThrottleLimit{MaxAttempts: 5, Window: time.Hour, Lockout: time.Hour},
+	})
+	var allowed int32
+	var checked, wg sync.WaitGroup
+	checked.Add(50)
+	wg.Add(50)
+	for i := 0; i < 50; i++ {
+		go func() {
+			defer wg.Done()
+			d, err := th.Check("alice", "", "")
+			checked.Done()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if d.Allowed {
+				atomic.AddInt32(&allowed, 1)
+				checked.Wait()
+				th.Fail("alice", "", "")
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 5 {
+		t.Fatalf("want 5 parallel attempts allowed, got %d", allowed)
+	}
+	if d := attemptFail(t, th, "alice", "", ""); d.Allowed || d.RetryAfter != time.Hour {
+		t.Fatalf("want account locked, got %+v", d)
+	}
+}
@@ -0,0 +1,208 @@
+// @Author Eric
+// @Date 2026/10/19 10:00:00
+// @Desc 可注入的时钟，方便测试过期逻辑
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock 时钟接口
+type Clock interface {
+	Now() time.Time
+	// AfterFunc d之后在另一个协程中调用f，见 time.AfterFunc
+	AfterFunc(d time.Duration, f func()) Timer
+	// NewTicker 每隔d向通道发送一次当前时间，接收慢时丢弃，见 time.NewTicker
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer AfterFunc 返回的定时器，*time.Timer 实现了这个接口
+type Timer interface {
+	// Stop 取消定时器，定时器已经触发或已经取消时返回false
+	Stop() bool
+	// Reset 改为d之后触发，定时器还未触发时返回true
+	Reset(d time.Duration) bool
+}
+
+// Ticker 周期定时器
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// System 系统时钟
+var System Clock = systemClock{}
+
+// OrDefault 为nil时返回系统时钟
+func OrDefault(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+	return c
+}
+
+// MockClock 手动控制的时钟，用于测试
+// 定时器只在 Add 或 Set 推进时间时触发，AfterFunc 的回调在推进时间的协程中按到期顺序执行
+type MockClock struct {
+	mu      sync.RWMutex
+	now     time.Time
+	waiters []*mockWaiter // 未触发的定时器
+}
+
+// mockWaiter MockClock 的定时器和周期定时器
+type mockWaiter struct {
+	c      *MockClock
+	at     time.Time
+	period time.Duration // 周期定时器的间隔，定时器为0
+	fn     func()
+	ch     chan time.Time
+}
+
+// NewMockClock 创建一个停在指定时间的时钟
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{now: now}
+}
+
+func (c *MockClock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.now
+}
+
+// Set 设置当前时间，时间前进时触发到期的定时器
+func (c *MockClock) Set(now time.Time) {
+	c.advance(now)
+}
+
+// Add 时间前进d，触发到期的定时器
+func (c *MockClock) Add(d time.Duration) {
+	c.advance(c.Now().Add(d))
+}
+
+func (c *MockClock) AfterFunc(d time.Duration, f func()) Timer {
+	w := &mockWaiter{c: c, fn: f}
+	w.Reset(d)
+	return w
+}
+
+func (c *MockClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	w := &mockWaiter{c: c, period: d, ch: make(chan time.Time, 1)}
+	w.Reset(d)
+	return mockTicker{w}
+}
+
+// Timers 未触发的定时器和周期定时器的数量，用于测试中等待其他协程创建定时器
+func (c *MockClock) Timers() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.waiters)
+}
+
+// advance 逐个触发到期的定时器，触发时的当前时间为定时器的到期时间
+func (c *MockClock) advance(target time.Time) {
+	for {
+		c.mu.Lock()
+		if len(c.waiters) == 0 || c.waiters[0].at.After(target) {
+			c.now = target
+			c.mu.Unlock()
+			return
+		}
+		w := c.waiters[0]
+		if w.at.After(c.now) {
+			c.now = w.at
+		}
+		now := c.now
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+			c.sortLocked()
+		} else {
+			c.removeLocked(w)
+		}
+		c.mu.Unlock()
+
+		if w.fn != nil {
+			w.fn()
+		} else {
+			select {
+			case w.ch <- now:
+			default:
+			}
+		}
+	}
+}
+
+func (c *MockClock) sortLocked() {
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].at.Before(c.waiters[j].at)
+	})
+}
+
+// removeLocked 删除定时器，返回定时器是否还未触发
+func (c *MockClock) removeLocked(w *mockWaiter) bool {
+	for i, v := range c.waiters {
+		if v == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (w *mockWaiter) Stop() bool {
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+	return w.c.removeLocked(w)
+}
+
+func (w *mockWaiter) Reset(d time.Duration) bool {
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+	pending := w.c.removeLocked(w)
+	if w.period > 0 {
+		w.period = d
+	}
+	w.at = w.c.now.Add(d)
+	w.c.waiters = append(w.c.waiters, w)
+	w.c.sortLocked()
+	return pending
+}
+
+// mockTicker Ticker 的 Stop 没有返回值
+type mockTicker struct {
+	*mockWaiter
+}
+
+func (t mockTicker) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t mockTicker) Stop() {
+	t.mockWaiter.Stop()
+}
@@ -0,0 +1,79 @@
+// @Author Eric
+// @Date 2026/10/30 11:00:00
+// @Desc 模拟时钟的定时器测试
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMockClockAfterFunc(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	c := NewMockClock(start)
+	var fired []time.Duration
+	record := func() { fired = append(fired, c.Now().Sub(start)) }
+
+	c.AfterFunc(3*time.Second, record)
+	c.AfterFunc(time.Second, record)
+	stopped := c.AfterFunc(2*time.Second, record)
+	reset := c.AfterFunc(time.Second, record)
+	if !stopped.Stop() || stopped.Stop() {
+		t.Fatal("Stop should succeed exactly once")
+	}
+	if !reset.Reset(4 * time.Second) {
+		t.Fatal("Reset on pending timer returned false")
+	}
+
+	// 一次前进多个定时器的时间，按到期顺序触发，触发时的时间为到期时间
+	c.Add(10 * time.Second)
+	want := []time.Duration{time.Second, 3 * time.Second, 4 * time.Second}
+	if len(fired) != len(want) {
+		t.Fatalf("want %v, got %v", want, fired)
+	}
+	for i := range want {
+		if fired[i] != want[i] {
+			t.Fatalf("want %v, got %v", want, fired)
+		}
+	}
+	if c.Now().Sub(start) != 10*time.Second || c.Timers() != 0 {
+		t.Fatalf("now %v, %d timers pending", c.Now().Sub(start), c.Timers())
+	}
+	if reset.Reset(time.Second) {
+		t.Fatal("Reset on fired timer returned true")
+	}
+	c.Add(time.Second)
+	if len(fired) != 4 {
+		t.Fatal("reused timer did not fire")
+	}
+}
+
+func TestMockClockTicker(t *testing.T) {
+	c := NewMockClock(time.Unix(1700000000, 0))
+	ticker := c.NewTicker(time.Second)
+
+	c.Add(500 * time.Millisecond)
+	select {
+	case <-ticker.C():
+		t.Fatal("ticked early")
+	default:
+	}
+	// 接收慢时只保留一次
+	c.Add(3 * time.Second)
+	if got := <-ticker.C(); !got.Equal(time.Unix(1700000001, 0)) {
+		t.Fatalf("unexpected tick %v", got)
+	}
+	select {
+	case <-ticker.C():
+		t.Fatal("missed ticks not dropped")
+	default:
+	}
+
+	ticker.Stop()
+	c.Add(time.Minute)
+	select {
+	case <-ticker.C():
+		t.Fatal("ticked after Stop")
+	default:
+	}
+}
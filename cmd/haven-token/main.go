@@ -0,0 +1,332 @@
+// @Author Eric
+// @Date 2026/10/22 16:00:00
+// @Desc token排查工具，签发测试token、解密查看字段、解释校验失败的原因、生成密钥
+//
+//	haven-token issue   -key <base64> -salt <salt> -user 10001 -ttl 1h [-device d1 [-bind-device]] [-roles gm,support] [-ip-prefix 10.0.0.0/8] [-jkt <thumbprint>]
+//	haven-token inspect -key <base64> <token>
+//	haven-token explain -key <base64> -salt <salt> <token>
+//	haven-token genkey  [-size 32]
+//
+// -key 和 -salt 默认读取环境变量 HAVEN_TOKEN_KEY 和 HAVEN_TOKEN_SALT
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Kyle91/haven/auth"
+	"github.com/Kyle91/haven/crypto"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	envKey  = "HAVEN_TOKEN_KEY"
+	envSalt = "HAVEN_TOKEN_SALT"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	args := os.Args[2:]
+	switch os.Args[1] {
+	case "issue":
+		err = issue(args)
+	case "inspect":
+		err = inspect(args)
+	case "explain":
+		err = explain(args)
+	case "genkey":
+		err = genkey(args)
+	case "help", "-h", "-help", "--help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `usage: haven-token <command> [flags]
+
+commands:
+  issue    签发测试token
+  inspect  解密token并输出所有字段，不做任何校验
+  explain  校验token的盐值、有效期，说明失败的原因，列出绑定
+  genkey   生成新的base64密钥
+
+-key 和 -salt 默认读取环境变量 `+envKey+` 和 `+envSalt+`
+`)
+}
+
+// keyFlags 注册 -key 和 -salt 参数
+func keyFlags(fs *flag.FlagSet, withSalt bool) (*string, *string) {
+	key := fs.String("key", os.Getenv(envKey), "base64编码的32字节密钥")
+	salt := new(string)
+	if withSalt {
+		salt = fs.String("salt", os.Getenv(envSalt), "盐值")
+	}
+	return key, salt
+}
+
+// newAuthToken 校验密钥后创建 AuthToken，NewAuthToken 本身会忽略base64解码错误
+func newAuthToken(key, salt string) (*auth.AuthToken, error) {
+	if key == "" {
+		return nil, fmt.Errorf("missing -key (or %s)", envKey)
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("key is not valid base64: %v", err)
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes after base64 decoding, got %d", len(raw))
+	}
+	return auth.NewAuthToken(key, salt), nil
+}
+
+// tokenArg 取唯一的位置参数作为token
+func tokenArg(fs *flag.FlagSet) (string, error) {
+	if fs.NArg() != 1 {
+		return "", errors.New("expected exactly one token argument")
+	}
+	return strings.TrimSpace(fs.Arg(0)), nil
+}
+
+func issue(args []string) error {
+	fs := flag.NewFlagSet("issue", flag.ExitOnError)
+	key, salt := keyFlags(fs, true)
+	user := fs.Int64("user", 0, "用户ID")
+	ttl := fs.Duration("ttl", time.Hour, "有效期，例如 30m、24h")
+	device := fs.String("device", "", "设备ID，可选")
+	roles := fs.String("roles", "", "角色，逗号分隔，可选")
+	bindDevice := fs.Bool("bind-device", false, "绑定到 -device 指定的设备")
+	ipPrefix := fs.String("ip-prefix", "", "绑定的网段，CIDR格式，可选")
+	jkt := fs.String("jkt", "", "绑定的客户端公钥 JWK thumbprint，可选")
+	fs.Parse(args)
+
+	if *user <= 0 {
+		return errors.New("missing -user")
+	}
+	if *ttl < time.Second {
+		return errors.New("-ttl must be at least 1s")
+	}
+	a, err := newAuthToken(*key, *salt)
+	if err != nil {
+		return err
+	}
+
+	if *ipPrefix != "" {
+		if _, _, err := net.ParseCIDR(*ipPrefix); err != nil {
+			return fmt.Errorf("invalid -ip-prefix: %v", err)
+		}
+	}
+	claims := &auth.Claims{
+		UserID:        *user,
+		DeviceID:      *device,
+		BindDevice:    *bindDevice,
+		IPPrefix:      *ipPrefix,
+		KeyThumbprint: *jkt,
+	}
+	if *roles != "" {
+		for _, r := range strings.Split(*roles, ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				claims.Roles = append(claims.Roles, r)
+			}
+		}
+	}
+	token, err := a.GenerateTokenWithClaims(claims, int64(*ttl/time.Second))
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
+
+// inspectOutput inspect 的输出格式，时间戳同时给出可读的时间
+type inspectOutput struct {
+	UserID    int64    `json:"user_id"`
+	TokenID   string   `json:"token_id"`
+	Salt      string   `json:"salt"`
+	IssuedAt  string   `json:"issued_at,omitempty"`
+	AuthTime  string   `json:"auth_time,omitempty"`
+	NotBefore string   `json:"not_before,omitempty"`
+	ExpireAt  string   `json:"expire_at"`
+	DeviceID  string   `json:"device_id,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	FamilyID  string   `json:"family_id,omitempty"`
+
+	BindDevice    bool   `json:"bind_device,omitempty"`
+	IPPrefix      string `json:"ip_prefix,omitempty"`
+	KeyThumbprint string `json:"key_thumbprint,omitempty"`
+}
+
+func inspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	key, _ := keyFlags(fs, false)
+	fs.Parse(args)
+
+	token, err := tokenArg(fs)
+	if err != nil {
+		return err
+	}
+	a, err := newAuthToken(*key, "")
+	if err != nil {
+		return err
+	}
+	claims, salt, err := a.Inspect(token)
+	if err != nil {
+		return errors.New(reason(err))
+	}
+
+	out := inspectOutput{
+		UserID:    claims.UserID,
+		TokenID:   claims.TokenID,
+		Salt:      salt,
+		IssuedAt:  formatUnix(claims.IssuedAt),
+		AuthTime:  formatUnix(claims.AuthTime),
+		NotBefore: formatUnix(claims.NotBefore),
+		ExpireAt:  formatUnix(claims.ExpireAt),
+		DeviceID:  claims.DeviceID,
+		Roles:     claims.Roles,
+		FamilyID:  claims.FamilyID,
+
+		BindDevice:    claims.BindDevice,
+		IPPrefix:      claims.IPPrefix,
+		KeyThumbprint: claims.KeyThumbprint,
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func explain(args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	key, salt := keyFlags(fs, true)
+	fs.Parse(args)
+
+	token, err := tokenArg(fs)
+	if err != nil {
+		return err
+	}
+	a, err := newAuthToken(*key, *salt)
+	if err != nil {
+		return err
+	}
+
+	// 不使用 ParseClaims，绑定了设备、IP或公钥的token离线无法校验绑定，只列出绑定的内容
+	claims, tokenSalt, err := a.Inspect(token)
+	if err != nil {
+		fmt.Println("invalid:", reason(err))
+		os.Exit(1)
+	}
+	if tokenSalt != *salt {
+		fmt.Println("invalid:", reason(auth.ErrSaltMismatch))
+		fmt.Printf("  token salt:    %q\n  expected salt: %q\n", tokenSalt, *salt)
+		os.Exit(1)
+	}
+
+	if err = a.ValidateClaims(claims); err != nil {
+		fmt.Println("invalid:", reason(err))
+		switch {
+		case errors.Is(err, auth.ErrTokenExpired):
+			fmt.Printf("  expired at %s (%s ago)\n", formatUnix(claims.ExpireAt), since(claims.ExpireAt))
+		case errors.Is(err, auth.ErrTokenNotYetValid):
+			fmt.Printf("  valid from %s (in %s)\n", formatUnix(claims.NotBefore), until(claims.NotBefore))
+		}
+		printBinding(claims)
+		os.Exit(1)
+	}
+
+	fmt.Printf("valid: user %d, expires at %s (in %s)\n",
+		claims.UserID, formatUnix(claims.ExpireAt), until(claims.ExpireAt))
+	printBinding(claims)
+	return nil
+}
+
+// printBinding 列出token的绑定，请求时需要满足这些条件
+func printBinding(claims *auth.Claims) {
+	if claims.BindDevice {
+		fmt.Printf("  bound to device %q\n", claims.DeviceID)
+	}
+	if claims.IPPrefix != "" {
+		fmt.Printf("  bound to ip prefix %s\n", claims.IPPrefix)
+	}
+	if claims.KeyThumbprint != "" {
+		fmt.Printf("  bound to client key %s, requests need a proof of possession\n", claims.KeyThumbprint)
+	}
+}
+
+func genkey(args []string) error {
+	fs := flag.NewFlagSet("genkey", flag.ExitOnError)
+	size := fs.Int("size", 32, "密钥字节数，AuthToken 需要32字节")
+	fs.Parse(args)
+
+	if *size <= 0 {
+		return errors.New("-size must be positive")
+	}
+	key, err := crypto.GenerateRandomKey(*size)
+	if err != nil {
+		return err
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(key))
+	return nil
+}
+
+// reason 把解析错误转换成便于排查的说明
+func reason(err error) string {
+	var hexErr hex.InvalidByteError
+	switch {
+	case errors.Is(err, auth.ErrInvalidTokenFormat):
+		return "bad format: token is not a hex string or has missing fields (truncated or altered?)"
+	case errors.Is(err, auth.ErrInvalidUserID):
+		return "bad format: user id field is not a number"
+	case errors.Is(err, auth.ErrInvalidExpiration):
+		return "bad format: expiration field is not a number"
+	case errors.Is(err, auth.ErrSaltMismatch):
+		return "salt mismatch: token was issued by a service with a different salt"
+	case errors.Is(err, auth.ErrTokenExpired):
+		return "token expired"
+	case errors.Is(err, auth.ErrTokenNotYetValid):
+		return "token not valid yet: not-before is in the future (clock skew?)"
+	case errors.Is(err, auth.ErrTokenRevoked):
+		return "token revoked"
+	case errors.As(err, &hexErr):
+		return "bad format: token is not a hex string"
+	default:
+		return "decrypt failed: wrong key or corrupted token (" + err.Error() + ")"
+	}
+}
+
+func formatUnix(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).Format(time.RFC3339)
+}
+
+func since(ts int64) time.Duration {
+	return time.Since(time.Unix(ts, 0)).Truncate(time.Second)
+}
+
+func until(ts int64) time.Duration {
+	return time.Until(time.Unix(ts, 0)).Truncate(time.Second)
+}
@@ -3,6 +3,8 @@
 // @Desc 错误码定义
 package common
 
+import "errors"
+
 // 定义错误码
 const (
 	Success      = 0
@@ -10,6 +12,7 @@ const (
 	AuthFailed   = 10002
 	LimitReached = 10003
 	NotExist     = 10004
+	Unavailable  = 10005
 )
 
 // 错误信息映射
@@ -19,6 +22,7 @@ var errorMessages = map[int]string{
 	AuthFailed:   "鉴权失败",
 	LimitReached: "请求次数已达上限",
 	NotExist:     "数据不存在",
+	Unavailable:  "服务暂不可用",
 }
 
 // GetErrorMessage 根据错误码获取错误信息
@@ -28,3 +32,29 @@ func GetErrorMessage(code int) string {
 	}
 	return "Unknown Error"
 }
+
+// Error 带错误码的错误，错误信息取自错误码映射
+type Error struct {
+	Code int
+}
+
+// NewError 根据错误码创建错误
+func NewError(code int) *Error {
+	return &Error{Code: code}
+}
+
+func (e *Error) Error() string {
+	return GetErrorMessage(e.Code)
+}
+
+// GetErrorCode 获取错误中的错误码，不是 *Error 时返回 defaultCode
+func GetErrorCode(err error, defaultCode int) int {
+	if err == nil {
+		return Success
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return defaultCode
+}
@@ -30,3 +30,9 @@ func GetQueueName(serviceName string) string {
 		return ""
 	}
 }
+
+const (
+	AuthRevokeRoutingKey = "auth.revoke.%s"       // token吊销广播的路由键，%s为节点ID
+	AuthRevokeBindingKey = "auth.revoke.*"        // 订阅所有节点的吊销广播
+	AuthRevokeQueue      = "auth_revoke_queue_%s" // 每个节点独立的吊销广播队列，%s为节点ID
+)
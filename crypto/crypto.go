@@ -17,6 +17,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"github.com/Kyle91/haven/clock"
 	"hash/crc32"
 	"io"
 	"math/rand"
@@ -92,6 +93,9 @@ func Aes256DecryptBase64(key []byte, ciphertext string) ([]byte, error) {
 	if len(ciphertextBytes) < aes.BlockSize {
 		return nil, errors.New("ciphertext too short")
 	}
+	if len(ciphertextBytes)%aes.BlockSize != 0 {
+		return nil, errors.New("ciphertext is not a multiple of the block size")
+	}
 
 	plaintext := make([]byte, len(ciphertextBytes))
 
@@ -151,6 +155,10 @@ func Aes256Decrypt(key []byte, cipherBytes []byte) ([]byte, error) {
 	if len(cipherBytes) < aes.BlockSize {
 		return nil, errors.New("ciphertext too short")
 	}
+	// 长度不是块大小的整数倍时 CryptBlocks 会panic
+	if len(cipherBytes)%aes.BlockSize != 0 {
+		return nil, errors.New("ciphertext is not a multiple of the block size")
+	}
 
 	plaintext := make([]byte, len(cipherBytes))
 
@@ -269,6 +277,18 @@ func str2long(s string, w bool) []uint64 {
 //	@param expiry
 //	@return string
 func XXTeaEncrypt(str, key string, expiry int) string {
+	return XXTeaEncryptWithClock(str, key, expiry, clock.System)
+}
+
+// XXTeaEncryptWithClock
+//
+//	@Description: 带过期时间的加密，使用指定的时钟计算过期时间
+//	@param str
+//	@param key
+//	@param expiry 有效期(秒)，0表示不过期
+//	@param clk
+//	@return string
+func XXTeaEncryptWithClock(str, key string, expiry int, clk clock.Clock) string {
 	if str == "" {
 		return ""
 	}
@@ -277,7 +297,7 @@ func XXTeaEncrypt(str, key string, expiry int) string {
 
 	// Expiry time
 	if expiry != 0 {
-		str = fmt.Sprintf("%010d", expiry+int(time.Now().Unix())) + str
+		str = fmt.Sprintf("%010d", expiry+int(clock.OrDefault(clk).Now().Unix())) + str
 	} else {
 		str = fmt.Sprintf("%010d", 0) + str
 	}
@@ -326,6 +346,17 @@ func XXTeaEncrypt(str, key string, expiry int) string {
 //	@param key
 //	@return string
 func XXTeaDecrypt(str, key string) string {
+	return XXTeaDecryptWithClock(str, key, clock.System)
+}
+
+// XXTeaDecryptWithClock
+//
+//	@Description: 带过期时间的解密，使用指定的时钟判断是否过期
+//	@param str
+//	@param key
+//	@param clk
+//	@return string 过期时返回空字符串
+func XXTeaDecryptWithClock(str, key string, clk clock.Clock) string {
 	if str == "" {
 		return ""
 	}
@@ -357,7 +388,7 @@ func XXTeaDecrypt(str, key string) string {
 			y = v[p] // Then update y
 		}
 		z := v[n]
-		mx := ((z >> 5 & 0x07ffffff) ^ y<<2) + ((y >> 3 & 0x1fffffff) ^ z<<4) ^ (sum ^ y) + (k[n&3^int(e)] ^ z)
+		mx := ((z >> 5 & 0x07ffffff) ^ y<<2) + ((y >> 3 & 0x1fffffff) ^ z<<4) ^ (sum ^ y) + (k[e] ^ z)
 		v[0] = v[0] - mx  // Update v[0]
 		y = v[0]          // Then update y
 		sum = sum - delta // Update sum
@@ -365,11 +396,15 @@ func XXTeaDecrypt(str, key string) string {
 
 	// Convert result to string
 	ret := long2str(v, true)
+	// 密钥错误或者数据被篡改时长度字段不对，返回空字符串
+	if len(ret) < 10+ckeyLength {
+		return ""
+	}
 	dateLen := len(ret)
 	ret = ret[:dateLen-ckeyLength]
 
 	// Check if the expiry time is valid
-	if ret[:10] == "0000000000" || (time.Now().Unix()-int64(toInt(ret[:10]))) > 0 {
+	if ret[:10] == "0000000000" || toInt(ret[:10])-clock.OrDefault(clk).Now().Unix() > 0 {
 		ret = ret[10:]
 	} else {
 		ret = ""
@@ -0,0 +1,62 @@
+// @Author Eric
+// @Date 2026/10/29 11:00:00
+// @Desc 加解密的测试
+package crypto
+
+import (
+	"bytes"
+	"github.com/Kyle91/haven/clock"
+	"testing"
+	"time"
+)
+
+func TestXXTeaRoundTrip(t *testing.T) {
+	clk := clock.NewMockClock(time.Unix(1700000000, 0))
+	tests := []struct {
+		name   string
+		plain  string
+		expiry int
+		after  time.Duration
+		want   string
+	}{
+		{"no expiry", "hello", 0, 24 * time.Hour, "hello"},
+		{"before expiry", "hello world", 60, 59 * time.Second, "hello world"},
+		{"after expiry", "hello world", 60, 61 * time.Second, ""},
+		{"utf-8", "你好，世界", 0, 0, "你好，世界"},
+		{"long", string(bytes.Repeat([]byte("0123456789"), 50)), 0, 0, string(bytes.Repeat([]byte("0123456789"), 50))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := clock.NewMockClock(clk.Now())
+			for _, key := range []string{"k", "a longer key", "0123456789abcdef0123"} {
+				encrypted := XXTeaEncryptWithClock(tt.plain, key, tt.expiry, c)
+				if encrypted == "" {
+					t.Fatal("empty ciphertext")
+				}
+				dc := clock.NewMockClock(c.Now().Add(tt.after))
+				if got := XXTeaDecryptWithClock(encrypted, key, dc); got != tt.want {
+					t.Fatalf("key %q: want %q, got %q", key, tt.want, got)
+				}
+			}
+		})
+	}
+	if got := XXTeaDecrypt(XXTeaEncrypt("secret", "key", 0), "other key"); got == "secret" {
+		t.Fatal("decrypted with wrong key")
+	}
+}
+
+func TestAes256(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	encrypted, err := Aes256Encrypt(key, []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := Aes256Decrypt(key, encrypted)
+	if err != nil || string(plain) != "payload" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+	// 长度不是块大小整数倍时返回错误而不是panic
+	if _, err = Aes256Decrypt(key, encrypted[:len(encrypted)-1]); err == nil {
+		t.Fatal("expected error for truncated ciphertext")
+	}
+}
@@ -5,11 +5,13 @@ go 1.22
 require (
 	github.com/google/uuid v1.6.0
 	github.com/streadway/amqp v1.1.0
+	github.com/valyala/fasthttp v1.55.0
+	golang.org/x/crypto v0.31.0
 )
 
 require (
 	github.com/andybalholm/brotli v1.1.0 // indirect
 	github.com/klauspost/compress v1.17.9 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	github.com/valyala/fasthttp v1.55.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 )
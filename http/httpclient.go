@@ -6,6 +6,7 @@ package http
 import (
 	"fmt"
 	"github.com/valyala/fasthttp"
+	"time"
 )
 
 func PostRequest(url, userAgent string, body []byte) ([]byte, error) {
@@ -31,8 +32,8 @@ func PostRequest(url, userAgent string, body []byte) ([]byte, error) {
 		return nil, fmt.Errorf("发送请求时出错: %v", err)
 	}
 
-	// 返回响应Body
-	return resp.Body(), nil
+	// 返回响应Body，resp会被回收，需要拷贝一份
+	return append([]byte(nil), resp.Body()...), nil
 }
 
 func GetRequest(url, userAgent string) ([]byte, error) {
@@ -56,6 +57,100 @@ func GetRequest(url, userAgent string) ([]byte, error) {
 		return nil, fmt.Errorf("发送请求时出错: %v", err)
 	}
 
-	// 返回响应Body
-	return resp.Body(), nil
+	// 返回响应Body，resp会被回收，需要拷贝一份
+	return append([]byte(nil), resp.Body()...), nil
+}
+
+// GetRequestTimeout
+//
+//	@Description: 带超时的GET请求，响应状态码不是2xx时返回错误
+//	@param url
+//	@param userAgent
+//	@param timeout 包括连接、发送和读取响应的总时间
+//	@return []byte
+//	@return error
+func GetRequestTimeout(url, userAgent string, timeout time.Duration) ([]byte, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.Header.SetMethod(fasthttp.MethodGet)
+	req.SetRequestURI(url)
+	req.Header.Set("User-Agent", userAgent)
+
+	client := &fasthttp.Client{}
+	if err := client.DoTimeout(req, resp, timeout); err != nil {
+		return nil, fmt.Errorf("发送请求时出错: %v", err)
+	}
+	if code := resp.StatusCode(); code < 200 || code >= 300 {
+		return nil, fmt.Errorf("响应状态码 %d", code)
+	}
+
+	// resp会被回收，需要拷贝一份Body
+	return append([]byte(nil), resp.Body()...), nil
+}
+
+// RequestSigner 请求签名接口，auth.RequestSigner 实现了该接口
+type RequestSigner interface {
+	Sign(req *fasthttp.Request) error
+}
+
+// PostRequestSigned
+//
+//	@Description: 发送签名的POST请求，用于服务间调用
+//	@param url
+//	@param userAgent
+//	@param body
+//	@param signer 签名器
+//	@return []byte
+//	@return error
+func PostRequestSigned(url, userAgent string, body []byte, signer RequestSigner) ([]byte, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.SetRequestURI(url)
+	req.SetBody(body)
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.SetContentType("application/json")
+
+	return doSigned(req, signer)
+}
+
+// GetRequestSigned
+//
+//	@Description: 发送签名的GET请求，用于服务间调用
+//	@param url
+//	@param userAgent
+//	@param signer 签名器
+//	@return []byte
+//	@return error
+func GetRequestSigned(url, userAgent string, signer RequestSigner) ([]byte, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.Header.SetMethod(fasthttp.MethodGet)
+	req.SetRequestURI(url)
+	req.Header.Set("User-Agent", userAgent)
+
+	return doSigned(req, signer)
+}
+
+// doSigned 签名后发送请求，签名必须在请求内容设置完之后进行
+func doSigned(req *fasthttp.Request, signer RequestSigner) ([]byte, error) {
+	if err := signer.Sign(req); err != nil {
+		return nil, fmt.Errorf("请求签名出错: %v", err)
+	}
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	client := &fasthttp.Client{}
+	if err := client.Do(req, resp); err != nil {
+		return nil, fmt.Errorf("发送请求时出错: %v", err)
+	}
+
+	// resp会被回收，需要拷贝一份Body
+	return append([]byte(nil), resp.Body()...), nil
 }
@@ -11,6 +11,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -86,6 +87,8 @@ func getServiceName() string {
 
 // log logs the message with the specified level
 func (l *Logger) log(level, msg string) {
+	countEntry(level)
+
 	// Prepare the log entry
 	entry := fmt.Sprintf("%s [%s] %s %s:%d %s\n",
 		time.Now().Format(time.RFC3339Nano), level, l.serviceName, getFuncName(4), getLine(4), msg)
@@ -95,6 +98,7 @@ func (l *Logger) log(level, msg string) {
 	case l.logCh <- entry:
 	default:
 		// If the channel is full, write directly to the file
+		atomic.AddUint64(&queueFull, 1)
 		l.writeLogEntry(entry)
 	}
 }
@@ -135,6 +139,7 @@ func (l *Logger) writeLogEntry(entry string) {
 	// Write to the log file
 	n, err := l.writer.WriteString(entry)
 	if err != nil {
+		atomic.AddUint64(&writeErrors, 1)
 		fmt.Fprintf(os.Stderr, "failed to write to log file: %v\n", err)
 	}
 
@@ -146,6 +151,7 @@ func (l *Logger) writeLogEntry(entry string) {
 
 // rotateLogs rotates the log files
 func (l *Logger) rotateLogs() {
+	atomic.AddUint64(&rotations, 1)
 	l.flush()
 	l.file.Close()
 
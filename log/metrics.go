@@ -0,0 +1,83 @@
+// @Author Eric
+// @Date 2026/10/28 10:00:00
+// @Desc 日志的统计，各级别的条数、队列满时直接写文件的次数、写入失败和轮替次数，可以导出为Prometheus文本格式
+package log
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+// Stats 日志统计
+type Stats struct {
+	Entries     map[string]uint64 // 级别 -> 条数
+	Queued      int               // 队列中等待写入的条数
+	QueueFull   uint64            // 队列满时在调用方协程中直接写文件的次数
+	WriteErrors uint64            // 写文件失败的次数
+	Rotations   uint64            // 轮替次数
+}
+
+var levels = []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+
+var (
+	entryCounts = map[string]*uint64{}
+	queueFull   uint64
+	writeErrors uint64
+	rotations   uint64
+)
+
+func init() {
+	for _, level := range levels {
+		entryCounts[level] = new(uint64)
+	}
+}
+
+func countEntry(level string) {
+	if n, ok := entryCounts[level]; ok {
+		atomic.AddUint64(n, 1)
+	}
+}
+
+// GetStats 当前的日志统计
+func GetStats() Stats {
+	s := Stats{
+		Entries:     make(map[string]uint64, len(levels)),
+		Queued:      len(logger.logCh),
+		QueueFull:   atomic.LoadUint64(&queueFull),
+		WriteErrors: atomic.LoadUint64(&writeErrors),
+		Rotations:   atomic.LoadUint64(&rotations),
+	}
+	for _, level := range levels {
+		s.Entries[level] = atomic.LoadUint64(entryCounts[level])
+	}
+	return s
+}
+
+// WritePrometheus
+//
+//	@Description: 以Prometheus文本格式输出日志统计，指标以 haven_log_ 开头
+//	@param w
+//	@return error
+func WritePrometheus(w io.Writer) error {
+	s := GetStats()
+	var b strings.Builder
+
+	b.WriteString("# HELP haven_log_entries_total Log entries written by level.\n")
+	b.WriteString("# TYPE haven_log_entries_total counter\n")
+	for _, level := range levels {
+		fmt.Fprintf(&b, "haven_log_entries_total{level=%q} %d\n", level, s.Entries[level])
+	}
+	writeMetric(&b, "haven_log_queued", "gauge", "Log entries waiting to be written.", uint64(s.Queued))
+	writeMetric(&b, "haven_log_queue_full_total", "counter", "Log entries written synchronously because the queue was full.", s.QueueFull)
+	writeMetric(&b, "haven_log_write_errors_total", "counter", "Failed writes to the log file.", s.WriteErrors)
+	writeMetric(&b, "haven_log_rotations_total", "counter", "Log file rotations.", s.Rotations)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMetric(b *strings.Builder, name, kind, help string, value uint64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
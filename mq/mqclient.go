@@ -136,17 +136,83 @@ func (c *MQClient) Publish(routingKey, queueName string, message []byte) error {
 //	@param handler
 //	@return error
 func (c *MQClient) Subscribe(queueName, routingKey string, handler func(amqp.Delivery)) error {
+	msgs, ch, err := c.consume(queueName, routingKey)
+	if err != nil {
+		return err
+	}
+
+	name := "mq:" + routingKey
+	routine.GoNamed(name, func() {
+		defer ch.Close()
+		for d := range msgs {
+			d := d
+			// 单条消息处理panic不影响后续消息的消费
+			routine.Protect(name, func() {
+				handler(d)
+			})
+		}
+	})
+
+	log.Infof("Subscribed to topic: %s", routingKey)
+	return nil
+}
+
+// SubscribeKeyed
+//
+//	@Description: 订阅消息，按key分发到执行器，同一个key(例如用户ID)的消息按顺序处理，不同key并行处理
+//	@receiver c
+//	@param queueName 队列名
+//	@param routingKey 路由键
+//	@param executor 执行器，设置 KeyedOptions.Block 时邮箱满会暂停消费
+//	@param key 从消息中取出key
+//	@param handler
+//	@return error
+func (c *MQClient) SubscribeKeyed(queueName, routingKey string, executor *routine.KeyedExecutor,
+	key func(amqp.Delivery) string, handler func(amqp.Delivery)) error {
+	msgs, ch, err := c.consume(queueName, routingKey)
+	if err != nil {
+		return err
+	}
+
+	name := "mq:" + routingKey
+	routine.GoNamed(name, func() {
+		defer ch.Close()
+		for d := range msgs {
+			d := d
+			var k string
+			routine.Protect(name, func() {
+				k = key(d)
+			})
+			if err := executor.Submit(k, func() { handler(d) }); err != nil {
+				log.Errorf("dispatch message from %s with key %s failed: %v", routingKey, k, err)
+			}
+		}
+	})
+
+	log.Infof("Subscribed to topic: %s", routingKey)
+	return nil
+}
+
+// consume
+//
+//	@Description: 确保队列存在并开始消费，返回的channel需要在消费结束后关闭
+//	@receiver c
+//	@param queueName
+//	@param routingKey
+//	@return <-chan amqp.Delivery
+//	@return *amqp.Channel
+//	@return error
+func (c *MQClient) consume(queueName, routingKey string) (<-chan amqp.Delivery, *amqp.Channel, error) {
 	// 确保交换器和路由键存在
 	err := c.ensureQueueAndExchange(common.ExchangeName, queueName, routingKey)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	ch, err := c.conn.Channel()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	defer ch.Close()
 
 	msgs, err := ch.Consume(
 		queueName, // queue
@@ -158,17 +224,11 @@ func (c *MQClient) Subscribe(queueName, routingKey string, handler func(amqp.Del
 		nil,       // args
 	)
 	if err != nil {
-		return err
+		ch.Close()
+		return nil, nil, err
 	}
-
-	routine.Go(func() {
-		for d := range msgs {
-			handler(d)
-		}
-	})
-
-	log.Infof("Subscribed to topic: %s", routingKey)
-	return nil
+	// channel关闭后msgs也会关闭，所以不能在这里关闭channel
+	return msgs, ch, nil
 }
 
 func (c *MQClient) Close() error {
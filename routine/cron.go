@@ -0,0 +1,270 @@
+// @Author Eric
+// @Date 2026/10/26 10:00:00
+// @Desc cron表达式解析，支持5段(分 时 日 月 周)和6段(秒 分 时 日 月 周)，以及 @daily 等描述符
+package routine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule 解析后的cron表达式，每个字段是一个位图
+type CronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	location                              *time.Location
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronSecond = cronField{min: 0, max: 59}
+	cronMinute = cronField{min: 0, max: 59}
+	cronHour   = cronField{min: 0, max: 23}
+	cronDom    = cronField{min: 1, max: 31}
+	cronMonth  = cronField{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 周日可以写成0或7
+	cronDow = cronField{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// cronStar 字段为*时的标记位，用于日和周的匹配规则
+const cronStar = 1 << 63
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// ParseCron
+//
+//	@Description: 解析cron表达式，可以用 CRON_TZ=Asia/Shanghai 前缀指定时区
+//	例如 "0 5 * * *" 每天05:00，"*/30 * * * * *" 每30秒，"CRON_TZ=Asia/Shanghai @daily"
+//	@param expr
+//	@param loc 没有 CRON_TZ 前缀时使用的时区，为nil时使用 time.Local
+//	@return *CronSchedule
+//	@return error
+func ParseCron(expr string, loc *time.Location) (*CronSchedule, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "CRON_TZ=") || strings.HasPrefix(expr, "TZ=") {
+		tz, rest, _ := strings.Cut(expr, " ")
+		_, name, _ := strings.Cut(tz, "=")
+		l, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron time zone %s: %v", name, err)
+		}
+		loc, expr = l, strings.TrimSpace(rest)
+	}
+	if d, ok := cronDescriptors[strings.ToLower(expr)]; ok {
+		expr = d
+	}
+
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 or 6 fields", expr)
+	}
+
+	s := &CronSchedule{location: loc}
+	specs := []struct {
+		bits  *uint64
+		field cronField
+	}{
+		{&s.second, cronSecond},
+		{&s.minute, cronMinute},
+		{&s.hour, cronHour},
+		{&s.dom, cronDom},
+		{&s.month, cronMonth},
+		{&s.dow, cronDow},
+	}
+	for i, spec := range specs {
+		bits, err := parseCronField(fields[i], spec.field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %v", expr, err)
+		}
+		*spec.bits = bits
+	}
+	// 7也表示周日
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+// parseCronField 解析单个字段，支持 * ? 列表 范围 步长 和名称
+func parseCronField(text string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(text, ",") {
+		rangeText, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+			step = n
+		}
+
+		var lo, hi int
+		switch {
+		case rangeText == "*" || rangeText == "?":
+			lo, hi = f.min, f.max
+			if !hasStep {
+				bits |= cronStar
+			}
+		case strings.Contains(rangeText, "-"):
+			a, b, _ := strings.Cut(rangeText, "-")
+			var err error
+			if lo, err = cronValue(a, f); err != nil {
+				return 0, err
+			}
+			if hi, err = cronValue(b, f); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := cronValue(rangeText, f)
+			if err != nil {
+				return 0, err
+			}
+			// 5/15 表示从5开始每15
+			lo, hi = v, v
+			if hasStep {
+				hi = f.max
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("invalid range %q", part)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func cronValue(text string, f cronField) (int, error) {
+	if v, ok := f.names[strings.ToLower(text)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(text)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %q out of range [%d, %d]", text, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next
+//
+//	@Description: 计算t之后的下一次执行时间，5年内没有匹配时返回零值
+//	@receiver s
+//	@param t
+//	@return time.Time
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	origin := t.Location()
+	t = t.In(s.location)
+	// 从下一秒开始
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+
+	// 找到匹配的字段之前，把更小的字段清零
+	added := false
+	yearLimit := t.Year() + 5
+
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for 1<<uint(t.Month())&s.month == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, s.location)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location)
+		}
+		t = t.AddDate(0, 0, 1)
+		// 夏令时切换的那天，零点可能不存在
+		if h := t.Hour(); h != 0 {
+			if h > 12 {
+				t = t.Add(time.Duration(24-h) * time.Hour)
+			} else {
+				t = t.Add(-time.Duration(h) * time.Hour)
+			}
+		}
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for 1<<uint(t.Hour())&s.hour == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, s.location)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+
+	for 1<<uint(t.Minute())&s.minute == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	for 1<<uint(t.Second())&s.second == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto wrap
+		}
+	}
+
+	return t.In(origin)
+}
+
+// dayMatches 日和周都有限制时满足任意一个即可，有一个是*时只看另一个
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&s.dom != 0
+	dowMatch := 1<<uint(t.Weekday())&s.dow != 0
+	if s.dom&cronStar != 0 || s.dow&cronStar != 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
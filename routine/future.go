@@ -0,0 +1,87 @@
+// @Author Eric
+// @Date 2026/10/25 10:00:00
+// @Desc 带返回值的任务，panic会转换成错误返回
+package routine
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError 任务panic时返回的错误
+type PanicError struct {
+	Value interface{} // recover得到的值
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Future 异步任务的结果
+type Future[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Submit
+//
+//	@Description: 在默认协程池中执行带返回值的任务
+//	@param fn
+//	@return *Future[T]
+func Submit[T any](fn func() (T, error)) *Future[T] {
+	return SubmitTo(Default(), fn)
+}
+
+// SubmitTo 在指定协程池中执行带返回值的任务，协程池拒绝时 Get 返回 ErrPoolClosed 或 ErrPoolFull
+func SubmitTo[T any](p *Pool, fn func() (T, error)) *Future[T] {
+	f := &Future[T]{done: make(chan struct{})}
+	err := p.TryGoNamed("", func() {
+		defer close(f.done)
+		f.err = p.safeCall("", func() error {
+			var err error
+			f.value, err = fn()
+			return err
+		})
+	})
+	if err != nil {
+		f.err = err
+		close(f.done)
+	}
+	return f
+}
+
+// Get
+//
+//	@Description: 等待任务完成并返回结果
+//	@receiver f
+//	@param ctx 等待的截止时间，超时后任务仍然会继续执行
+//	@return T
+//	@return error 任务返回的错误，panic时为 *PanicError，等待超时时为 ctx.Err()
+func (f *Future[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Done 任务完成时关闭
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// safeCall 执行fn，panic时记录并返回 *PanicError，不会重新panic
+func (p *Pool) safeCall(name string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			info := p.reportPanic(name, r, debug.Stack())
+			err = &PanicError{Value: r, Stack: info.Stack}
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,87 @@
+// @Author Eric
+// @Date 2026/10/25 10:30:00
+// @Desc 一组相关的任务，类似 errgroup，第一个错误会取消其他任务
+package routine
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Group 在协程池中执行一组任务，Wait 返回所有任务的错误
+type Group struct {
+	pool   *Pool
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+// NewGroup
+//
+//	@Description: 创建任务组，任务在默认协程池中执行
+//	@param ctx 父ctx，为nil时使用 context.Background()
+//	@return *Group
+func NewGroup(ctx context.Context) *Group {
+	return NewGroupIn(Default(), ctx)
+}
+
+// NewGroupIn 创建在指定协程池中执行的任务组
+func NewGroupIn(p *Pool, ctx context.Context) *Group {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{pool: p, ctx: ctx, cancel: cancel}
+}
+
+// Context 任务组的ctx，任意任务失败或者 Wait 返回后取消
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Go
+//
+//	@Description: 提交任务，任务返回错误或panic时取消其他任务，
+//	协程池拒绝任务时同样作为任务失败处理
+//	@receiver g
+//	@param task 参数为任务组的ctx
+func (g *Group) Go(task func(ctx context.Context) error) {
+	g.wg.Add(1)
+	err := g.pool.TryGoNamed("", func() {
+		defer g.wg.Done()
+
+		// 已经有任务失败时，还没开始的任务不再执行
+		if g.ctx.Err() != nil {
+			return
+		}
+		if err := g.pool.safeCall("", func() error { return task(g.ctx) }); err != nil {
+			g.fail(err)
+		}
+	})
+	if err != nil {
+		g.wg.Done()
+		g.fail(err)
+	}
+}
+
+// fail 记录错误并取消其他任务
+func (g *Group) fail(err error) {
+	g.mu.Lock()
+	g.errs = append(g.errs, err)
+	g.mu.Unlock()
+	g.cancel()
+}
+
+// Wait 等待所有任务结束，返回所有任务的错误，用 errors.Join 合并，可以用 errors.Is/As 判断
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return errors.Join(g.errs...)
+}
@@ -0,0 +1,203 @@
+// @Author Eric
+// @Date 2026/10/29 18:30:00
+// @Desc Future和Group在协程池拒绝任务时的测试
+package routine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newFullPool 返回唯一的worker和队列都被占满的协程池，release后恢复
+func newFullPool(t *testing.T, policy RejectPolicy) (*Pool, func()) {
+	t.Helper()
+	p := NewPool(PoolOptions{Name: t.Name(), Workers: 1, QueueSize: 1, Reject: policy})
+	block := make(chan struct{})
+	started := make(chan struct{})
+	if err := p.TryGo(func() { close(started); <-block }); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := p.TryGo(func() {}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Shutdown(context.Background()) })
+	var once sync.Once
+	return p, func() { once.Do(func() { close(block) }) }
+}
+
+// rejectCases 向占满的协程池提交时各个策略的结果，runs表示任务最终会执行
+var rejectCases = []struct {
+	name   string
+	policy RejectPolicy
+	runs   bool
+}{
+	{"block", RejectBlock, true},
+	{"drop", RejectDrop, false},
+	{"caller runs", RejectCallerRuns, true},
+	{"error", RejectError, false},
+}
+
+// submitToFullPool 用submit向占满的协程池提交任务，检查任务是否执行，
+// RejectBlock 时检查submit阻塞到有空位为止。返回submit的错误和已经空闲的协程池
+func submitToFullPool(t *testing.T, policy RejectPolicy, runs bool, submit func(p *Pool, task func()) error) (error, *Pool) {
+	t.Helper()
+	p, release := newFullPool(t, policy)
+	defer release()
+
+	ran := make(chan struct{})
+	var once sync.Once
+	errc := make(chan error, 1)
+	go func() {
+		errc <- submit(p, func() { once.Do(func() { close(ran) }) })
+	}()
+	wait := func() error {
+		select {
+		case err := <-errc:
+			return err
+		case <-time.After(time.Second):
+			t.Fatal("submit blocked")
+			return nil
+		}
+	}
+	var err error
+	if policy == RejectBlock {
+		select {
+		case err = <-errc:
+			t.Fatalf("submit did not block on a full queue: %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+		release()
+		err = wait()
+	} else {
+		// 其他策略不等待空位，在占满时就返回
+		err = wait()
+		release()
+	}
+	deadline := time.Now().Add(time.Second)
+	for p.Running() > 0 || p.Waiting() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("pool not idle")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-ran:
+		if !runs {
+			t.Fatal("rejected task ran")
+		}
+	default:
+		if runs {
+			t.Fatal("task did not run")
+		}
+	}
+	return err, p
+}
+
+func TestSubmitRejected(t *testing.T) {
+	p, release := newFullPool(t, RejectError)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := SubmitTo(p, func() (int, error) { return 1, nil }).Get(ctx); !errors.Is(err, ErrPoolFull) {
+		t.Fatalf("want ErrPoolFull, got %v", err)
+	}
+
+	// 只停止接受任务，不等待被阻塞的任务
+	p.close()
+	if _, err := SubmitTo(p, func() (int, error) { return 1, nil }).Get(ctx); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("want ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestSubmitPanic(t *testing.T) {
+	p := NewPool(PoolOptions{Name: t.Name(), Workers: 1, OnPanic: func(PanicInfo) {}})
+	defer p.Shutdown(context.Background())
+
+	v, err := SubmitTo(p, func() (int, error) { return 42, nil }).Get(context.Background())
+	if err != nil || v != 42 {
+		t.Fatalf("want 42, got %d %v", v, err)
+	}
+	var pe *PanicError
+	if _, err = SubmitTo(p, func() (int, error) { panic("boom") }).Get(context.Background()); !errors.As(err, &pe) {
+		t.Fatalf("want *PanicError, got %v", err)
+	}
+}
+
+func TestGroupRejected(t *testing.T) {
+	p, release := newFullPool(t, RejectError)
+
+	g := NewGroupIn(p, context.Background())
+	g.Go(func(ctx context.Context) error { return nil })
+	if g.Context().Err() == nil {
+		t.Fatal("rejected task did not cancel the group")
+	}
+	release()
+
+	done := make(chan error)
+	go func() { done <- g.Wait() }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrPoolFull) {
+			t.Fatalf("want ErrPoolFull, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait blocked after rejected task")
+	}
+}
+
+func TestGroupFirstErrorCancels(t *testing.T) {
+	p := NewPool(PoolOptions{Name: t.Name(), Workers: 4})
+	defer p.Shutdown(context.Background())
+
+	errBoom := errors.New("boom")
+	g := NewGroupIn(p, context.Background())
+	g.Go(func(ctx context.Context) error { return errBoom })
+	g.Go(func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+			return errors.New("not cancelled")
+		}
+	})
+	if err := g.Wait(); !errors.Is(err, errBoom) || err.Error() != errBoom.Error() {
+		t.Fatalf("want only %v, got %v", errBoom, err)
+	}
+}
+
+func TestSubmitRejectPolicies(t *testing.T) {
+	for _, tt := range rejectCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err, _ := submitToFullPool(t, tt.policy, tt.runs, func(p *Pool, task func()) error {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				_, err := SubmitTo(p, func() (int, error) { task(); return 1, nil }).Get(ctx)
+				return err
+			})
+			// 丢弃的任务 Get 立即返回错误，不会等到ctx超时
+			if tt.runs && err != nil || !tt.runs && !errors.Is(err, ErrPoolFull) {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestGroupRejectPolicies(t *testing.T) {
+	for _, tt := range rejectCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err, _ := submitToFullPool(t, tt.policy, tt.runs, func(p *Pool, task func()) error {
+				g := NewGroupIn(p, context.Background())
+				g.Go(func(ctx context.Context) error { task(); return nil })
+				return g.Wait()
+			})
+			if tt.runs && err != nil || !tt.runs && !errors.Is(err, ErrPoolFull) {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
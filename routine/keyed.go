@@ -0,0 +1,189 @@
+// @Author Eric
+// @Date 2026/10/26 16:00:00
+// @Desc 按key串行执行，同一个key(例如用户ID、房间ID)的任务按提交顺序执行，不同key并行
+package routine
+
+import (
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"sync"
+)
+
+var ErrMailboxFull = errors.New("routine mailbox full")
+
+// KeyedOptions 按key串行执行的配置
+type KeyedOptions struct {
+	Name        string // 名称，用于日志
+	Shards      int    // 邮箱数量，key哈希到邮箱上，默认256
+	MailboxSize int    // 每个邮箱最多排队的任务数，默认1024
+	Block       bool   // 邮箱满时阻塞等待，默认返回 ErrMailboxFull
+	Pool        *Pool  // 执行任务的协程池，默认使用默认协程池
+}
+
+// KeyedExecutor 按key串行执行，同一个邮箱同一时间最多占用协程池的一个协程，
+// 繁忙的邮箱会一直占用这个协程直到清空，协程池的 Workers 需要比同时繁忙的邮箱数多
+type KeyedExecutor struct {
+	opts      KeyedOptions
+	mailboxes []*mailbox
+}
+
+type keyedTask struct {
+	seq uint64 // 邮箱内的序号，用于提交失败时找到这个任务
+	key string
+	fn  func()
+}
+
+// mailbox 串行执行的邮箱，多个key可能共用一个邮箱
+type mailbox struct {
+	mu       sync.Mutex
+	notFull  *sync.Cond
+	tasks    []keyedTask
+	seq      uint64
+	backlog  map[string]int // key -> 排队和正在执行的任务数
+	draining bool           // 是否已经在协程池中执行
+}
+
+// NewKeyedExecutor 创建按key串行执行的执行器
+func NewKeyedExecutor(opts KeyedOptions) *KeyedExecutor {
+	if opts.Shards <= 0 {
+		opts.Shards = 256
+	}
+	if opts.MailboxSize <= 0 {
+		opts.MailboxSize = 1024
+	}
+	e := &KeyedExecutor{opts: opts, mailboxes: make([]*mailbox, opts.Shards)}
+	for i := range e.mailboxes {
+		m := &mailbox{backlog: make(map[string]int)}
+		m.notFull = sync.NewCond(&m.mu)
+		e.mailboxes[i] = m
+	}
+	return e
+}
+
+// Submit
+//
+//	@Description: 提交任务，同一个key的任务按提交顺序执行
+//	@receiver e
+//	@param key
+//	@param fn
+//	@return error 邮箱满且没有设置 Block 时返回 ErrMailboxFull，
+//	需要启动邮箱而协程池拒绝时返回协程池的错误，这个任务不会执行，邮箱中已有的任务保留
+func (e *KeyedExecutor) Submit(key string, fn func()) error {
+	m := e.mailbox(key)
+
+	m.mu.Lock()
+	for len(m.tasks) >= e.opts.MailboxSize {
+		if !e.opts.Block {
+			m.mu.Unlock()
+			return ErrMailboxFull
+		}
+		m.notFull.Wait()
+	}
+	m.seq++
+	seq := m.seq
+	m.tasks = append(m.tasks, keyedTask{seq: seq, key: key, fn: fn})
+	m.backlog[key]++
+	start := !m.draining
+	m.draining = true
+	m.mu.Unlock()
+
+	if start {
+		return e.start(m, seq)
+	}
+	return nil
+}
+
+// SubmitInt 以整数作为key提交，例如用户ID
+func (e *KeyedExecutor) SubmitInt(key int64, fn func()) error {
+	return e.Submit(strconv.FormatInt(key, 10), fn)
+}
+
+// Backlog 指定key排队和正在执行的任务数
+func (e *KeyedExecutor) Backlog(key string) int {
+	m := e.mailbox(key)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.backlog[key]
+}
+
+// Backlogs 所有有任务的key及其任务数，用于排查
+func (e *KeyedExecutor) Backlogs() map[string]int {
+	result := make(map[string]int)
+	for _, m := range e.mailboxes {
+		m.mu.Lock()
+		for k, n := range m.backlog {
+			result[k] = n
+		}
+		m.mu.Unlock()
+	}
+	return result
+}
+
+func (e *KeyedExecutor) mailbox(key string) *mailbox {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return e.mailboxes[h.Sum32()%uint32(len(e.mailboxes))]
+}
+
+func (e *KeyedExecutor) pool() *Pool {
+	if e.opts.Pool != nil {
+		return e.opts.Pool
+	}
+	return Default()
+}
+
+// start 把邮箱交给协程池执行，协程池拒绝时只撤回序号为seq的任务，
+// 邮箱回到空闲状态，其他任务保留到下一次提交时执行
+func (e *KeyedExecutor) start(m *mailbox, seq uint64) error {
+	err := e.pool().TryGoNamed(e.opts.Name, func() {
+		e.drain(m)
+	})
+	if err == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	for i, t := range m.tasks {
+		if t.seq == seq {
+			m.tasks = append(m.tasks[:i], m.tasks[i+1:]...)
+			m.done(t.key)
+			break
+		}
+	}
+	m.draining = false
+	m.notFull.Broadcast()
+	m.mu.Unlock()
+	return err
+}
+
+// drain 在当前协程中依次执行邮箱中的任务，直到清空
+// 不在协程池的worker中重新提交自己，RejectBlock 时会等待自己占用的worker而死锁，RejectCallerRuns 时会无限递归
+func (e *KeyedExecutor) drain(m *mailbox) {
+	for {
+		m.mu.Lock()
+		if len(m.tasks) == 0 {
+			m.draining = false
+			m.mu.Unlock()
+			return
+		}
+		t := m.tasks[0]
+		m.tasks[0] = keyedTask{}
+		m.tasks = m.tasks[1:]
+		m.notFull.Signal()
+		m.mu.Unlock()
+
+		e.pool().Protect(e.opts.Name, t.fn)
+
+		m.mu.Lock()
+		m.done(t.key)
+		m.mu.Unlock()
+	}
+}
+
+// done 减少key的任务数，调用方需要持有 m.mu
+func (m *mailbox) done(key string) {
+	if m.backlog[key]--; m.backlog[key] <= 0 {
+		delete(m.backlog, key)
+	}
+}
@@ -0,0 +1,157 @@
+// @Author Eric
+// @Date 2026/10/29 19:30:00
+// @Desc 按key串行执行的测试
+package routine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedOrder(t *testing.T) {
+	policies := map[string]RejectPolicy{"block": RejectBlock, "caller runs": RejectCallerRuns}
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			// worker比邮箱少，drain在worker中重新提交自己时会死锁或递归
+			p := NewPool(PoolOptions{Name: t.Name(), Workers: 2, QueueSize: 1, Reject: policy})
+			defer p.Shutdown(context.Background())
+			e := NewKeyedExecutor(KeyedOptions{Shards: 8, MailboxSize: 10000, Block: true, Pool: p})
+
+			const keys, perKey = 16, 200
+			var mu sync.Mutex
+			got := make(map[string][]int)
+			var wg sync.WaitGroup
+			wg.Add(keys * perKey)
+			for i := 0; i < perKey; i++ {
+				for k := 0; k < keys; k++ {
+					key, i := fmt.Sprint(k), i
+					if err := e.Submit(key, func() {
+						mu.Lock()
+						got[key] = append(got[key], i)
+						mu.Unlock()
+						wg.Done()
+					}); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			done := make(chan struct{})
+			go func() { wg.Wait(); close(done) }()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("keyed executor stalled")
+			}
+			for key, seq := range got {
+				for i, v := range seq {
+					if v != i {
+						t.Fatalf("key %s out of order at %d: %v", key, i, seq[:i+1])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestKeyedPoolRejected(t *testing.T) {
+	// 队列满时丢弃和拒绝都要撤回任务，不能让邮箱停在draining
+	for name, policy := range map[string]RejectPolicy{"drop": RejectDrop, "error": RejectError} {
+		t.Run(name, func(t *testing.T) {
+			p, release := newFullPool(t, policy)
+			e := NewKeyedExecutor(KeyedOptions{Shards: 1, Pool: p})
+
+			// 模拟另一个提交方留下的任务
+			ran := make(chan string, 3)
+			m := e.mailbox("a")
+			m.seq++
+			m.tasks = append(m.tasks, keyedTask{seq: m.seq, key: "a", fn: func() { ran <- "earlier" }})
+			m.backlog["a"]++
+
+			if err := e.Submit("a", func() { ran <- "rejected" }); !errors.Is(err, ErrPoolFull) {
+				t.Fatalf("want ErrPoolFull, got %v", err)
+			}
+			// 只撤回被拒绝的任务，邮箱回到空闲，已有的任务保留
+			if n := e.Backlog("a"); n != 1 {
+				t.Fatalf("want backlog 1, got %d", n)
+			}
+			if m.draining {
+				t.Fatal("mailbox left draining")
+			}
+
+			release()
+			deadline := time.Now().Add(time.Second)
+			for p.Running() > 0 || p.Waiting() > 0 {
+				if time.Now().After(deadline) {
+					t.Fatal("pool not idle")
+				}
+				time.Sleep(time.Millisecond)
+			}
+			if err := e.Submit("a", func() { ran <- "later" }); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range []string{"earlier", "later"} {
+				select {
+				case got := <-ran:
+					if got != want {
+						t.Fatalf("want %s, got %s", want, got)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("%s not run", want)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyedMailboxFull(t *testing.T) {
+	p := NewPool(PoolOptions{Name: t.Name(), Workers: 1})
+	defer p.Shutdown(context.Background())
+	e := NewKeyedExecutor(KeyedOptions{Shards: 1, MailboxSize: 1, Pool: p})
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	if err := e.Submit("a", func() { close(started); <-block }); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := e.Submit("a", func() {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Submit("b", func() {}); !errors.Is(err, ErrMailboxFull) {
+		t.Fatalf("want ErrMailboxFull, got %v", err)
+	}
+	if n := e.Backlog("a"); n != 2 {
+		t.Fatalf("want backlog 2, got %d", n)
+	}
+	close(block)
+}
+
+func TestKeyedRejectPolicies(t *testing.T) {
+	for _, tt := range rejectCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var e *KeyedExecutor
+			err, _ := submitToFullPool(t, tt.policy, tt.runs, func(p *Pool, task func()) error {
+				e = NewKeyedExecutor(KeyedOptions{Shards: 1, Pool: p})
+				return e.Submit("a", task)
+			})
+			if tt.runs && err != nil || !tt.runs && !errors.Is(err, ErrPoolFull) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			// 被丢弃或拒绝后邮箱不能停在draining，之后的任务照常执行
+			done := make(chan struct{})
+			if err = e.Submit("a", func() { close(done) }); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("mailbox stuck after rejection")
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// @Author Eric
+// @Date 2026/10/25 15:00:00
+// @Desc 任务panic的处理，记录ERROR日志和堆栈，调用回调，开发环境下重新panic
+package routine
+
+import (
+	"github.com/Kyle91/haven/log"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// PanicInfo 任务panic的信息
+type PanicInfo struct {
+	Pool  string      // 协程池名称
+	Task  string      // 任务名称，GoNamed 提交的任务才有
+	Value interface{} // recover得到的值
+	Stack []byte
+	Time  time.Time
+}
+
+var panicHook atomic.Value // func(PanicInfo)
+
+// OnPanic 设置全局的panic回调，例如上报到监控，协程池配置了 PoolOptions.OnPanic 时不会调用
+func OnPanic(fn func(info PanicInfo)) {
+	panicHook.Store(fn)
+}
+
+// Panics 累计panic次数
+func (p *Pool) Panics() uint64 {
+	return atomic.LoadUint64(&p.panics)
+}
+
+// Protect
+//
+//	@Description: 在当前协程中执行fn，panic时和协程池中的任务一样记录和回调，然后正常返回(haven_dev 下会重新panic)
+//	适合在长时间运行的循环中处理单条消息，避免一条消息panic导致整个循环退出
+//	@receiver p
+//	@param name 任务名称
+//	@param fn
+func (p *Pool) Protect(name string, fn func()) {
+	defer p.catchPanic(name)
+	fn()
+}
+
+// catchPanic 捕获并处理panic，需要直接defer调用
+func (p *Pool) catchPanic(name string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	info := p.reportPanic(name, r, debug.Stack())
+	if rePanic {
+		panic(info.Value)
+	}
+}
+
+// reportPanic 记录日志、计数并调用回调，回调panic时也返回完整的信息
+func (p *Pool) reportPanic(name string, value interface{}, stack []byte) (info PanicInfo) {
+	atomic.AddUint64(&p.panics, 1)
+	info = PanicInfo{Pool: p.opts.Name, Task: name, Value: value, Stack: stack, Time: time.Now()}
+	log.Errorf("routine pool %s task %s panic: %v\n%s", info.Pool, info.Task, info.Value, info.Stack)
+
+	hook := p.opts.OnPanic
+	if hook == nil {
+		hook, _ = panicHook.Load().(func(PanicInfo))
+	}
+	if hook != nil {
+		// 回调本身panic时只记录日志
+		defer func() {
+			if err := recover(); err != nil {
+				log.Errorf("routine panic hook panic: %v", err)
+			}
+		}()
+		hook(info)
+	}
+	return info
+}
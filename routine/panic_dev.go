@@ -0,0 +1,8 @@
+//go:build haven_dev
+
+// @Author Eric
+// @Date 2026/10/25 15:00:00
+// @Desc 开发环境，使用 -tags haven_dev 编译时任务panic会在记录后重新panic，尽早暴露问题
+package routine
+
+const rePanic = true
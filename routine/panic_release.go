@@ -0,0 +1,8 @@
+//go:build !haven_dev
+
+// @Author Eric
+// @Date 2026/10/25 15:00:00
+// @Desc 默认不重新panic，见 panic_dev.go
+package routine
+
+const rePanic = false
@@ -0,0 +1,123 @@
+// @Author Eric
+// @Date 2026/10/31 11:00:00
+// @Desc 任务panic的回调、计数和 haven_dev 下重新panic的测试，两种构建都需要通过:
+// go test ./routine 和 go test -tags haven_dev ./routine
+package routine
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// panicRecorder 记录panic回调，协程池中的任务在worker协程中回调
+type panicRecorder struct {
+	mu    sync.Mutex
+	infos []PanicInfo
+}
+
+func (r *panicRecorder) OnPanic(info PanicInfo) {
+	r.mu.Lock()
+	r.infos = append(r.infos, info)
+	r.mu.Unlock()
+}
+
+func (r *panicRecorder) Infos() []PanicInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]PanicInfo(nil), r.infos...)
+}
+
+// protect 调用 Protect，返回 haven_dev 下重新抛出的值
+func protect(p *Pool, name string, fn func()) (rethrown interface{}) {
+	defer func() {
+		rethrown = recover()
+	}()
+	p.Protect(name, fn)
+	return nil
+}
+
+func TestProtectRePanic(t *testing.T) {
+	p := NewPool(PoolOptions{Name: t.Name(), OnPanic: func(PanicInfo) {}})
+	rethrown := protect(p, "job", func() { panic("boom") })
+	if rePanic {
+		if rethrown != "boom" {
+			t.Fatalf("haven_dev: want boom rethrown, got %v", rethrown)
+		}
+	} else if rethrown != nil {
+		t.Fatalf("want panic recovered, got %v rethrown", rethrown)
+	}
+
+	// 没有panic时不受影响
+	ran := false
+	if rethrown = protect(p, "job", func() { ran = true }); rethrown != nil || !ran {
+		t.Fatalf("want normal run, got ran %v, rethrown %v", ran, rethrown)
+	}
+}
+
+func TestOnPanicHooks(t *testing.T) {
+	global := &panicRecorder{}
+	OnPanic(global.OnPanic)
+	t.Cleanup(func() { OnPanic(nil) })
+
+	// 没有配置 PoolOptions.OnPanic 时使用全局回调
+	p := NewPool(PoolOptions{Name: "global"})
+	protect(p, "job", func() { panic("boom") })
+	infos := global.Infos()
+	if len(infos) != 1 {
+		t.Fatalf("want 1 global panic, got %d", len(infos))
+	}
+	if info := infos[0]; info.Pool != "global" || info.Task != "job" || info.Value != "boom" ||
+		!strings.Contains(string(info.Stack), "TestOnPanicHooks") || info.Time.IsZero() {
+		t.Fatalf("unexpected panic info %+v", info)
+	}
+
+	// 配置了协程池的回调时不再调用全局回调
+	own := &panicRecorder{}
+	q := NewPool(PoolOptions{Name: "own", OnPanic: own.OnPanic})
+	protect(q, "job", func() { panic("boom") })
+	if len(own.Infos()) != 1 || len(global.Infos()) != 1 {
+		t.Fatalf("want pool hook only, got %d pool, %d global", len(own.Infos()), len(global.Infos()))
+	}
+
+	// 回调本身panic时只记录日志
+	r := NewPool(PoolOptions{Name: "broken", OnPanic: func(PanicInfo) { panic("hook") }})
+	rethrown := protect(r, "job", func() { panic("boom") })
+	if rePanic && rethrown != "boom" || !rePanic && rethrown != nil {
+		t.Fatalf("hook panic escaped: %v", rethrown)
+	}
+	if r.Panics() != 1 {
+		t.Fatalf("want 1 panic, got %d", r.Panics())
+	}
+}
+
+func TestPanicCounters(t *testing.T) {
+	rec := &panicRecorder{}
+	p := NewPool(PoolOptions{Name: t.Name(), Workers: 1, OnPanic: rec.OnPanic})
+	defer p.Wait()
+	for i := 0; i < 3; i++ {
+		protect(p, "protect", func() { panic(i) })
+	}
+	protect(p, "protect", func() {})
+	if p.Panics() != 3 || p.Stats().Panicked != 3 {
+		t.Fatalf("want 3 panics, got %d, %d", p.Panics(), p.Stats().Panicked)
+	}
+	if rePanic {
+		// haven_dev 下worker中的panic会让进程退出
+		return
+	}
+
+	// panic的任务也算执行完，worker继续执行之后的任务
+	p.GoNamed("worker", func() { panic("boom") })
+	done := make(chan struct{})
+	p.Go(func() { close(done) })
+	<-done
+	waitUntil(t, "panic recorded", func() bool { return p.Panics() == 4 })
+	stats := p.Stats()
+	if stats.Panicked != 4 || stats.Completed != 2 || p.Workers() != 1 {
+		t.Fatalf("want 4 panics, 2 completed by 1 worker, got %+v, %d workers", stats, p.Workers())
+	}
+	if infos := rec.Infos(); infos[3].Task != "worker" || infos[3].Value != "boom" {
+		t.Fatalf("unexpected panic info %+v", infos[3])
+	}
+}
@@ -0,0 +1,360 @@
+// @Author Eric
+// @Date 2026/10/24 15:00:00
+// @Desc 有并发上限的协程池，worker按需创建，数量不超过 Workers
+package routine
+
+import (
+	"context"
+	"errors"
+	"github.com/Kyle91/haven/log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrPoolClosed = errors.New("routine pool closed")
+	ErrPoolFull   = errors.New("routine pool queue full")
+)
+
+// RejectPolicy 队列满时的处理策略
+type RejectPolicy int
+
+const (
+	RejectBlock      RejectPolicy = iota // 阻塞等待队列有空位
+	RejectDrop                           // 丢弃任务，Go 记录日志，TryGo 返回 ErrPoolFull
+	RejectCallerRuns                     // 在调用方的协程中执行
+	RejectError                          // 不执行，TryGo 返回 ErrPoolFull，和 RejectDrop 的区别只在于表达调用方自己处理拒绝
+)
+
+// PoolOptions 协程池配置
+type PoolOptions struct {
+	Name      string // 池名称，用于日志和统计的 pool 标签
+	Workers   int    // 最大并发数，默认3000
+	QueueSize int    // 所有worker都在忙时排队的任务数，默认等于 Workers
+
+	Reject RejectPolicy // 队列满时的处理策略，默认阻塞
+
+	TaskTimeout time.Duration // GoCtx 提交的任务的默认超时时间，0表示不限制
+
+	OnPanic func(info PanicInfo) // 任务panic时调用，为nil时使用 OnPanic 设置的全局回调
+}
+
+// task 队列中的任务
+type task struct {
+	name     string
+	fn       func()
+	enqueued time.Time // 提交时间，用于统计排队耗时
+}
+
+// Pool 协程池，最多同时运行 Workers 个任务
+type Pool struct {
+	opts  PoolOptions
+	queue chan task
+	wg    sync.WaitGroup // 未完成的任务
+
+	ctx      context.Context // Shutdown 时取消，GoCtx 的任务会收到通知
+	cancel   context.CancelFunc
+	mu       sync.RWMutex // 提交任务时持有读锁，关闭时持有写锁，保证关闭后不会再向队列发送
+	closed   bool
+	stopping chan struct{} // 开始关闭时关闭，唤醒阻塞在队列上的提交
+	stopOnce sync.Once
+
+	workers int32  // 已创建的worker数
+	idle    int32  // 空闲等待任务的worker数
+	running int32  // 正在执行的任务数
+	panics  uint64 // 累计panic次数
+
+	completed uint64     // 累计执行完的任务数
+	rejected  uint64     // 累计被拒绝的任务数
+	waitHist  *histogram // 排队耗时
+	execHist  *histogram // 执行耗时
+	active    sync.Map   // *runningTask -> struct{}，正在执行的任务
+}
+
+// NewPool
+//
+//	@Description: 创建协程池，worker在有任务时才创建，创建后一直保留到 Wait
+//	需要导出统计时调用 RegisterMetrics
+//	@param opts
+//	@return *Pool
+func NewPool(opts PoolOptions) *Pool {
+	if opts.Workers <= 0 {
+		opts.Workers = 3000
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = opts.Workers
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		opts:     opts,
+		queue:    make(chan task, opts.QueueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		stopping: make(chan struct{}),
+		waitHist: newHistogram(),
+		execHist: newHistogram(),
+	}
+	return p
+}
+
+// Name 池名称
+func (p *Pool) Name() string {
+	return p.opts.Name
+}
+
+// Go
+//
+//	@Description: 提交任务，有空闲worker时交给空闲worker，没有时创建新的worker，已达到上限则排队
+//	协程池已经关闭或者任务被拒绝时只记录日志，需要知道结果时使用 TryGo
+//	@receiver p
+//	@param fn
+func (p *Pool) Go(fn func()) {
+	p.GoNamed("", fn)
+}
+
+// GoNamed 提交任务，name会出现在panic日志和 PanicInfo 中，方便定位
+func (p *Pool) GoNamed(name string, fn func()) {
+	if err := p.submit(task{name: name, fn: fn}); err != nil {
+		log.Warnf("routine pool %s rejected task %s: %v", p.opts.Name, name, err)
+	}
+}
+
+// TryGo
+//
+//	@Description: 提交任务，队列满时按 PoolOptions.Reject 处理
+//	@receiver p
+//	@param fn
+//	@return error 协程池已经关闭时返回 ErrPoolClosed，策略为 RejectDrop 或 RejectError 且队列满时返回 ErrPoolFull
+//	返回错误时任务不会执行
+func (p *Pool) TryGo(fn func()) error {
+	return p.submit(task{fn: fn})
+}
+
+// TryGoNamed 和 TryGo 相同，任务有名称
+func (p *Pool) TryGoNamed(name string, fn func()) error {
+	return p.submit(task{name: name, fn: fn})
+}
+
+func (p *Pool) submit(t task) error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		atomic.AddUint64(&p.rejected, 1)
+		return ErrPoolClosed
+	}
+
+	t.enqueued = time.Now()
+	p.wg.Add(1)
+	if atomic.LoadInt32(&p.idle) == 0 && p.startWorker(t) {
+		p.mu.RUnlock()
+		return nil
+	}
+
+	if p.opts.Reject == RejectBlock {
+		defer p.mu.RUnlock()
+		select {
+		case p.queue <- t:
+			return nil
+		case <-p.stopping:
+			p.wg.Done()
+			atomic.AddUint64(&p.rejected, 1)
+			return ErrPoolClosed
+		}
+	}
+
+	select {
+	case p.queue <- t:
+		p.mu.RUnlock()
+		return nil
+	default:
+	}
+	// 不持有锁执行，避免任务里提交任务或者关闭协程池时死锁
+	p.mu.RUnlock()
+
+	switch p.opts.Reject {
+	case RejectCallerRuns:
+		p.execute(t)
+		return nil
+	default:
+		// 丢弃的任务也要返回错误，等待任务结果的调用方才能知道任务不会执行
+		p.wg.Done()
+		atomic.AddUint64(&p.rejected, 1)
+		return ErrPoolFull
+	}
+}
+
+// GoCtx
+//
+//	@Description: 提交可以取消的任务，ctx被取消、超时或者协程池 Shutdown 时，任务的ctx会被取消
+//	@receiver p
+//	@param ctx 为nil时使用 context.Background()
+//	@param task 返回的错误会记录日志
+func (p *Pool) GoCtx(ctx context.Context, task func(ctx context.Context) error) {
+	p.GoTimeout(ctx, p.opts.TaskTimeout, task)
+}
+
+// GoTimeout
+//
+//	@Description: 和 GoCtx 相同，单独指定任务的超时时间
+//	@receiver p
+//	@param ctx
+//	@param timeout 从任务开始执行时计算，0表示不限制
+//	@param task
+func (p *Pool) GoTimeout(ctx context.Context, timeout time.Duration, task func(ctx context.Context) error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	p.Go(func() {
+		// 排队期间已经取消的任务不再执行
+		if ctx.Err() != nil || p.ctx.Err() != nil {
+			return
+		}
+
+		taskCtx, cancel := p.taskContext(ctx, timeout)
+		defer cancel()
+		if err := task(taskCtx); err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				log.Warnf("routine pool %s task cancelled: %v", p.opts.Name, err)
+			} else {
+				log.Errorf("routine pool %s task failed: %v", p.opts.Name, err)
+			}
+		}
+	})
+}
+
+// taskContext 任务的ctx，调用方的ctx和协程池的ctx任意一个结束都会取消
+func (p *Pool) taskContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	taskCtx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(p.ctx, cancel)
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		taskCtx, cancelTimeout = context.WithTimeout(taskCtx, timeout)
+		return taskCtx, func() {
+			cancelTimeout()
+			stop()
+			cancel()
+		}
+	}
+	return taskCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// Context 协程池的ctx，Shutdown 时取消，长时间运行的任务可以监听它退出
+func (p *Pool) Context() context.Context {
+	return p.ctx
+}
+
+// Wait 等待所有任务完成，调用后不再接受新的任务
+func (p *Pool) Wait() {
+	p.close()
+	p.wg.Wait()
+}
+
+// Shutdown
+//
+//	@Description: 停止接受新的任务，取消 GoCtx 提交的任务，等待所有任务结束
+//	@receiver p
+//	@param ctx 等待的截止时间
+//	@return error 截止时间前没有全部结束时返回 ctx.Err()，剩余的任务会在后台继续执行
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.close()
+	p.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close 停止接受新的任务，已经排队的任务会继续执行
+func (p *Pool) close() {
+	p.stopOnce.Do(func() {
+		close(p.stopping)
+	})
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+}
+
+// Closed 是否已经关闭
+func (p *Pool) Closed() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.closed
+}
+
+// Workers 已创建的worker数
+func (p *Pool) Workers() int {
+	return int(atomic.LoadInt32(&p.workers))
+}
+
+// Running 正在执行的任务数
+func (p *Pool) Running() int {
+	return int(atomic.LoadInt32(&p.running))
+}
+
+// Waiting 排队中的任务数
+func (p *Pool) Waiting() int {
+	return len(p.queue)
+}
+
+// startWorker 未达到上限时创建worker，并直接执行第一个任务
+func (p *Pool) startWorker(first task) bool {
+	for {
+		n := atomic.LoadInt32(&p.workers)
+		if int(n) >= p.opts.Workers {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&p.workers, n, n+1) {
+			go p.worker(first)
+			return true
+		}
+	}
+}
+
+func (p *Pool) worker(t task) {
+	defer atomic.AddInt32(&p.workers, -1)
+
+	for {
+		p.execute(t)
+
+		atomic.AddInt32(&p.idle, 1)
+		next, ok := <-p.queue
+		atomic.AddInt32(&p.idle, -1)
+		if !ok {
+			return
+		}
+		t = next
+	}
+}
+
+// execute 执行单个任务，panic不会导致worker退出
+func (p *Pool) execute(t task) {
+	rt := &runningTask{name: t.name, start: time.Now()}
+	p.waitHist.observe(rt.start.Sub(t.enqueued))
+	p.active.Store(rt, struct{}{})
+	atomic.AddInt32(&p.running, 1)
+	defer func() {
+		p.execHist.observe(time.Since(rt.start))
+		p.active.Delete(rt)
+		atomic.AddUint64(&p.completed, 1)
+		atomic.AddInt32(&p.running, -1)
+		p.wg.Done()
+	}()
+	defer p.catchPanic(t.name)
+	t.fn()
+}
@@ -0,0 +1,235 @@
+// @Author Eric
+// @Date 2026/10/31 10:00:00
+// @Desc 协程池的并发上限、排队、关闭和可取消任务的测试
+package routine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitUntil 等待其他协程中的状态满足条件
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolWorkerLimit(t *testing.T) {
+	p := NewPool(PoolOptions{Name: t.Name(), Workers: 3, QueueSize: 100})
+	release := make(chan struct{})
+	var active, maxActive, runs int32
+	for i := 0; i < 20; i++ {
+		p.Go(func() {
+			n := atomic.AddInt32(&active, 1)
+			for {
+				m := atomic.LoadInt32(&maxActive)
+				if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&active, -1)
+			atomic.AddInt32(&runs, 1)
+		})
+	}
+
+	// 超过 Workers 的任务排队，不会创建更多的worker
+	waitUntil(t, "workers busy", func() bool { return p.Running() == 3 })
+	if p.Workers() != 3 || p.Waiting() != 17 {
+		t.Fatalf("want 3 workers and 17 waiting, got %d and %d", p.Workers(), p.Waiting())
+	}
+	close(release)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 20 || maxActive != 3 {
+		t.Fatalf("want 20 runs at most 3 at once, got %d runs, %d at once", runs, maxActive)
+	}
+}
+
+func TestPoolQueueSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		workers   int
+		queueSize int
+		wantQueue int
+	}{
+		{"default", 2, 0, 2},
+		{"larger than workers", 2, 5, 5},
+		{"smaller than workers", 4, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool(PoolOptions{Name: t.Name(), Workers: tt.workers, QueueSize: tt.queueSize, Reject: RejectError})
+			release := make(chan struct{})
+			defer func() {
+				close(release)
+				p.Shutdown(context.Background())
+			}()
+
+			// 先占满所有worker，排队的数量只由 QueueSize 决定
+			for i := 0; i < tt.workers+tt.wantQueue; i++ {
+				if err := p.TryGo(func() { <-release }); err != nil {
+					t.Fatalf("task %d: %v", i+1, err)
+				}
+			}
+			if err := p.TryGo(func() {}); !errors.Is(err, ErrPoolFull) {
+				t.Fatalf("want ErrPoolFull, got %v", err)
+			}
+			if p.Workers() != tt.workers || p.Waiting() != tt.wantQueue {
+				t.Fatalf("want %d workers and %d waiting, got %d and %d", tt.workers, tt.wantQueue, p.Workers(), p.Waiting())
+			}
+		})
+	}
+}
+
+func TestPoolShutdownDeadline(t *testing.T) {
+	p := NewPool(PoolOptions{Name: t.Name(), Workers: 2})
+	release := make(chan struct{})
+	var done int32
+	p.Go(func() {
+		<-release
+		atomic.AddInt32(&done, 1)
+	})
+	// GoCtx 的任务在 Shutdown 时收到取消
+	cancelled := make(chan struct{})
+	p.GoCtx(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	waitUntil(t, "tasks started", func() bool { return p.Running() == 2 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want DeadlineExceeded, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("GoCtx task not cancelled on shutdown")
+	}
+	if err := p.TryGo(func() {}); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("want ErrPoolClosed after shutdown, got %v", err)
+	}
+
+	// 超过截止时间的任务在后台继续执行完
+	close(release)
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if done != 1 {
+		t.Fatal("running task abandoned")
+	}
+}
+
+func TestGoCtxCancelledInQueue(t *testing.T) {
+	p := NewPool(PoolOptions{Name: t.Name(), Workers: 1, QueueSize: 2})
+	release := make(chan struct{})
+	p.Go(func() { <-release })
+	waitUntil(t, "worker busy", func() bool { return p.Running() == 1 })
+
+	var mu sync.Mutex
+	var ran []string
+	task := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+			return nil
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.GoCtx(ctx, task("cancelled"))
+	p.GoCtx(context.Background(), task("active"))
+	// 排队期间取消，轮到时不再执行
+	cancel()
+	close(release)
+	waitUntil(t, "pool idle", func() bool { return p.Running() == 0 && p.Waiting() == 0 })
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ran) != 1 || ran[0] != "active" {
+		t.Fatalf("want only active task run, got %v", ran)
+	}
+	p.Shutdown(context.Background())
+}
+
+func TestPoolRejectPolicies(t *testing.T) {
+	for _, tt := range rejectCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var callerRan bool
+			err, p := submitToFullPool(t, tt.policy, tt.runs, func(p *Pool, task func()) error {
+				var done atomic.Bool
+				err := p.TryGo(func() {
+					task()
+					done.Store(true)
+				})
+				// RejectCallerRuns 在返回前已经在调用方的协程中执行完
+				callerRan = done.Load()
+				return err
+			})
+			if tt.runs && err != nil || !tt.runs && !errors.Is(err, ErrPoolFull) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if tt.policy == RejectCallerRuns && !callerRan {
+				t.Fatal("task not run by caller")
+			}
+			var wantRejected uint64
+			if !tt.runs {
+				wantRejected = 1
+			}
+			if got := p.Stats().Rejected; got != wantRejected {
+				t.Fatalf("want %d rejected, got %d", wantRejected, got)
+			}
+		})
+	}
+}
+
+func TestPoolRejectBlockShutdown(t *testing.T) {
+	p, release := newFullPool(t, RejectBlock)
+	defer release()
+	errc := make(chan error, 1)
+	go func() { errc <- p.TryGo(func() { t.Error("task ran after shutdown") }) }()
+	select {
+	case err := <-errc:
+		t.Fatalf("submit did not block: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// 关闭时唤醒阻塞的提交
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	p.Shutdown(ctx)
+	select {
+	case err := <-errc:
+		if !errors.Is(err, ErrPoolClosed) {
+			t.Fatalf("want ErrPoolClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("submit still blocked after shutdown")
+	}
+}
+
+func TestPoolRejectDropGo(t *testing.T) {
+	p, release := newFullPool(t, RejectDrop)
+	// Go 丢弃任务时只记录日志
+	p.Go(func() { t.Error("dropped task ran") })
+	release()
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Stats().Rejected; got != 1 {
+		t.Fatalf("want 1 rejected, got %d", got)
+	}
+}
@@ -0,0 +1,156 @@
+// @Author Eric
+// @Date 2026/10/28 14:00:00
+// @Desc 协程池的登记，导出登记的协程池的统计，Prometheus文本格式
+package routine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Kyle91/haven/log"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrMetricsNameEmpty  = errors.New("routine pool name required for metrics")
+	ErrMetricsRegistered = errors.New("routine pool name already registered for metrics")
+)
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*Pool) // 名称 -> 协程池
+)
+
+// RegisterMetrics
+//
+//	@Description: 登记协程池，之后 Pools、Dump、WritePrometheus 会包含它
+//	名称用作 pool 标签，不能为空，也不能和已经登记的协程池重复
+//	@param p
+//	@return error
+func RegisterMetrics(p *Pool) error {
+	name := p.opts.Name
+	if name == "" {
+		return ErrMetricsNameEmpty
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		return fmt.Errorf("%w: %s", ErrMetricsRegistered, name)
+	}
+	registry[name] = p
+	return nil
+}
+
+// UnregisterMetrics 取消登记，协程池关闭后不会自动取消，返回是否登记过
+func UnregisterMetrics(p *Pool) bool {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if registry[p.opts.Name] != p {
+		return false
+	}
+	delete(registry, p.opts.Name)
+	return true
+}
+
+// Pools 所有登记的协程池，按名称排序
+func Pools() []*Pool {
+	registryMu.Lock()
+	pools := make([]*Pool, 0, len(registry))
+	for _, p := range registry {
+		pools = append(pools, p)
+	}
+	registryMu.Unlock()
+
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].opts.Name < pools[j].opts.Name
+	})
+	return pools
+}
+
+// Dump 输出所有登记的协程池的状态，见 Pool.Dump
+func Dump(w io.Writer, longerThan time.Duration) error {
+	for _, p := range Pools() {
+		if err := p.Dump(w, longerThan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WritePrometheus
+//
+//	@Description: 以Prometheus文本格式输出所有登记的协程池的统计(见 RegisterMetrics)，以及日志的统计(见 log.WritePrometheus)
+//	协程池的指标以 haven_routine_ 开头，用 pool 标签区分
+//	@param w
+//	@return error
+func WritePrometheus(w io.Writer) error {
+	pools := Pools()
+	stats := make([]PoolStats, len(pools))
+	for i, p := range pools {
+		stats[i] = p.Stats()
+	}
+
+	var b strings.Builder
+	gauge := func(name, help string, value func(s PoolStats) int) {
+		writeHeader(&b, name, "gauge", help)
+		for _, s := range stats {
+			fmt.Fprintf(&b, "%s{pool=\"%s\"} %d\n", name, escapeLabel(s.Name), value(s))
+		}
+	}
+	counter := func(name, help string, value func(s PoolStats) uint64) {
+		writeHeader(&b, name, "counter", help)
+		for _, s := range stats {
+			fmt.Fprintf(&b, "%s{pool=\"%s\"} %d\n", name, escapeLabel(s.Name), value(s))
+		}
+	}
+	histogram := func(name, help string, value func(s PoolStats) Histogram) {
+		writeHeader(&b, name, "histogram", help)
+		for _, s := range stats {
+			writeHistogram(&b, name, escapeLabel(s.Name), value(s))
+		}
+	}
+
+	gauge("haven_routine_workers", "Worker goroutines currently started.", func(s PoolStats) int { return s.Workers })
+	gauge("haven_routine_running", "Tasks currently running.", func(s PoolStats) int { return s.Running })
+	gauge("haven_routine_queued", "Tasks waiting in the queue.", func(s PoolStats) int { return s.Queued })
+	counter("haven_routine_completed_total", "Tasks finished, including panicked ones.", func(s PoolStats) uint64 { return s.Completed })
+	counter("haven_routine_rejected_total", "Tasks rejected because the pool was closed or full.", func(s PoolStats) uint64 { return s.Rejected })
+	counter("haven_routine_panicked_total", "Tasks that panicked.", func(s PoolStats) uint64 { return s.Panicked })
+	histogram("haven_routine_queue_wait_seconds", "Time tasks spent waiting in the queue.", func(s PoolStats) Histogram { return s.QueueWait })
+	histogram("haven_routine_execution_seconds", "Task execution time.", func(s PoolStats) Histogram { return s.Execution })
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	return log.WritePrometheus(w)
+}
+
+func writeHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeHistogram Prometheus的区间是累计的
+func writeHistogram(b *strings.Builder, name, pool string, h Histogram) {
+	var cumulative uint64
+	for i, bound := range h.Bounds {
+		cumulative += h.Counts[i]
+		fmt.Fprintf(b, "%s_bucket{pool=\"%s\",le=\"%s\"} %d\n", name, pool, formatSeconds(bound), cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{pool=\"%s\",le=\"+Inf\"} %d\n", name, pool, h.Count)
+	fmt.Fprintf(b, "%s_sum{pool=\"%s\"} %s\n", name, pool, formatSeconds(h.Sum))
+	fmt.Fprintf(b, "%s_count{pool=\"%s\"} %d\n", name, pool, h.Count)
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
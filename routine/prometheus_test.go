@@ -0,0 +1,91 @@
+// @Author Eric
+// @Date 2026/10/29 20:30:00
+// @Desc 协程池统计的登记和Prometheus输出的测试
+package routine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegisterMetrics(t *testing.T) {
+	p := NewPool(PoolOptions{Name: t.Name(), Workers: 1})
+	defer p.Shutdown(context.Background())
+
+	// 创建时不会自动登记
+	for _, q := range Pools() {
+		if q == p {
+			t.Fatal("pool registered without RegisterMetrics")
+		}
+	}
+
+	tests := []struct {
+		name string
+		pool *Pool
+		want error
+	}{
+		{"empty name", NewPool(PoolOptions{Workers: 1}), ErrMetricsNameEmpty},
+		{"first", p, nil},
+		{"same pool again", p, ErrMetricsRegistered},
+		{"duplicate name", NewPool(PoolOptions{Name: t.Name(), Workers: 1}), ErrMetricsRegistered},
+	}
+	for _, tt := range tests {
+		if err := RegisterMetrics(tt.pool); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: want %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	// 重名的协程池不能取消别人的登记
+	if UnregisterMetrics(tests[3].pool) {
+		t.Fatal("unregistered a pool that was never registered")
+	}
+	if !UnregisterMetrics(p) || UnregisterMetrics(p) {
+		t.Fatal("UnregisterMetrics should succeed exactly once")
+	}
+	if err := RegisterMetrics(tests[3].pool); err != nil {
+		t.Fatalf("name not released: %v", err)
+	}
+	UnregisterMetrics(tests[3].pool)
+}
+
+func TestWritePrometheus(t *testing.T) {
+	name := `metrics "a"`
+	p := NewPool(PoolOptions{Name: name, Workers: 1, OnPanic: func(PanicInfo) {}})
+	other := NewPool(PoolOptions{Name: t.Name() + "-unregistered", Workers: 1})
+	if err := RegisterMetrics(p); err != nil {
+		t.Fatal(err)
+	}
+	defer UnregisterMetrics(p)
+
+	p.Go(func() {})
+	p.Go(func() { panic("boom") })
+	other.Go(func() {})
+	// 关闭后仍然保留登记，可以读取最终的统计
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	other.Shutdown(context.Background())
+
+	var b strings.Builder
+	if err := WritePrometheus(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE haven_routine_completed_total counter",
+		`haven_routine_completed_total{pool="metrics \"a\""} 2`,
+		`haven_routine_panicked_total{pool="metrics \"a\""} 1`,
+		`haven_routine_execution_seconds_count{pool="metrics \"a\""} 2`,
+		`haven_routine_execution_seconds_bucket{pool="metrics \"a\"",le="+Inf"} 2`,
+		"haven_log_entries_total",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, other.Name()) {
+		t.Fatalf("unregistered pool exported:\n%s", out)
+	}
+}
@@ -0,0 +1,213 @@
+// @Author Eric
+// @Date 2026/10/27 15:00:00
+// @Desc 失败重试，支持固定间隔、指数退避和去相关抖动，用于MQ连接、HTTP请求、数据库操作等
+package routine
+
+import (
+	"context"
+	"errors"
+	"github.com/Kyle91/haven/log"
+	"math/rand"
+	"time"
+)
+
+// Backoff 计算下一次重试前的等待时间
+type Backoff interface {
+	// Next attempt 是已经失败的次数，从1开始，prev 是上一次的等待时间，第一次为0
+	Next(attempt int, prev time.Duration) time.Duration
+}
+
+// ConstantBackoff 固定间隔
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+func (b ConstantBackoff) Next(attempt int, prev time.Duration) time.Duration {
+	return b.Delay
+}
+
+// ExponentialBackoff 指数退避，第n次等待 Base*Factor^(n-1)，不超过 Max
+type ExponentialBackoff struct {
+	Base   time.Duration // 第一次等待时间，默认100ms
+	Max    time.Duration // 最大等待时间，默认30秒
+	Factor float64       // 倍数，默认2
+	Jitter float64       // 随机浮动的比例，0.2表示在 [0.8, 1.2] 倍之间，默认不浮动
+}
+
+func (b ExponentialBackoff) Next(attempt int, prev time.Duration) time.Duration {
+	base, max, factor := b.Base, b.Max, b.Factor
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	if factor < 1 {
+		factor = 2
+	}
+
+	d := float64(base)
+	for i := 1; i < attempt && d < float64(max); i++ {
+		d *= factor
+	}
+	if b.Jitter > 0 {
+		d *= 1 - b.Jitter + 2*b.Jitter*rand.Float64()
+	}
+	if d > float64(max) {
+		return max
+	}
+	return time.Duration(d)
+}
+
+// DecorrelatedJitter 去相关抖动，每次在 [Base, 上一次*3) 之间随机，不超过 Max
+// 大量客户端同时重试时比指数退避更分散
+type DecorrelatedJitter struct {
+	Base time.Duration // 最小等待时间，默认100ms
+	Max  time.Duration // 最大等待时间，默认30秒
+}
+
+func (b DecorrelatedJitter) Next(attempt int, prev time.Duration) time.Duration {
+	base, max := b.Base, b.Max
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	if prev < base {
+		prev = base
+	}
+	d := base + time.Duration(rand.Int63n(int64(prev*3-base)+1))
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// RetryAttempt 一次失败的尝试
+type RetryAttempt struct {
+	Attempt int           // 第几次尝试，从1开始
+	Err     error         // 这一次的错误
+	Delay   time.Duration // 下一次重试前的等待时间，不再重试时为0
+	Elapsed time.Duration // 从第一次尝试开始经过的时间
+	Retry   bool          // 是否还会重试
+}
+
+// RetryPolicy 重试策略
+type RetryPolicy struct {
+	Backoff     Backoff       // 等待时间，默认 ExponentialBackoff{}
+	MaxAttempts int           // 最多尝试的次数，包括第一次，默认3，小于0表示不限制
+	MaxElapsed  time.Duration // 最长的总时间，等待会超过时不再重试，默认不限制
+	// Retryable 判断错误是否可以重试，默认除了 Permanent 包装的错误和ctx的错误都重试
+	Retryable func(err error) bool
+	// OnAttempt 每次失败后调用，可以用 LogAttempts 记录日志
+	OnAttempt func(a RetryAttempt)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 包装不需要重试的错误，例如参数错误、认证失败，Retry 返回原始的错误，
+// 被 fmt.Errorf 等继续包装时返回包装后的错误，错误信息中不会多出任何内容
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// LogAttempts 每次失败时记录 WARN 日志，不再重试时记录 ERROR 日志
+func LogAttempts(name string) func(a RetryAttempt) {
+	return func(a RetryAttempt) {
+		if a.Retry {
+			log.Warnf("routine retry %s attempt %d failed: %v, retrying in %s", name, a.Attempt, a.Err, a.Delay)
+			return
+		}
+		log.Errorf("routine retry %s gave up after %d attempts in %s: %v", name, a.Attempt, a.Elapsed, a.Err)
+	}
+}
+
+// Retry
+//
+//	@Description: 执行fn直到成功、错误不可重试、次数或时间用完，或者ctx取消
+//	@param ctx 取消时立即停止等待
+//	@param policy
+//	@param fn
+//	@return error 成功返回nil，否则返回最后一次的错误，ctx取消时同时包含ctx的错误
+func Retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	backoff := policy.Backoff
+	if backoff == nil {
+		backoff = ExponentialBackoff{}
+	}
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 3
+	}
+
+	start := time.Now()
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		a := RetryAttempt{Attempt: attempt, Err: err, Elapsed: time.Since(start)}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			// err 本身就是 Permanent 时去掉标记，被包装时原样返回，保留调用方添加的上下文
+			if permanent == err {
+				a.Err = permanent.err
+			}
+		} else if retryable(ctx, policy, err) && (maxAttempts < 0 || attempt < maxAttempts) {
+			delay = backoff.Next(attempt, delay)
+			if policy.MaxElapsed <= 0 || a.Elapsed+delay <= policy.MaxElapsed {
+				a.Delay, a.Retry = delay, true
+			}
+		}
+		if policy.OnAttempt != nil {
+			policy.OnAttempt(a)
+		}
+		if !a.Retry {
+			if ctx.Err() != nil && !errors.Is(a.Err, ctx.Err()) {
+				return errors.Join(ctx.Err(), a.Err)
+			}
+			return a.Err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+func retryable(ctx context.Context, policy RetryPolicy, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if policy.Retryable != nil {
+		return policy.Retryable(err)
+	}
+	return true
+}
+
+// RetryValue 和 Retry 相同，成功时返回fn的结果
+func RetryValue[T any](ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) (T, error)) (T, error) {
+	var result T
+	err := Retry(ctx, policy, func(ctx context.Context) error {
+		v, err := fn(ctx)
+		if err == nil {
+			result = v
+		}
+		return err
+	})
+	return result, err
+}
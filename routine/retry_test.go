@@ -0,0 +1,274 @@
+// @Author Eric
+// @Date 2026/10/31 14:00:00
+// @Desc 退避算法和失败重试的测试
+package routine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var errRetryTest = errors.New("temporary failure")
+
+// failTimes 前n次返回err，之后成功，calls记录调用次数
+func failTimes(n int, err error, calls *int) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		*calls++
+		if n < 0 || *calls <= n {
+			return err
+		}
+		return nil
+	}
+}
+
+func TestConstantBackoff(t *testing.T) {
+	b := ConstantBackoff{Delay: 50 * time.Millisecond}
+	for attempt := 1; attempt <= 5; attempt++ {
+		if d := b.Next(attempt, time.Second); d != 50*time.Millisecond {
+			t.Fatalf("attempt %d: want 50ms, got %v", attempt, d)
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff{Base: 100 * time.Millisecond, Max: time.Second, Factor: 2}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		if d := b.Next(i+1, 0); d != w*time.Millisecond {
+			t.Fatalf("attempt %d: want %v, got %v", i+1, w*time.Millisecond, d)
+		}
+	}
+	// 次数很大时不会溢出
+	if d := b.Next(10000, 0); d != time.Second {
+		t.Fatalf("want capped at 1s, got %v", d)
+	}
+	// 默认 100ms 起，每次翻倍
+	if d := (ExponentialBackoff{}).Next(3, 0); d != 400*time.Millisecond {
+		t.Fatalf("want default 400ms, got %v", d)
+	}
+
+	jittered := ExponentialBackoff{Base: 100 * time.Millisecond, Max: time.Second, Jitter: 0.2}
+	for i := 0; i < 1000; i++ {
+		if d := jittered.Next(2, 0); d < 160*time.Millisecond || d > 240*time.Millisecond {
+			t.Fatalf("want within [160ms, 240ms], got %v", d)
+		}
+		if d := jittered.Next(5, 0); d > time.Second {
+			t.Fatalf("jitter exceeded max: %v", d)
+		}
+	}
+}
+
+func TestDecorrelatedJitter(t *testing.T) {
+	b := DecorrelatedJitter{Base: 10 * time.Millisecond, Max: time.Second}
+	var prev time.Duration
+	for i := 1; i <= 1000; i++ {
+		d := b.Next(i, prev)
+		upper := 3 * prev
+		if upper < 3*b.Base {
+			upper = 3 * b.Base
+		}
+		if upper > b.Max {
+			upper = b.Max
+		}
+		if d < b.Base || d > upper {
+			t.Fatalf("attempt %d: want within [%v, %v], got %v", i, b.Base, upper, d)
+		}
+		prev = d
+	}
+	if d := (DecorrelatedJitter{}).Next(1, 0); d < 100*time.Millisecond || d > 300*time.Millisecond {
+		t.Fatalf("want default within [100ms, 300ms], got %v", d)
+	}
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		failures    int // -1表示一直失败
+		wantCalls   int
+		wantErr     bool
+	}{
+		{"default gives up after 3", 0, -1, 3, true},
+		{"succeeds before limit", 5, 2, 3, false},
+		{"limit reached", 2, 2, 2, true},
+		{"negative is unlimited", -1, 20, 21, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			policy := RetryPolicy{Backoff: ConstantBackoff{}, MaxAttempts: tt.maxAttempts}
+			err := Retry(context.Background(), policy, failTimes(tt.failures, errRetryTest, &calls))
+			if calls != tt.wantCalls {
+				t.Fatalf("want %d calls, got %d", tt.wantCalls, calls)
+			}
+			if tt.wantErr && err != errRetryTest || !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestRetryMaxElapsed(t *testing.T) {
+	// 等待会超过 MaxElapsed 时立即放弃，不会先等待
+	calls := 0
+	start := time.Now()
+	policy := RetryPolicy{Backoff: ConstantBackoff{Delay: time.Hour}, MaxAttempts: -1, MaxElapsed: time.Minute}
+	if err := Retry(context.Background(), policy, failTimes(-1, errRetryTest, &calls)); err != errRetryTest {
+		t.Fatalf("want last error, got %v", err)
+	}
+	if calls != 1 || time.Since(start) > time.Second {
+		t.Fatalf("want 1 call without waiting, got %d in %v", calls, time.Since(start))
+	}
+
+	calls = 0
+	policy = RetryPolicy{Backoff: ConstantBackoff{Delay: time.Millisecond}, MaxAttempts: -1, MaxElapsed: time.Minute}
+	if err := Retry(context.Background(), policy, failTimes(3, errRetryTest, &calls)); err != nil || calls != 4 {
+		t.Fatalf("want success after 4 calls, got %d: %v", calls, err)
+	}
+}
+
+func TestRetryRetryable(t *testing.T) {
+	errFatal := errors.New("bad request")
+	tests := []struct {
+		name      string
+		err       error
+		retryable func(err error) bool
+		wantCalls int
+	}{
+		{"default retries", errRetryTest, nil, 3},
+		{"classifier rejects", fmt.Errorf("call: %w", errFatal), func(err error) bool { return !errors.Is(err, errFatal) }, 1},
+		{"classifier accepts", errRetryTest, func(err error) bool { return !errors.Is(err, errFatal) }, 3},
+		{"ctx error not retried", fmt.Errorf("query: %w", context.DeadlineExceeded), nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			policy := RetryPolicy{Backoff: ConstantBackoff{}, Retryable: tt.retryable}
+			if err := Retry(context.Background(), policy, failTimes(-1, tt.err, &calls)); err != tt.err {
+				t.Fatalf("want %v, got %v", tt.err, err)
+			}
+			if calls != tt.wantCalls {
+				t.Fatalf("want %d calls, got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestRetryPermanent(t *testing.T) {
+	if Permanent(nil) != nil {
+		t.Fatal("Permanent(nil) should be nil")
+	}
+	base := errors.New("unauthorized")
+	tests := []struct {
+		name    string
+		err     error
+		wantMsg string
+	}{
+		{"bare", Permanent(base), "unauthorized"},
+		{"wrapped", fmt.Errorf("dial: %w", Permanent(base)), "dial: unauthorized"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			var attempts []RetryAttempt
+			policy := RetryPolicy{
+				Backoff:   ConstantBackoff{},
+				OnAttempt: func(a RetryAttempt) { attempts = append(attempts, a) },
+			}
+			err := Retry(context.Background(), policy, failTimes(-1, tt.err, &calls))
+			if calls != 1 {
+				t.Fatalf("want 1 call, got %d", calls)
+			}
+			// 保留调用方添加的上下文，去掉 Permanent 的标记
+			if err == nil || err.Error() != tt.wantMsg || !errors.Is(err, base) {
+				t.Fatalf("want %q, got %v", tt.wantMsg, err)
+			}
+			if tt.name == "bare" && err != base {
+				t.Fatalf("want original error, got %#v", err)
+			}
+			if len(attempts) != 1 || attempts[0].Err != err || attempts[0].Retry {
+				t.Fatalf("unexpected attempts %+v", attempts)
+			}
+		})
+	}
+}
+
+func TestRetryContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	policy := RetryPolicy{
+		Backoff:     ConstantBackoff{Delay: time.Hour},
+		MaxAttempts: -1,
+		// 第一次失败后，等待期间取消
+		OnAttempt: func(a RetryAttempt) { go cancel() },
+	}
+	start := time.Now()
+	err := Retry(ctx, policy, failTimes(-1, errRetryTest, &calls))
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, errRetryTest) {
+		t.Fatalf("want both ctx and last error, got %v", err)
+	}
+	if calls != 1 || time.Since(start) > time.Second {
+		t.Fatalf("want 1 call stopped while waiting, got %d in %v", calls, time.Since(start))
+	}
+
+	// 已经取消的ctx在第一次失败后就不再重试
+	calls = 0
+	err = Retry(ctx, RetryPolicy{Backoff: ConstantBackoff{}}, failTimes(-1, errRetryTest, &calls))
+	if calls != 1 || !errors.Is(err, context.Canceled) || !errors.Is(err, errRetryTest) {
+		t.Fatalf("want 1 call with ctx error, got %d: %v", calls, err)
+	}
+}
+
+func TestRetryOnAttempt(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		want     int
+	}{
+		{"success first", 0, 0},
+		{"success third", 2, 2},
+		{"gives up", -1, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts []RetryAttempt
+			calls := 0
+			policy := RetryPolicy{
+				Backoff:     ConstantBackoff{Delay: time.Millisecond},
+				MaxAttempts: 4,
+				OnAttempt:   func(a RetryAttempt) { attempts = append(attempts, a) },
+			}
+			Retry(context.Background(), policy, failTimes(tt.failures, errRetryTest, &calls))
+			if len(attempts) != tt.want {
+				t.Fatalf("want %d OnAttempt calls, got %d", tt.want, len(attempts))
+			}
+			for i, a := range attempts {
+				last := tt.failures < 0 && i == len(attempts)-1
+				if a.Attempt != i+1 || a.Err != errRetryTest || a.Retry == last {
+					t.Fatalf("unexpected attempt %+v", a)
+				}
+				if last && a.Delay != 0 || !last && a.Delay != time.Millisecond {
+					t.Fatalf("unexpected delay %+v", a)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryValue(t *testing.T) {
+	calls := 0
+	v, err := RetryValue(context.Background(), RetryPolicy{Backoff: ConstantBackoff{}}, func(ctx context.Context) (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, errRetryTest
+		}
+		return 42, nil
+	})
+	if err != nil || v != 42 {
+		t.Fatalf("want 42, got %d: %v", v, err)
+	}
+}
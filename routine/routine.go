@@ -1,70 +1,97 @@
 package routine
 
 import (
-	"fmt"
-	"github.com/Kyle91/haven/log"
+	"context"
 	"sync"
+	"time"
 )
 
-// Routine 管理goroutine的执行
-type Routine struct {
-	taskQueue chan func()
-	wg        sync.WaitGroup
-	maxTasks  int
-}
+// Routine 兼容旧代码
+//
+// Deprecated: 使用 Pool
+type Routine = Pool
 
-var instance *Routine
-var once sync.Once
+var (
+	defaultMu   sync.Mutex
+	defaultPool *Pool
+	defaultOpts = PoolOptions{Name: "default", Workers: 3000}
+)
 
-// NewRoutine 创建一个新的 Routine 实例
+// NewRoutine 设置默认协程池的大小，只在默认池创建前调用有效
+//
+// Deprecated: 使用 NewPool 创建独立的协程池
 func NewRoutine(maxTasks int) *Routine {
-	once.Do(func() {
-		instance = &Routine{
-			taskQueue: make(chan func(), maxTasks),
-			maxTasks:  maxTasks,
-		}
-		go instance.run()
-	})
-	return instance
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultPool == nil {
+		opts := defaultOpts
+		opts.Workers = maxTasks
+		defaultPool = NewPool(opts)
+	}
+	return defaultPool
 }
 
-// run 处理任务队列中的任务
-func (r *Routine) run() {
-	for task := range r.taskQueue {
-		r.wg.Add(1)
-		go func(task func()) {
-			defer r.wg.Done()
-			defer catchPanic()
-			task()
-		}(task)
+// Default 默认协程池，最多3000个并发任务
+func Default() *Pool {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultPool == nil {
+		defaultPool = NewPool(defaultOpts)
 	}
+	return defaultPool
 }
 
-// Go 启动一个新的goroutine
+// SetDefault 替换默认协程池，返回原来的协程池，原来的协程池需要调用方关闭
+func SetDefault(p *Pool) *Pool {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	old := defaultPool
+	defaultPool = p
+	return old
+}
+
+// ResetDefault 用默认配置重新创建默认协程池，一般用于测试中 Wait 或 Shutdown 之后
+func ResetDefault() *Pool {
+	return SetDefault(NewPool(defaultOpts))
+}
+
+// Go 在默认协程池中执行任务
 func Go(logic func()) {
-	r := getInstance()
-	r.taskQueue <- logic
+	Default().Go(logic)
 }
 
-// Wait 等待所有goroutine完成
-// 调用该方法后，将不再接受新的任务
-func Wait() {
-	gm := getInstance()
-	close(gm.taskQueue)
-	gm.wg.Wait()
+// GoNamed 在默认协程池中执行有名称的任务，见 Pool.GoNamed
+func GoNamed(name string, logic func()) {
+	Default().GoNamed(name, logic)
 }
 
-// getInstance 获取GoManager的单例实例
-func getInstance() *Routine {
-	if instance == nil {
-		NewRoutine(3000) // 默认任务数量
-	}
-	return instance
+// Protect 在当前协程中执行fn，panic按默认协程池的规则处理，见 Pool.Protect
+func Protect(name string, fn func()) {
+	Default().Protect(name, fn)
 }
 
-// catchPanic 捕获并处理goroutine中的panic
-func catchPanic() {
-	if err := recover(); err != nil {
-		log.Info(fmt.Sprintf("panic recovered: %v", err))
-	}
+// GoCtx 在默认协程池中执行可以取消的任务，见 Pool.GoCtx
+func GoCtx(ctx context.Context, task func(ctx context.Context) error) {
+	Default().GoCtx(ctx, task)
+}
+
+// GoTimeout 在默认协程池中执行有超时时间的任务，见 Pool.GoTimeout
+func GoTimeout(ctx context.Context, timeout time.Duration, task func(ctx context.Context) error) {
+	Default().GoTimeout(ctx, timeout, task)
+}
+
+// Shutdown 关闭默认协程池，见 Pool.Shutdown
+func Shutdown(ctx context.Context) error {
+	return Default().Shutdown(ctx)
+}
+
+// TryGo 在默认协程池中执行任务，见 Pool.TryGo
+func TryGo(logic func()) error {
+	return Default().TryGo(logic)
+}
+
+// Wait 等待默认协程池中的所有任务完成
+// 调用该方法后，将不再接受新的任务
+func Wait() {
+	Default().Wait()
 }
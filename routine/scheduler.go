@@ -0,0 +1,432 @@
+// @Author Eric
+// @Date 2026/10/26 11:00:00
+// @Desc 定时任务，延迟执行、固定间隔执行和cron表达式，任务在协程池中执行
+package routine
+
+import (
+	"github.com/Kyle91/haven/clock"
+	"github.com/Kyle91/haven/log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// OverlapPolicy 上一次执行还没结束时又到了执行时间的处理策略
+type OverlapPolicy int
+
+const (
+	OverlapSkip  OverlapPolicy = iota // 跳过这一次，记录日志
+	OverlapAllow                      // 同时执行
+	OverlapQueue                      // 等上一次结束后立即执行，最多排队一次
+)
+
+// Schedule 计算下一次执行时间，返回零值表示不再执行
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// JobOption 定时任务的可选配置
+type JobOption func(*Job)
+
+// WithJobName 任务名称，用于日志
+func WithJobName(name string) JobOption {
+	return func(j *Job) {
+		j.name = name
+	}
+}
+
+// WithJitter 每次执行时间随机推迟 [0, jitter)，避免多个节点同时执行
+func WithJitter(jitter time.Duration) JobOption {
+	return func(j *Job) {
+		j.jitter = jitter
+	}
+}
+
+// WithOverlap 设置上一次还没结束时的处理策略，默认 OverlapSkip
+func WithOverlap(policy OverlapPolicy) JobOption {
+	return func(j *Job) {
+		j.overlap = policy
+	}
+}
+
+// WithLocation cron表达式使用的时区，默认使用 Scheduler 的时区
+func WithLocation(loc *time.Location) JobOption {
+	return func(j *Job) {
+		j.location = loc
+	}
+}
+
+// SchedulerOptions 调度器配置
+type SchedulerOptions struct {
+	Pool     *Pool          // 执行任务的协程池，默认使用默认协程池
+	Location *time.Location // cron表达式默认的时区，默认 time.Local
+	// MissTolerance 实际触发时间比计划晚多少算错过，默认1秒，进程卡顿或者系统休眠时会发生
+	MissTolerance time.Duration
+	Clock         clock.Clock // 时钟，默认系统时钟
+}
+
+var (
+	defaultSchedulerOnce sync.Once
+	defaultScheduler     *Scheduler
+)
+
+// DefaultScheduler 使用默认协程池的调度器
+func DefaultScheduler() *Scheduler {
+	defaultSchedulerOnce.Do(func() {
+		defaultScheduler = NewScheduler(SchedulerOptions{})
+	})
+	return defaultScheduler
+}
+
+// After 使用默认调度器延迟执行，见 Scheduler.After
+func After(d time.Duration, fn func(), opts ...JobOption) *Job {
+	return DefaultScheduler().After(d, fn, opts...)
+}
+
+// Every 使用默认调度器定期执行，见 Scheduler.Every
+func Every(d time.Duration, fn func(), opts ...JobOption) *Job {
+	return DefaultScheduler().Every(d, fn, opts...)
+}
+
+// Cron 使用默认调度器按cron表达式执行，见 Scheduler.Cron
+func Cron(expr string, fn func(), opts ...JobOption) (*Job, error) {
+	return DefaultScheduler().Cron(expr, fn, opts...)
+}
+
+// Scheduler 定时任务调度器
+type Scheduler struct {
+	opts SchedulerOptions
+
+	mu     sync.Mutex
+	jobs   map[*Job]struct{}
+	closed bool
+}
+
+// NewScheduler 创建调度器
+func NewScheduler(opts SchedulerOptions) *Scheduler {
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if opts.MissTolerance <= 0 {
+		opts.MissTolerance = time.Second
+	}
+	opts.Clock = clock.OrDefault(opts.Clock)
+	return &Scheduler{opts: opts, jobs: make(map[*Job]struct{})}
+}
+
+// Job 定时任务的句柄
+type Job struct {
+	s        *Scheduler
+	name     string
+	fn       func()
+	schedule Schedule
+	jitter   time.Duration
+	overlap  OverlapPolicy
+	location *time.Location
+
+	mu        sync.Mutex
+	timer     clock.Timer
+	next      time.Time // 计划的下一次执行时间，不含jitter
+	cancelled bool
+	running   int  // 正在执行的次数
+	queued    bool // OverlapQueue 时是否有排队的执行
+}
+
+// After
+//
+//	@Description: 延迟d后执行一次
+//	@receiver s
+//	@param d
+//	@param fn
+//	@param opts
+//	@return *Job
+func (s *Scheduler) After(d time.Duration, fn func(), opts ...JobOption) *Job {
+	return s.add(&onceSchedule{at: s.opts.Clock.Now().Add(d)}, fn, opts)
+}
+
+// At 在指定时间执行一次
+func (s *Scheduler) At(t time.Time, fn func(), opts ...JobOption) *Job {
+	return s.add(&onceSchedule{at: t}, fn, opts)
+}
+
+// Every
+//
+//	@Description: 每隔d执行一次，第一次在d之后
+//	@receiver s
+//	@param d 间隔，必须大于0
+//	@param fn
+//	@param opts 可以设置 WithJitter 和 WithOverlap
+//	@return *Job
+func (s *Scheduler) Every(d time.Duration, fn func(), opts ...JobOption) *Job {
+	if d <= 0 {
+		panic("routine: non-positive interval for Every")
+	}
+	return s.add(&everySchedule{interval: d}, fn, opts)
+}
+
+// Cron
+//
+//	@Description: 按cron表达式执行，见 ParseCron
+//	@receiver s
+//	@param expr 例如 "0 5 * * *" 每天05:00
+//	@param fn
+//	@param opts 可以用 WithLocation 指定时区
+//	@return *Job
+//	@return error 表达式无效
+func (s *Scheduler) Cron(expr string, fn func(), opts ...JobOption) (*Job, error) {
+	j := &Job{}
+	for _, opt := range opts {
+		opt(j)
+	}
+	loc := j.location
+	if loc == nil {
+		loc = s.opts.Location
+	}
+	schedule, err := ParseCron(expr, loc)
+	if err != nil {
+		return nil, err
+	}
+	if j.name == "" {
+		opts = append(opts, WithJobName(expr))
+	}
+	return s.add(schedule, fn, opts), nil
+}
+
+// Schedule 按自定义的 Schedule 执行
+func (s *Scheduler) Schedule(schedule Schedule, fn func(), opts ...JobOption) *Job {
+	return s.add(schedule, fn, opts)
+}
+
+// Stop 取消所有任务，正在执行的任务不受影响
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	s.closed = true
+	jobs := s.jobs
+	s.jobs = make(map[*Job]struct{})
+	s.mu.Unlock()
+
+	for j := range jobs {
+		j.Cancel()
+	}
+}
+
+// Len 未取消的任务数
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.jobs)
+}
+
+func (s *Scheduler) add(schedule Schedule, fn func(), opts []JobOption) *Job {
+	j := &Job{s: s, fn: fn, schedule: schedule}
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		j.cancelled = true
+		return j
+	}
+	s.jobs[j] = struct{}{}
+	s.mu.Unlock()
+
+	j.mu.Lock()
+	j.scheduleLocked(s.opts.Clock.Now())
+	j.mu.Unlock()
+	return j
+}
+
+func (s *Scheduler) pool() *Pool {
+	if s.opts.Pool != nil {
+		return s.opts.Pool
+	}
+	return Default()
+}
+
+func (s *Scheduler) remove(j *Job) {
+	s.mu.Lock()
+	delete(s.jobs, j)
+	s.mu.Unlock()
+}
+
+// Cancel 取消任务，正在执行的不受影响
+func (j *Job) Cancel() {
+	j.mu.Lock()
+	j.cancelled = true
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	j.mu.Unlock()
+
+	if j.s != nil {
+		j.s.remove(j)
+	}
+}
+
+// Next 下一次计划执行的时间，已经取消或者不再执行时返回零值
+func (j *Job) Next() time.Time {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cancelled {
+		return time.Time{}
+	}
+	return j.next
+}
+
+// Name 任务名称
+func (j *Job) Name() string {
+	return j.name
+}
+
+// scheduleLocked 计算下一次执行时间并设置定时器，调用方需要持有 j.mu
+func (j *Job) scheduleLocked(from time.Time) {
+	if j.cancelled {
+		return
+	}
+	next := j.schedule.Next(from)
+	if next.IsZero() {
+		j.next = time.Time{}
+		j.cancelled = true
+		j.s.remove(j)
+		return
+	}
+	j.next = next
+
+	delay := next.Sub(j.s.opts.Clock.Now())
+	if j.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(j.jitter)))
+	}
+	j.timer = j.s.opts.Clock.AfterFunc(delay, j.fire)
+}
+
+// fire 定时器触发，先安排下一次再执行，执行时间不影响下一次的计划
+func (j *Job) fire() {
+	now := j.s.opts.Clock.Now()
+
+	j.mu.Lock()
+	if j.cancelled {
+		j.mu.Unlock()
+		return
+	}
+	planned := j.next
+	// 从计划时间开始计算，jitter不会累积
+	from := planned
+	if missed := j.countMissed(planned, now); missed > 0 {
+		log.Warnf("routine scheduler job %s missed %d runs, planned at %s, fired at %s",
+			j.name, missed, planned.Format(time.RFC3339), now.Format(time.RFC3339))
+		from = now
+	}
+	j.scheduleLocked(from)
+	j.mu.Unlock()
+
+	j.run()
+}
+
+// countMissed 触发时间比计划晚太多时，计算中间错过了几次
+func (j *Job) countMissed(planned, now time.Time) int {
+	tolerance := j.s.opts.MissTolerance + j.jitter
+	if now.Sub(planned) <= tolerance {
+		return 0
+	}
+	missed := 0
+	for t := j.schedule.Next(planned); !t.IsZero() && t.Add(tolerance).Before(now); t = j.schedule.Next(t) {
+		missed++
+		if missed >= 1000 {
+			break
+		}
+	}
+	return missed
+}
+
+// run 按重叠策略在协程池中执行，running和queued的判断和修改都在 j.mu 内，
+// 避免上一次执行刚结束时排队的执行被丢掉，或者 OverlapSkip 时同时执行两次
+func (j *Job) run() {
+	j.mu.Lock()
+	if j.running > 0 {
+		switch j.overlap {
+		case OverlapSkip:
+			j.mu.Unlock()
+			log.Warnf("routine scheduler job %s skipped: previous run still in progress", j.name)
+			return
+		case OverlapQueue:
+			queued := j.queued
+			j.queued = true
+			j.mu.Unlock()
+			if queued {
+				log.Warnf("routine scheduler job %s skipped: a run is already queued", j.name)
+			}
+			return
+		}
+	}
+	j.running++
+	j.mu.Unlock()
+
+	pool := j.s.pool()
+	err := pool.TryGoNamed(j.name, func() {
+		finished := false
+		defer func() {
+			// 开发环境下panic会重新抛出，这里结束这次执行
+			if !finished {
+				j.endRun()
+			}
+		}()
+		for {
+			pool.Protect(j.name, j.fn)
+			if !j.continueQueued() {
+				finished = true
+				return
+			}
+		}
+	})
+	if err != nil {
+		j.endRun()
+		log.Warnf("routine scheduler job %s not run: %v", j.name, err)
+	}
+}
+
+// continueQueued 执行期间有排队的就取走并返回true，否则结束这次执行
+func (j *Job) continueQueued() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.queued {
+		j.queued = false
+		return true
+	}
+	j.running--
+	return false
+}
+
+// endRun 结束一次执行，没有正在执行的时候排队的也不再执行
+func (j *Job) endRun() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.running--
+	if j.running == 0 {
+		j.queued = false
+	}
+}
+
+// onceSchedule 只执行一次
+type onceSchedule struct {
+	at   time.Time
+	done bool
+}
+
+func (s *onceSchedule) Next(t time.Time) time.Time {
+	if s.done {
+		return time.Time{}
+	}
+	s.done = true
+	return s.at
+}
+
+// everySchedule 固定间隔
+type everySchedule struct {
+	interval time.Duration
+}
+
+func (s *everySchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval)
+}
@@ -0,0 +1,298 @@
+// @Author Eric
+// @Date 2026/10/29 19:00:00
+// @Desc cron表达式和定时任务的测试
+package routine
+
+import (
+	"context"
+	"github.com/Kyle91/haven/clock"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// 2024-01-31 是周三
+	from := time.Date(2024, 1, 31, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 5 * * *", time.Date(2024, 2, 1, 5, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC)},
+		{"*/30 * * * * *", time.Date(2024, 1, 31, 10, 18, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, 2, 4, 9, 0, 0, 0, time.UTC)},
+		// 日和周都有限制时满足任意一个
+		{"0 0 13 * 5", time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=Asia/Shanghai 0 9 * * *", time.Date(2024, 2, 1, 1, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := ParseCron(tt.expr, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(from); !got.Equal(tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"CRON_TZ=Nowhere/City * * * * *",
+	} {
+		if _, err := ParseCron(expr, time.UTC); err == nil {
+			t.Fatalf("%q: expected error", expr)
+		}
+	}
+}
+
+func TestJobOverlap(t *testing.T) {
+	tests := []struct {
+		policy OverlapPolicy
+		want   int32
+	}{
+		{OverlapSkip, 1},
+		{OverlapQueue, 2},
+		{OverlapAllow, 4},
+	}
+	for _, tt := range tests {
+		p := NewPool(PoolOptions{Name: t.Name(), Workers: 8})
+		release := make(chan struct{})
+		started := make(chan struct{}, 8)
+		var runs, active, maxActive int32
+		j := &Job{
+			s:       NewScheduler(SchedulerOptions{Pool: p}),
+			name:    "overlap",
+			overlap: tt.policy,
+			fn: func() {
+				atomic.AddInt32(&runs, 1)
+				n := atomic.AddInt32(&active, 1)
+				for {
+					m := atomic.LoadInt32(&maxActive)
+					if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+						break
+					}
+				}
+				started <- struct{}{}
+				<-release
+				atomic.AddInt32(&active, -1)
+			},
+		}
+
+		// 第一次执行还没结束时又触发了3次
+		j.run()
+		<-started
+		for i := 0; i < 3; i++ {
+			j.run()
+		}
+		close(release)
+		if err := p.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := atomic.LoadInt32(&runs); got != tt.want {
+			t.Fatalf("policy %d: want %d runs, got %d", tt.policy, tt.want, got)
+		}
+		if tt.policy != OverlapAllow && maxActive != 1 {
+			t.Fatalf("policy %d: runs overlapped", tt.policy)
+		}
+		if j.running != 0 || j.queued {
+			t.Fatalf("policy %d: state not reset, running %d queued %v", tt.policy, j.running, j.queued)
+		}
+	}
+}
+
+func TestJobQueuedAfterFinish(t *testing.T) {
+	// 反复在执行结束的同时触发，排队的执行不会丢失，也不会同时执行
+	p := NewPool(PoolOptions{Name: t.Name(), Workers: 8})
+	var active, overlapped int32
+	var wg sync.WaitGroup
+	j := &Job{
+		s:       NewScheduler(SchedulerOptions{Pool: p}),
+		name:    "queued",
+		overlap: OverlapQueue,
+		fn: func() {
+			if atomic.AddInt32(&active, 1) > 1 {
+				atomic.StoreInt32(&overlapped, 1)
+			}
+			atomic.AddInt32(&active, -1)
+		},
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 500; k++ {
+				j.run()
+			}
+		}()
+	}
+	wg.Wait()
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if overlapped != 0 {
+		t.Fatal("runs overlapped")
+	}
+	if j.running != 0 || j.queued {
+		t.Fatalf("state not reset, running %d queued %v", j.running, j.queued)
+	}
+}
+
+func TestSchedulerAfterAndCancel(t *testing.T) {
+	p := NewPool(PoolOptions{Name: t.Name(), Workers: 4})
+	defer p.Shutdown(context.Background())
+	s := NewScheduler(SchedulerOptions{Pool: p})
+
+	fired := make(chan string, 16)
+	send := func(name string) func() {
+		return func() {
+			select {
+			case fired <- name:
+			default:
+			}
+		}
+	}
+	s.After(10*time.Millisecond, send("after"))
+	cancelled := s.After(30*time.Millisecond, send("cancelled"))
+	every := s.Every(10*time.Millisecond, send("every"), WithOverlap(OverlapSkip))
+	cancelled.Cancel()
+
+	seen := map[string]int{}
+	timeout := time.After(time.Second)
+	for seen["after"] == 0 || seen["every"] < 2 {
+		select {
+		case name := <-fired:
+			seen[name]++
+		case <-timeout:
+			t.Fatalf("jobs did not fire: %v", seen)
+		}
+	}
+	if !cancelled.Next().IsZero() {
+		t.Fatal("cancelled job still scheduled")
+	}
+	if every.Next().IsZero() {
+		t.Fatal("every job not scheduled")
+	}
+
+	s.Stop()
+	if s.Len() != 0 || !every.Next().IsZero() {
+		t.Fatal("jobs not stopped")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if seen["cancelled"] != 0 {
+		t.Fatal("cancelled job fired")
+	}
+	for len(fired) > 0 {
+		if name := <-fired; name == "cancelled" {
+			t.Fatal("cancelled job fired")
+		}
+	}
+}
+
+func TestJobRejectPolicies(t *testing.T) {
+	for _, tt := range rejectCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var j *Job
+			submitToFullPool(t, tt.policy, tt.runs, func(p *Pool, task func()) error {
+				j = &Job{s: NewScheduler(SchedulerOptions{Pool: p}), name: "reject", overlap: OverlapSkip, fn: task}
+				j.run()
+				return nil
+			})
+			// 没能提交的执行要结束，不能让之后的执行都被当成重叠跳过
+			j.mu.Lock()
+			running := j.running
+			j.mu.Unlock()
+			if running != 0 {
+				t.Fatalf("want no running, got %d", running)
+			}
+			done := make(chan struct{})
+			j.fn = func() { close(done) }
+			j.run()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("job skipped after rejection")
+			}
+		})
+	}
+}
+
+func TestSchedulerMissedRuns(t *testing.T) {
+	p := NewPool(PoolOptions{Name: t.Name(), Workers: 4})
+	defer p.Shutdown(context.Background())
+	start := time.Date(2024, 1, 31, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewMockClock(start)
+	s := NewScheduler(SchedulerOptions{Pool: p, Clock: clk})
+	defer s.Stop()
+
+	fired := make(chan string, 16)
+	wait := func(name string, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			select {
+			case got := <-fired:
+				if got != name {
+					t.Fatalf("want %s fired, got %s", name, got)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%s fired %d times, want %d", name, i, n)
+			}
+		}
+	}
+	every := s.Every(time.Minute, func() { fired <- "every" }, WithOverlap(OverlapAllow))
+	s.After(90*time.Second, func() { fired <- "after" })
+	if next := every.Next(); !next.Equal(start.Add(time.Minute)) {
+		t.Fatalf("want next at %v, got %v", start.Add(time.Minute), next)
+	}
+
+	// 按时触发时沿着计划时间安排下一次
+	clk.Add(time.Minute)
+	wait("every", 1)
+	clk.Add(30 * time.Second)
+	wait("after", 1)
+	clk.Add(90 * time.Second)
+	wait("every", 2)
+	if next := every.Next(); !next.Equal(start.Add(4 * time.Minute)) {
+		t.Fatalf("want next at %v, got %v", start.Add(4*time.Minute), next)
+	}
+
+	// 模拟进程卡住，定时器晚了5分钟才触发
+	every.mu.Lock()
+	every.timer.Stop()
+	planned := every.next
+	every.mu.Unlock()
+	clk.Add(5 * time.Minute)
+	if n := every.countMissed(planned, clk.Now()); n != 3 {
+		t.Fatalf("want 3 missed runs, got %d", n)
+	}
+	every.fire()
+	wait("every", 1)
+	// 错过的不补执行，从触发时间重新计算
+	if next := every.Next(); !next.Equal(clk.Now().Add(time.Minute)) {
+		t.Fatalf("want next at %v, got %v", clk.Now().Add(time.Minute), next)
+	}
+	select {
+	case got := <-fired:
+		t.Fatalf("missed run executed: %s", got)
+	default:
+	}
+}
@@ -0,0 +1,151 @@
+// @Author Eric
+// @Date 2026/10/28 11:00:00
+// @Desc 协程池的统计，任务计数、排队和执行耗时分布，以及正在执行的任务列表
+package routine
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// durationBuckets 耗时分布的区间上限
+var durationBuckets = []time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	time.Minute,
+}
+
+// Histogram 耗时分布
+type Histogram struct {
+	Bounds []time.Duration // 区间上限
+	Counts []uint64        // 每个区间的次数，比 Bounds 多一个，最后一个是超过最大上限的
+	Count  uint64
+	Sum    time.Duration
+}
+
+// histogram 无锁的耗时分布统计
+type histogram struct {
+	counts []uint64
+	sum    int64 // 纳秒
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(durationBuckets)+1)}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := sort.Search(len(durationBuckets), func(i int) bool {
+		return d <= durationBuckets[i]
+	})
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	s := Histogram{Bounds: durationBuckets, Counts: make([]uint64, len(h.counts))}
+	for i := range h.counts {
+		s.Counts[i] = atomic.LoadUint64(&h.counts[i])
+		s.Count += s.Counts[i]
+	}
+	s.Sum = time.Duration(atomic.LoadInt64(&h.sum))
+	return s
+}
+
+// PoolStats 协程池的统计
+type PoolStats struct {
+	Name      string
+	Workers   int    // 已创建的worker数
+	Running   int    // 正在执行的任务数
+	Queued    int    // 排队中的任务数
+	Completed uint64 // 累计执行完的任务数，包括panic的
+	Rejected  uint64 // 累计被拒绝的任务数，包括关闭后提交的和队列满时丢弃的
+	Panicked  uint64 // 累计panic次数
+	QueueWait Histogram
+	Execution Histogram
+}
+
+// RunningTask 正在执行的任务
+type RunningTask struct {
+	Name  string
+	Start time.Time
+}
+
+// runningTask 正在执行的任务的登记，执行结束时删除
+type runningTask struct {
+	name  string
+	start time.Time
+}
+
+// Stats 当前的统计
+func (p *Pool) Stats() PoolStats {
+	return PoolStats{
+		Name:      p.opts.Name,
+		Workers:   p.Workers(),
+		Running:   p.Running(),
+		Queued:    p.Waiting(),
+		Completed: atomic.LoadUint64(&p.completed),
+		Rejected:  atomic.LoadUint64(&p.rejected),
+		Panicked:  p.Panics(),
+		QueueWait: p.waitHist.snapshot(),
+		Execution: p.execHist.snapshot(),
+	}
+}
+
+// RunningTasks 正在执行的任务，按开始时间排序，最早的在前面
+func (p *Pool) RunningTasks() []RunningTask {
+	var tasks []RunningTask
+	p.active.Range(func(key, _ interface{}) bool {
+		rt := key.(*runningTask)
+		tasks = append(tasks, RunningTask{Name: rt.name, Start: rt.start})
+		return true
+	})
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Start.Before(tasks[j].Start)
+	})
+	return tasks
+}
+
+// Dump
+//
+//	@Description: 输出协程池的状态和执行时间超过 longerThan 的任务，用于排查卡住的任务
+//	@receiver p
+//	@param w
+//	@param longerThan 0表示输出所有正在执行的任务
+//	@return error
+func (p *Pool) Dump(w io.Writer, longerThan time.Duration) error {
+	s := p.Stats()
+	_, err := fmt.Fprintf(w, "pool %s: workers=%d running=%d queued=%d completed=%d rejected=%d panicked=%d\n",
+		s.Name, s.Workers, s.Running, s.Queued, s.Completed, s.Rejected, s.Panicked)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, t := range p.RunningTasks() {
+		age := now.Sub(t.Start)
+		if age < longerThan {
+			// 按开始时间排序，后面的更短
+			break
+		}
+		name := t.Name
+		if name == "" {
+			name = "(unnamed)"
+		}
+		if _, err = fmt.Fprintf(w, "  %s started at %s, running for %s\n",
+			name, t.Start.Format(time.RFC3339), age.Truncate(time.Millisecond)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+// @Author Eric
+// @Date 2026/10/27 10:00:00
+// @Desc 分层时间轮，适合大量的超时定时器，例如每个连接的心跳超时，添加、取消和重置都是O(1)
+package routine
+
+import (
+	"github.com/Kyle91/haven/clock"
+	"sync"
+	"time"
+)
+
+// TimingWheelOptions 时间轮配置
+type TimingWheelOptions struct {
+	Name   string        // 名称，用于日志
+	Tick   time.Duration // 精度，定时器最多推迟一个Tick触发，默认10ms
+	Slots  int           // 每层的槽数，必须是2的幂，默认256
+	Levels int           // 层数，可以表示的最大时长为 Tick*Slots^Levels，超过的会分多次等待，默认4
+	Pool   *Pool         // 执行回调的协程池，默认使用默认协程池
+	Clock  clock.Clock   // 时钟，默认系统时钟
+}
+
+// TimingWheel 分层时间轮，类似Linux内核的实现
+// 第0层每个槽是一个Tick，第n层每个槽是第n-1层转一圈，高层的定时器在时间临近时逐层下放
+type TimingWheel struct {
+	opts  TimingWheelOptions
+	bits  uint
+	mask  uint64
+	start time.Time
+
+	mu      sync.Mutex
+	current uint64          // 下一个要处理的tick
+	buckets [][]*WheelTimer // 每个槽是一个带哨兵的双向循环链表
+	count   int             // 等待中的定时器数量
+	stop    chan struct{}
+	stopped bool
+}
+
+// WheelTimer 时间轮中的定时器
+type WheelTimer struct {
+	w      *TimingWheel
+	fn     func()
+	expire uint64 // 到期的tick
+
+	prev, next *WheelTimer
+	scheduled  bool
+}
+
+// NewTimingWheel
+//
+//	@Description: 创建时间轮并开始转动
+//	@param opts
+//	@return *TimingWheel
+func NewTimingWheel(opts TimingWheelOptions) *TimingWheel {
+	w := newTimingWheel(opts)
+	// 转动的协程一直运行，不占用协程池的worker
+	go w.run(w.opts.Clock.NewTicker(w.opts.Tick))
+	return w
+}
+
+// newTimingWheel 创建时间轮，不开始转动
+func newTimingWheel(opts TimingWheelOptions) *TimingWheel {
+	if opts.Tick <= 0 {
+		opts.Tick = 10 * time.Millisecond
+	}
+	if opts.Slots <= 0 || opts.Slots&(opts.Slots-1) != 0 {
+		opts.Slots = 256
+	}
+	if opts.Levels <= 0 {
+		opts.Levels = 4
+	}
+	opts.Clock = clock.OrDefault(opts.Clock)
+
+	bits := uint(0)
+	for 1<<bits < opts.Slots {
+		bits++
+	}
+	// 所有层加起来不能超过uint64
+	for bits*uint(opts.Levels) > 62 {
+		opts.Levels--
+	}
+
+	w := &TimingWheel{
+		opts:    opts,
+		bits:    bits,
+		mask:    uint64(opts.Slots - 1),
+		start:   opts.Clock.Now(),
+		buckets: make([][]*WheelTimer, opts.Levels),
+		stop:    make(chan struct{}),
+	}
+	for level := range w.buckets {
+		w.buckets[level] = make([]*WheelTimer, opts.Slots)
+		for i := range w.buckets[level] {
+			head := &WheelTimer{}
+			head.prev, head.next = head, head
+			w.buckets[level][i] = head
+		}
+	}
+	return w
+}
+
+// AfterFunc
+//
+//	@Description: d之后在协程池中执行fn
+//	@receiver w
+//	@param d
+//	@param fn
+//	@return *WheelTimer 可以用于取消或重置，时间轮已经停止时返回的定时器不会触发
+func (w *TimingWheel) AfterFunc(d time.Duration, fn func()) *WheelTimer {
+	t := &WheelTimer{w: w, fn: fn}
+	w.mu.Lock()
+	if !w.stopped {
+		w.addLocked(t, d)
+	}
+	w.mu.Unlock()
+	return t
+}
+
+// Len 等待中的定时器数量
+func (w *TimingWheel) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.count
+}
+
+// Stop 停止转动，等待中的定时器不会再触发，之后添加和重置的定时器也不会触发
+func (w *TimingWheel) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.stopped {
+		w.stopped = true
+		close(w.stop)
+	}
+}
+
+// Stop 取消定时器，返回定时器是否还在等待
+func (t *WheelTimer) Stop() bool {
+	t.w.mu.Lock()
+	defer t.w.mu.Unlock()
+	if !t.scheduled {
+		return false
+	}
+	t.w.removeLocked(t)
+	return true
+}
+
+// Reset 重新设置为d之后触发，已经触发或取消的定时器也可以重置，返回重置前是否还在等待
+// 时间轮已经停止时不做任何处理，返回false
+func (t *WheelTimer) Reset(d time.Duration) bool {
+	t.w.mu.Lock()
+	defer t.w.mu.Unlock()
+	if t.w.stopped {
+		return false
+	}
+	active := t.scheduled
+	if active {
+		t.w.removeLocked(t)
+	}
+	t.w.addLocked(t, d)
+	return active
+}
+
+// addLocked 按实际经过的时间计算到期的tick，向上取整，保证不会提前触发
+// 转动的协程被延迟调度时 w.current 落后于实际时间，不能从 w.current 开始计算
+func (w *TimingWheel) addLocked(t *WheelTimer, d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	elapsed := w.opts.Clock.Now().Sub(w.start) + d
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	// 第n个tick在经过 n*Tick 之后处理，最早也要等到下一个tick
+	t.expire = uint64((elapsed + w.opts.Tick - 1) / w.opts.Tick)
+	if t.expire <= w.current {
+		t.expire = w.current + 1
+	}
+	w.placeLocked(t)
+	w.count++
+}
+
+// placeLocked 根据剩余的tick数放到对应层的槽中
+func (w *TimingWheel) placeLocked(t *WheelTimer) {
+	expire := t.expire
+	if expire < w.current {
+		expire = w.current
+	}
+	delta := expire - w.current
+
+	level := 0
+	for ; level < len(w.buckets)-1; level++ {
+		if delta < 1<<(w.bits*uint(level+1)) {
+			break
+		}
+	}
+	// 超过最大范围的先放在最高层最远的槽，下放时会重新计算
+	if max := uint64(1)<<(w.bits*uint(len(w.buckets))) - 1; delta > max {
+		expire = w.current + max
+	}
+
+	head := w.buckets[level][(expire>>(w.bits*uint(level)))&w.mask]
+	t.prev, t.next = head.prev, head
+	head.prev.next = t
+	head.prev = t
+	t.scheduled = true
+}
+
+func (w *TimingWheel) removeLocked(t *WheelTimer) {
+	t.prev.next = t.next
+	t.next.prev = t.prev
+	t.prev, t.next = nil, nil
+	t.scheduled = false
+	w.count--
+}
+
+// takeLocked 取出槽中所有定时器
+func (w *TimingWheel) takeLocked(level int, index uint64) *WheelTimer {
+	head := w.buckets[level][index]
+	if head.next == head {
+		return nil
+	}
+	first := head.next
+	head.prev.next = nil
+	head.prev, head.next = head, head
+	return first
+}
+
+// tickLocked 处理一个tick，返回到期的定时器
+func (w *TimingWheel) tickLocked(expired []*WheelTimer) []*WheelTimer {
+	// 低层转完一圈时，把高层对应槽的定时器下放
+	for level := 1; level < len(w.buckets); level++ {
+		if w.current&(1<<(w.bits*uint(level))-1) != 0 {
+			break
+		}
+		index := (w.current >> (w.bits * uint(level))) & w.mask
+		for t := w.takeLocked(level, index); t != nil; {
+			next := t.next
+			w.placeLocked(t)
+			t = next
+		}
+	}
+
+	for t := w.takeLocked(0, w.current&w.mask); t != nil; {
+		next := t.next
+		t.prev, t.next = nil, nil
+		if t.expire <= w.current {
+			t.scheduled = false
+			w.count--
+			expired = append(expired, t)
+		} else {
+			// 超过最大范围的定时器还没到期
+			w.placeLocked(t)
+		}
+		t = next
+	}
+	w.current++
+	return expired
+}
+
+// run 按实际经过的时间推进，处理协程被延迟调度的情况
+func (w *TimingWheel) run(ticker clock.Ticker) {
+	defer ticker.Stop()
+
+	pool := w.opts.Pool
+	if pool == nil {
+		pool = Default()
+	}
+
+	var expired []*WheelTimer
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-ticker.C():
+			target := uint64(now.Sub(w.start) / w.opts.Tick)
+
+			w.mu.Lock()
+			for w.current <= target {
+				expired = w.tickLocked(expired)
+			}
+			w.mu.Unlock()
+
+			for i, t := range expired {
+				pool.GoNamed("timingwheel:"+w.opts.Name, t.fn)
+				expired[i] = nil
+			}
+			expired = expired[:0]
+		}
+	}
+}
@@ -0,0 +1,313 @@
+// @Author Eric
+// @Date 2026/10/29 20:00:00
+// @Desc 时间轮的测试和与 time.Timer 的性能对比
+//
+//	go test ./routine -run '^$' -bench Timer -benchmem
+package routine
+
+import (
+	"context"
+	"github.com/Kyle91/haven/clock"
+	"testing"
+	"time"
+)
+
+// newManualWheel 创建不自动转动的时间轮，由 advance 手动推进
+func newManualWheel(slots, levels int) *TimingWheel {
+	clk := clock.NewMockClock(time.Unix(1700000000, 0))
+	return newTimingWheel(TimingWheelOptions{Name: "manual", Tick: time.Hour, Slots: slots, Levels: levels, Clock: clk})
+}
+
+// advance 推进n个tick，时钟同时走到处理完的tick，直接执行到期的回调
+func advance(w *TimingWheel, n int) {
+	clk := w.opts.Clock.(*clock.MockClock)
+	var expired []*WheelTimer
+	for i := 0; i < n; i++ {
+		w.mu.Lock()
+		expired = w.tickLocked(expired[:0])
+		if now := w.start.Add(time.Duration(w.current) * w.opts.Tick); now.After(clk.Now()) {
+			clk.Set(now)
+		}
+		w.mu.Unlock()
+		for _, t := range expired {
+			t.fn()
+		}
+	}
+}
+
+// currentTick 下一个要处理的tick
+func currentTick(w *TimingWheel) uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+func TestTimingWheelCascade(t *testing.T) {
+	tests := []struct {
+		name          string
+		slots, levels int
+	}{
+		{"single level", 8, 1},
+		{"two levels", 4, 2},
+		{"three levels", 4, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 4个槽2层只能表示16个tick，更长的需要多次下放
+			w := newManualWheel(tt.slots, tt.levels)
+			const maxTicks = 150
+			fired := make(map[uint64][]uint64) // 触发时的tick -> 到期的tick
+
+			// 在不同的起点添加，覆盖各层槽的边界
+			for _, offset := range []int{0, 3, 7} {
+				advance(w, offset)
+				base := currentTick(w)
+				for d := uint64(1); d <= maxTicks; d++ {
+					want := base + d
+					w.AfterFunc(time.Duration(d)*time.Hour, func() {
+						now := currentTick(w) - 1
+						fired[now] = append(fired[now], want)
+					})
+				}
+			}
+			advance(w, maxTicks+20)
+
+			total := 0
+			for now, wants := range fired {
+				for _, want := range wants {
+					if want != now {
+						t.Fatalf("timer due at tick %d fired at %d", want, now)
+					}
+				}
+				total += len(wants)
+			}
+			if total != 3*maxTicks || w.Len() != 0 {
+				t.Fatalf("want %d timers fired, got %d, %d pending", 3*maxTicks, total, w.Len())
+			}
+		})
+	}
+}
+
+func TestTimingWheelOrder(t *testing.T) {
+	w := newManualWheel(4, 2)
+	var order []int
+	for _, d := range []int{9, 2, 30, 5, 17, 1} {
+		d := d
+		w.AfterFunc(time.Duration(d)*time.Hour, func() { order = append(order, d) })
+	}
+	// 不足一个tick的按一个tick计算，不会提前触发
+	w.AfterFunc(time.Minute, func() { order = append(order, 0) })
+	advance(w, 40)
+
+	// 同一个tick到期的按添加顺序触发
+	want := []int{1, 0, 2, 5, 9, 17, 30}
+	if len(order) != len(want) {
+		t.Fatalf("want %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("want %v, got %v", want, order)
+		}
+	}
+}
+
+func TestWheelTimerStop(t *testing.T) {
+	w := newManualWheel(4, 2)
+	fired := 0
+	near := w.AfterFunc(2*time.Hour, func() { fired++ })
+	far := w.AfterFunc(20*time.Hour, func() { fired++ })
+	kept := w.AfterFunc(3*time.Hour, func() { fired++ })
+
+	if !near.Stop() || !far.Stop() {
+		t.Fatal("Stop on pending timer returned false")
+	}
+	if near.Stop() {
+		t.Fatal("second Stop returned true")
+	}
+	if w.Len() != 1 {
+		t.Fatalf("want 1 pending, got %d", w.Len())
+	}
+	advance(w, 30)
+	if fired != 1 {
+		t.Fatalf("want only the kept timer to fire, got %d", fired)
+	}
+	if kept.Stop() {
+		t.Fatal("Stop on fired timer returned true")
+	}
+}
+
+func TestWheelTimerReset(t *testing.T) {
+	w := newManualWheel(4, 2)
+	var firedAt []uint64
+	timer := w.AfterFunc(3*time.Hour, func() { firedAt = append(firedAt, currentTick(w)-1) })
+
+	// 心跳不断推迟超时
+	for i := 0; i < 5; i++ {
+		advance(w, 2)
+		if !timer.Reset(3 * time.Hour) {
+			t.Fatal("Reset on pending timer returned false")
+		}
+	}
+	if len(firedAt) != 0 {
+		t.Fatalf("timer fired before reset deadline: %v", firedAt)
+	}
+	// 推迟到更高层
+	if !timer.Reset(25 * time.Hour) {
+		t.Fatal("Reset on pending timer returned false")
+	}
+	advance(w, 40)
+	if len(firedAt) != 1 || firedAt[0] != 10+25 {
+		t.Fatalf("want fired at tick 35, got %v", firedAt)
+	}
+
+	// 已经触发的定时器可以重新使用
+	if timer.Reset(time.Hour) {
+		t.Fatal("Reset on fired timer returned true")
+	}
+	advance(w, 2)
+	if len(firedAt) != 2 || w.Len() != 0 {
+		t.Fatalf("reused timer: fired %v, %d pending", firedAt, w.Len())
+	}
+}
+
+func TestTimingWheelLagging(t *testing.T) {
+	w := newManualWheel(4, 2)
+	clk := w.opts.Clock.(*clock.MockClock)
+	var firedAt []uint64
+	// 转动的协程落后了5个tick，到期时间从实际时间开始计算
+	clk.Add(5 * time.Hour)
+	w.AfterFunc(3*time.Hour, func() { firedAt = append(firedAt, currentTick(w)-1) })
+	advance(w, 20)
+	if len(firedAt) != 1 || firedAt[0] != 8 {
+		t.Fatalf("want fired at tick 8, got %v", firedAt)
+	}
+}
+
+func TestTimingWheelStopped(t *testing.T) {
+	w := newManualWheel(4, 2)
+	pending := w.AfterFunc(3*time.Hour, func() {})
+	w.Stop()
+
+	// 停止后添加和重置的定时器被忽略，不会增加等待的数量
+	late := w.AfterFunc(time.Hour, func() {})
+	if late == nil || late.Stop() {
+		t.Fatal("timer added after stop is pending")
+	}
+	if late.Reset(time.Hour) || pending.Reset(time.Hour) {
+		t.Fatal("Reset after stop returned true")
+	}
+	if w.Len() != 1 {
+		t.Fatalf("want 1 pending, got %d", w.Len())
+	}
+}
+
+func TestTimingWheelRun(t *testing.T) {
+	p := NewPool(PoolOptions{Name: t.Name(), Workers: 4})
+	defer p.Shutdown(context.Background())
+	w := NewTimingWheel(TimingWheelOptions{Name: t.Name(), Tick: time.Millisecond, Pool: p})
+
+	fired := make(chan struct{}, 1)
+	start := time.Now()
+	w.AfterFunc(20*time.Millisecond, func() { fired <- struct{}{} })
+	pending := w.AfterFunc(time.Hour, func() { fired <- struct{}{} })
+	select {
+	case <-fired:
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Fatalf("fired early after %v", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timer did not fire")
+	}
+
+	// 停止后不再触发
+	w.Stop()
+	pending.Reset(time.Millisecond)
+	select {
+	case <-fired:
+		t.Fatal("timer fired after wheel stopped")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+const (
+	benchTimers  = 100000
+	benchTimeout = 30 * time.Second
+)
+
+func newBenchWheel(b *testing.B) ([]*WheelTimer, *TimingWheel) {
+	w := NewTimingWheel(TimingWheelOptions{Name: "bench", Tick: 100 * time.Millisecond})
+	b.Cleanup(w.Stop)
+	// 预先放入大量定时器，模拟在线连接的心跳超时
+	timers := make([]*WheelTimer, benchTimers)
+	for i := range timers {
+		timers[i] = w.AfterFunc(benchTimeout, func() {})
+	}
+	b.ResetTimer()
+	return timers, w
+}
+
+func newBenchTimers(b *testing.B) []*time.Timer {
+	timers := make([]*time.Timer, benchTimers)
+	for i := range timers {
+		timers[i] = time.AfterFunc(benchTimeout, func() {})
+	}
+	b.Cleanup(func() {
+		for _, t := range timers {
+			t.Stop()
+		}
+	})
+	b.ResetTimer()
+	return timers
+}
+
+func BenchmarkTimingWheelAddStop(b *testing.B) {
+	_, w := newBenchWheel(b)
+	noop := func() {}
+	for i := 0; i < b.N; i++ {
+		w.AfterFunc(benchTimeout, noop).Stop()
+	}
+}
+
+func BenchmarkTimerAddStop(b *testing.B) {
+	newBenchTimers(b)
+	noop := func() {}
+	for i := 0; i < b.N; i++ {
+		time.AfterFunc(benchTimeout, noop).Stop()
+	}
+}
+
+func BenchmarkTimingWheelReset(b *testing.B) {
+	timers, _ := newBenchWheel(b)
+	for i := 0; i < b.N; i++ {
+		timers[i%len(timers)].Reset(benchTimeout)
+	}
+}
+
+func BenchmarkTimerReset(b *testing.B) {
+	timers := newBenchTimers(b)
+	for i := 0; i < b.N; i++ {
+		timers[i%len(timers)].Reset(benchTimeout)
+	}
+}
+
+func BenchmarkTimingWheelResetParallel(b *testing.B) {
+	timers, _ := newBenchWheel(b)
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			timers[i%len(timers)].Reset(benchTimeout)
+			i++
+		}
+	})
+}
+
+func BenchmarkTimerResetParallel(b *testing.B) {
+	timers := newBenchTimers(b)
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			timers[i%len(timers)].Reset(benchTimeout)
+			i++
+		}
+	})
+}